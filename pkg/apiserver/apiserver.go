@@ -22,6 +22,7 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/info"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/logsearch"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/metrics"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/planbundle"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/profiling"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/queryeditor"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/topsql"
@@ -30,6 +31,7 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sqlauth"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user/sso/ssoauth"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/visualplan"
 	"github.com/pingcap/tidb-dashboard/pkg/tiflash"
 	"github.com/pingcap/tidb-dashboard/pkg/utils/version"
 	"github.com/pingcap/tidb-dashboard/util/client/httpclient"
@@ -44,6 +46,7 @@ import (
 	// NOTE: Don't remove above comment line, it is a placeholder for code generator.
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/slowquery"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/statement"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/statistics"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	apiutils "github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
@@ -145,6 +148,9 @@ func (s *Service) Start(ctx context.Context) error {
 		slowquery.Module,
 		debugapi.Module,
 		topsql.Module,
+		visualplan.Module,
+		statistics.Module,
+		planbundle.Module,
 		fx.Populate(&s.apiHandlerEngine),
 		fx.Invoke(
 			info.RegisterRouter,
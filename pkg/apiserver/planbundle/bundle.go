@@ -0,0 +1,216 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package planbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/joomcode/errorx"
+
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+	"github.com/pingcap/tidb-dashboard/util/ziputil"
+)
+
+var (
+	ErrNS            = errorx.NewNamespace("error.api.plan_bundle")
+	ErrInvalidBundle = ErrNS.NewType("invalid_bundle")
+)
+
+// Limits of the decompressed bundle, as a small zip file can be decompressed into a huge one. They are
+// variables so that tests can lower them.
+var (
+	maxBundleEntrySize int64 = 64 << 20
+	maxBundleSize      int64 = 256 << 20
+)
+
+// bundleVersion is increased when the layout of the bundle is changed incompatibly.
+const bundleVersion = 1
+
+// Files in the bundle. Schemas and stats are stored per table, named by `db.table`.
+const (
+	fileMeta             = "meta.json"
+	fileSQL              = "sql/query.sql"
+	fileSessionVariables = "variables/session.json"
+	fileGlobalVariables  = "variables/global.json"
+	fileExplain          = "explain/explain_analyze.txt"
+	filePlan             = "explain/plan.json"
+	dirSchema            = "schema/"
+	dirStats             = "stats/"
+)
+
+type Meta struct {
+	Version     int      `json:"version"`
+	TiDBVersion string   `json:"tidb_version"`
+	Database    string   `json:"database"`
+	CreatedAt   int64    `json:"created_at"`
+	CreatedBy   string   `json:"created_by"`
+	Warnings    []string `json:"warnings"` // e.g. the stats of a table cannot be dumped
+}
+
+// TableFile is the schema or the stats dump of a table.
+type TableFile struct {
+	Table   string `json:"table"` // In the form of `db.table`
+	Content string `json:"content"`
+}
+
+// Bundle is everything needed to reproduce the plan of a statement offline.
+type Bundle struct {
+	Meta             Meta
+	SQL              string
+	Schemas          []TableFile
+	Stats            []TableFile
+	SessionVariables map[string]string
+	GlobalVariables  map[string]string
+	// Explain is the output of EXPLAIN ANALYZE in the tab separated text format, which can be parsed by tidbplan.
+	Explain string
+	Plan    *tidbplan.Plan
+}
+
+func marshalIndent(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
+
+// Entries returns the files of the bundle, in a stable order.
+func (b *Bundle) Entries() ([]ziputil.Entry, error) {
+	meta, err := marshalIndent(b.Meta)
+	if err != nil {
+		return nil, err
+	}
+	sessionVars, err := marshalIndent(b.SessionVariables)
+	if err != nil {
+		return nil, err
+	}
+	globalVars, err := marshalIndent(b.GlobalVariables)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := marshalIndent(b.Plan)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ziputil.Entry{
+		{Name: fileMeta, Content: meta},
+		{Name: fileSQL, Content: []byte(b.SQL)},
+		{Name: fileSessionVariables, Content: sessionVars},
+		{Name: fileGlobalVariables, Content: globalVars},
+		{Name: fileExplain, Content: []byte(b.Explain)},
+		{Name: filePlan, Content: plan},
+	}
+	for _, f := range b.Schemas {
+		entries = append(entries, ziputil.Entry{Name: dirSchema + f.Table + ".sql", Content: []byte(f.Content)})
+	}
+	for _, f := range b.Stats {
+		entries = append(entries, ziputil.Entry{Name: dirStats + f.Table + ".json", Content: []byte(f.Content)})
+	}
+	return entries, nil
+}
+
+// readZipEntry reads the decompressed content of the entry, failing if it is larger than the limit. The size in
+// the header is not trusted, as it can be forged.
+func readZipEntry(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidBundle.Wrap(err, "cannot read %s", f.Name)
+	}
+	defer rc.Close() // #nosec
+	content, err := ioutil.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, ErrInvalidBundle.Wrap(err, "cannot read %s", f.Name)
+	}
+	if int64(len(content)) > limit {
+		return nil, ErrInvalidBundle.New("bundle is too large after decompression, at most %d MB for each file and %d MB in total",
+			maxBundleEntrySize>>20, maxBundleSize>>20)
+	}
+	return content, nil
+}
+
+// ReadBundle reads the bundle from the zip file. The plan is parsed again from the EXPLAIN ANALYZE output, so
+// that bundles exported by older versions benefit from the latest parser.
+func ReadBundle(data []byte) (*Bundle, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidBundle.Wrap(err, "bundle is not a zip file")
+	}
+	files := make(map[string][]byte, len(r.File))
+	remaining := maxBundleSize
+	for _, f := range r.File {
+		if f.UncompressedSize64 > uint64(maxBundleEntrySize) {
+			return nil, ErrInvalidBundle.New("%s is larger than %d MB", f.Name, maxBundleEntrySize>>20)
+		}
+		limit := maxBundleEntrySize
+		if remaining < limit {
+			limit = remaining
+		}
+		content, err := readZipEntry(f, limit)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(content))
+		files[f.Name] = content
+	}
+
+	b := &Bundle{}
+	meta, ok := files[fileMeta]
+	if !ok {
+		return nil, ErrInvalidBundle.New("%s is missing", fileMeta)
+	}
+	if err := json.Unmarshal(meta, &b.Meta); err != nil {
+		return nil, ErrInvalidBundle.Wrap(err, "invalid %s", fileMeta)
+	}
+	if b.Meta.Version > bundleVersion {
+		return nil, ErrInvalidBundle.New("bundle version %d is not supported", b.Meta.Version)
+	}
+	b.SQL = string(files[fileSQL])
+	b.Explain = string(files[fileExplain])
+	for name, vars := range map[string]*map[string]string{
+		fileSessionVariables: &b.SessionVariables,
+		fileGlobalVariables:  &b.GlobalVariables,
+	} {
+		if content, ok := files[name]; ok {
+			if err := json.Unmarshal(content, vars); err != nil {
+				return nil, ErrInvalidBundle.Wrap(err, "invalid %s", name)
+			}
+		}
+	}
+	if strings.TrimSpace(b.Explain) != "" {
+		if b.Plan, err = tidbplan.Parse(b.Explain); err != nil {
+			return nil, ErrInvalidBundle.Wrap(err, "invalid %s", fileExplain)
+		}
+	}
+
+	for name, content := range files {
+		dir, file := path.Split(name)
+		switch dir {
+		case dirSchema:
+			b.Schemas = append(b.Schemas, TableFile{Table: strings.TrimSuffix(file, ".sql"), Content: string(content)})
+		case dirStats:
+			b.Stats = append(b.Stats, TableFile{Table: strings.TrimSuffix(file, ".json"), Content: string(content)})
+		}
+	}
+	for _, files := range [][]TableFile{b.Schemas, b.Stats} {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Table < files[j].Table
+		})
+	}
+	return b, nil
+}
+
+// formatExplainText formats the EXPLAIN rows in the tab separated text format, the same as the plans in the
+// slow log, with the column names as the first line.
+func formatExplainText(columnNames []string, rows [][]string) string {
+	var sb strings.Builder
+	for _, row := range append([][]string{columnNames}, rows...) {
+		sb.WriteString("\t")
+		sb.WriteString(strings.Join(row, "\t"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
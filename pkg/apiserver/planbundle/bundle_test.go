@@ -0,0 +1,104 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package planbundle
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+	"github.com/pingcap/tidb-dashboard/util/ziputil"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	columns := []string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"}
+	rows := [][]string{
+		{"TableReader_7", "10.00", "3", "root", "", "time:2ms, loops:2", "data:Selection_6", "1 KB", "N/A"},
+		{"└─Selection_6", "10.00", "3", "cop[tikv]", "", "tikv_task:{time:1ms, loops:1}", "eq(test.t.a, 1)", "N/A", "N/A"},
+		{"  └─TableFullScan_5", "10000.00", "10000", "cop[tikv]", "table:t", "tikv_task:{time:1ms, loops:1}", "keep order:false", "N/A", "N/A"},
+	}
+	plan, err := tidbplan.ParseRows(columns, rows)
+	require.NoError(t, err)
+
+	tables := involvedTables(plan, "test", []string{"other.t2", "t"})
+	require.Equal(t, [][2]string{{"test", "t"}, {"other", "t2"}}, tables)
+
+	b := &Bundle{
+		Meta:             Meta{Version: bundleVersion, TiDBVersion: "v6.1.0", Database: "test", Warnings: []string{}},
+		SQL:              "select * from t where a = 1;\n",
+		Schemas:          []TableFile{{Table: "test.t", Content: "CREATE TABLE `t` (`a` int);\n"}},
+		Stats:            []TableFile{{Table: "test.t", Content: `{"database_name": "test", "table_name": "t"}`}},
+		SessionVariables: map[string]string{"tidb_opt_agg_push_down": "OFF"},
+		GlobalVariables:  map[string]string{"tidb_opt_agg_push_down": "ON"},
+		Explain:          formatExplainText(columns, rows),
+		Plan:             plan,
+	}
+	entries, err := b.Entries()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, entries, true))
+
+	read, err := ReadBundle(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, b.Meta, read.Meta)
+	require.Equal(t, b.SQL, read.SQL)
+	require.Equal(t, b.Schemas, read.Schemas)
+	require.Equal(t, b.Stats, read.Stats)
+	require.Equal(t, b.SessionVariables, read.SessionVariables)
+	require.Equal(t, b.GlobalVariables, read.GlobalVariables)
+	require.Equal(t, "TableReader_7", read.Plan.Root.ID)
+	require.Equal(t, "TableFullScan_5", read.Plan.Root.Children[0].Children[0].ID)
+	require.Equal(t, 10000.0, *read.Plan.Root.Children[0].Children[0].ActRows)
+}
+
+func TestReadBundleInvalid(t *testing.T) {
+	_, err := ReadBundle([]byte("not zip"))
+	require.True(t, errorx.IsOfType(err, ErrInvalidBundle))
+
+	var buf bytes.Buffer
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, []ziputil.Entry{{Name: fileSQL, Content: []byte("select 1")}}, false))
+	_, err = ReadBundle(buf.Bytes())
+	require.True(t, errorx.IsOfType(err, ErrInvalidBundle))
+
+	buf.Reset()
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, []ziputil.Entry{{Name: fileMeta, Content: []byte(`{"version": 99}`)}}, false))
+	_, err = ReadBundle(buf.Bytes())
+	require.True(t, errorx.IsOfType(err, ErrInvalidBundle))
+}
+
+func TestReadBundleTooLarge(t *testing.T) {
+	defer func(entrySize, size int64) {
+		maxBundleEntrySize, maxBundleSize = entrySize, size
+	}(maxBundleEntrySize, maxBundleSize)
+	maxBundleEntrySize, maxBundleSize = 1024, 1536
+
+	meta := ziputil.Entry{Name: fileMeta, Content: []byte(`{"version": 1}`)}
+	var buf bytes.Buffer
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, []ziputil.Entry{
+		meta,
+		{Name: fileSQL, Content: make([]byte, 2048)},
+	}, true))
+	require.Less(t, buf.Len(), 1024)
+	_, err := ReadBundle(buf.Bytes())
+	require.True(t, errorx.IsOfType(err, ErrInvalidBundle))
+
+	buf.Reset()
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, []ziputil.Entry{
+		meta,
+		{Name: dirSchema + "test.t1.sql", Content: make([]byte, 1000)},
+		{Name: dirSchema + "test.t2.sql", Content: make([]byte, 1000)},
+	}, true))
+	_, err = ReadBundle(buf.Bytes())
+	require.True(t, errorx.IsOfType(err, ErrInvalidBundle))
+
+	buf.Reset()
+	require.NoError(t, ziputil.WriteZipFromEntries(&buf, []ziputil.Entry{
+		meta,
+		{Name: dirSchema + "test.t1.sql", Content: make([]byte, 1000)},
+	}, true))
+	_, err = ReadBundle(buf.Bytes())
+	require.NoError(t, err)
+}
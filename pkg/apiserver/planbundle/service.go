@@ -0,0 +1,411 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package planbundle
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/fx"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+	"github.com/pingcap/tidb-dashboard/util/tidbstats"
+	"github.com/pingcap/tidb-dashboard/util/ziputil"
+)
+
+const maxUploadSize = 64 << 20
+
+// optimizerVariables are the variables affecting the plan, in addition to the `tidb_opt_*` variables.
+var optimizerVariables = []string{
+	"sql_mode",
+	"tidb_allow_mpp",
+	"tidb_enforce_mpp",
+	"tidb_analyze_version",
+	"tidb_cost_model_version",
+	"tidb_enable_index_merge",
+	"tidb_enable_cascades_planner",
+	"tidb_isolation_read_engines",
+	"tidb_index_lookup_size",
+	"tidb_index_join_batch_size",
+	"tidb_distsql_scan_concurrency",
+	"tidb_executor_concurrency",
+	"tidb_hash_join_concurrency",
+	"tidb_mem_quota_query",
+	"tidb_partition_prune_mode",
+}
+
+type ServiceParams struct {
+	fx.In
+	TiDBClient *tidb.Client
+}
+
+type Service struct {
+	params       ServiceParams
+	lifecycleCtx context.Context
+	fSwap        *fileswap.Handler
+}
+
+func newService(lc fx.Lifecycle, p ServiceParams) *Service {
+	service := &Service{params: p, fSwap: fileswap.New()}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			service.lifecycleCtx = ctx
+			return nil
+		},
+	})
+	return service
+}
+
+func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/plan_bundle")
+	endpoint.POST("/export",
+		auth.MWAuthRequired(),
+		auth.MWRequireWritePriv(),
+		utils.MWConnectTiDB(s.params.TiDBClient),
+		s.exportHandler)
+	endpoint.GET("/download", s.downloadHandler)
+	endpoint.POST("/import", auth.MWAuthRequired(), s.importHandler)
+}
+
+type ExportRequest struct {
+	Statement string `json:"statement" binding:"required" example:"select * from t where a = 1"`
+	// The current database when running the statement.
+	Database string `json:"database"`
+	// Tables to include besides the tables accessed by the plan, in the form of `db.table` or `table`.
+	Tables []string `json:"tables"`
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRows runs the query and returns all rows in strings, where NULL values are empty.
+func queryRows(ctx context.Context, db queryer, query string, args ...interface{}) ([]string, [][]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make([][]string, 0)
+	values := make([]sql.NullString, len(columns))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		result = append(result, row)
+	}
+	return columns, result, rows.Err()
+}
+
+func queryVariables(ctx context.Context, conn *sql.Conn, scope string) (map[string]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(optimizerVariables)), ", ")
+	args := make([]interface{}, 0, len(optimizerVariables))
+	for _, name := range optimizerVariables {
+		args = append(args, name)
+	}
+	query := fmt.Sprintf(`SHOW %s VARIABLES WHERE Variable_name LIKE 'tidb\_opt\_%%' OR Variable_name IN (%s)`,
+		scope, placeholders)
+	_, rows, err := queryRows(ctx, conn, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(rows))
+	for _, row := range rows {
+		if len(row) >= 2 {
+			vars[row[0]] = row[1]
+		}
+	}
+	return vars, nil
+}
+
+// explainAnalyze runs EXPLAIN ANALYZE in a transaction which is always rolled back, so that DML statements do
+// not change the data.
+func explainAnalyze(ctx context.Context, conn *sql.Conn, stmt string) ([]string, [][]string, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	return queryRows(ctx, tx, "EXPLAIN ANALYZE "+stmt)
+}
+
+// involvedTables returns the tables accessed by the plan and the requested tables, qualified by the database.
+func involvedTables(plan *tidbplan.Plan, database string, requested []string) [][2]string {
+	var tables [][2]string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		db, table := database, name
+		if i := strings.Index(name, "."); i >= 0 {
+			db, table = name[:i], name[i+1:]
+		}
+		if db == "" || table == "" || seen[db+"."+table] {
+			return
+		}
+		seen[db+"."+table] = true
+		tables = append(tables, [2]string{db, table})
+	}
+	if plan != nil {
+		for _, tree := range append([]*tidbplan.Node{plan.Root}, plan.CTEs...) {
+			tree.Walk(func(node *tidbplan.Node, _ int) bool {
+				if table := tidbplan.AccessTable(node.AccessObject); table != "" {
+					add(table)
+				}
+				return true
+			})
+		}
+	}
+	for _, name := range requested {
+		add(strings.TrimSpace(name))
+	}
+	return tables
+}
+
+func (s *Service) buildBundle(ctx context.Context, conn *sql.Conn, req *ExportRequest) (*Bundle, error) {
+	stmt := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(req.Statement), ";"))
+	if stmt == "" || strings.Contains(stmt, ";") {
+		return nil, rest.ErrBadRequest.New("A single statement is required")
+	}
+	b := &Bundle{
+		Meta: Meta{
+			Version:   bundleVersion,
+			Database:  req.Database,
+			CreatedAt: time.Now().Unix(),
+			Warnings:  make([]string, 0),
+		},
+		SQL: stmt + ";\n",
+	}
+
+	if req.Database != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdentifier(req.Database)); err != nil {
+			return nil, err
+		}
+	}
+	if _, rows, err := queryRows(ctx, conn, "SELECT tidb_version()"); err == nil && len(rows) > 0 {
+		b.Meta.TiDBVersion = rows[0][0]
+	}
+	var err error
+	if b.SessionVariables, err = queryVariables(ctx, conn, "SESSION"); err != nil {
+		return nil, err
+	}
+	if b.GlobalVariables, err = queryVariables(ctx, conn, "GLOBAL"); err != nil {
+		return nil, err
+	}
+
+	columns, rows, err := explainAnalyze(ctx, conn, stmt)
+	if err != nil {
+		return nil, err
+	}
+	b.Explain = formatExplainText(columns, rows)
+	if b.Plan, err = tidbplan.ParseRows(columns, rows); err != nil {
+		return nil, err
+	}
+	b.Plan.Analyze(tidbplan.DefaultTopN)
+	b.Plan.CheckEstimation(0)
+
+	for _, t := range involvedTables(b.Plan, req.Database, req.Tables) {
+		name := t[0] + "." + t[1]
+		_, rows, err := queryRows(ctx, conn, fmt.Sprintf("SHOW CREATE TABLE %s.%s", quoteIdentifier(t[0]), quoteIdentifier(t[1])))
+		if err != nil || len(rows) == 0 || len(rows[0]) < 2 {
+			b.Meta.Warnings = append(b.Meta.Warnings, fmt.Sprintf("Failed to get the schema of %s: %v", name, err))
+			continue
+		}
+		b.Schemas = append(b.Schemas, TableFile{Table: name, Content: rows[0][1] + ";\n"})
+
+		stats, err := s.params.TiDBClient.SendGetRequest(
+			fmt.Sprintf("/stats/dump/%s/%s", url.PathEscape(t[0]), url.PathEscape(t[1])))
+		if err != nil {
+			b.Meta.Warnings = append(b.Meta.Warnings, fmt.Sprintf("Failed to dump the stats of %s: %v", name, err))
+			continue
+		}
+		b.Stats = append(b.Stats, TableFile{Table: name, Content: string(stats)})
+	}
+	return b, nil
+}
+
+// @ID planBundleExport
+// @Summary Export a bundle to reproduce the plan of a statement
+// @Description The bundle contains the SQL, the schemas and stats of the tables, the optimizer variables, the TiDB version and the EXPLAIN ANALYZE output. DML statements are executed in a transaction which is always rolled back.
+// @Param request body ExportRequest true "Request body"
+// @Produce plain
+// @Success 200 {string} string "download token"
+// @Router /plan_bundle/export [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) exportHandler(c *gin.Context) {
+	var req ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.lifecycleCtx, time.Minute*5)
+	defer cancel()
+
+	sqlDB, err := utils.GetTiDBConnection(c).DB()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	// A dedicated connection is required, as USE only affects the current connection.
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	bundle, err := s.buildBundle(ctx, conn, &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	bundle.Meta.CreatedBy = utils.GetSession(c).DisplayName
+	entries, err := bundle.Entries()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	writer, err := s.fSwap.NewFileWriter("plan_bundle")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	if err := ziputil.WriteZipFromEntries(writer, entries, true); err != nil {
+		writer.Remove()
+		_ = c.Error(err)
+		return
+	}
+
+	fileName := fmt.Sprintf("plan_bundle_%d.zip", bundle.Meta.CreatedAt)
+	downloadToken, err := writer.GetDownloadToken(fileName, time.Minute*5)
+	if err != nil {
+		// This shall never happen
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, downloadToken)
+}
+
+// @ID planBundleDownload
+// @Summary Download an exported bundle
+// @Param token query string true "download token"
+// @Success 200 {object} string
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /plan_bundle/download [get]
+func (s *Service) downloadHandler(c *gin.Context) {
+	s.fSwap.HandleDownloadRequest(c)
+}
+
+type ImportResponse struct {
+	Meta             Meta                    `json:"meta"`
+	SQL              string                  `json:"sql"`
+	Schemas          []TableFile             `json:"schemas"`
+	Stats            []*tidbstats.TableStats `json:"stats"`
+	SessionVariables map[string]string       `json:"session_variables"`
+	GlobalVariables  map[string]string       `json:"global_variables"`
+	// Explain is the EXPLAIN ANALYZE output, which can be rendered by the visual plan API.
+	Explain string         `json:"explain"`
+	Plan    *tidbplan.Plan `json:"plan"`
+}
+
+// @ID planBundleImport
+// @Summary Open an exported bundle offline
+// @Accept multipart/form-data
+// @Param file formData file true "bundle file"
+// @Success 200 {object} ImportResponse
+// @Router /plan_bundle/import [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) importHandler(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if fileHeader.Size > maxUploadSize {
+		_ = c.Error(rest.ErrBadRequest.New("Bundle is larger than %d MB", maxUploadSize>>20))
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	data, err := ioutil.ReadAll(f)
+	_ = f.Close()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	bundle, err := ReadBundle(data)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	resp := ImportResponse{
+		Meta:             bundle.Meta,
+		SQL:              bundle.SQL,
+		Schemas:          bundle.Schemas,
+		Stats:            make([]*tidbstats.TableStats, 0, len(bundle.Stats)),
+		SessionVariables: bundle.SessionVariables,
+		GlobalVariables:  bundle.GlobalVariables,
+		Explain:          bundle.Explain,
+		Plan:             bundle.Plan,
+	}
+	for _, f := range bundle.Stats {
+		stats, err := tidbstats.ParseDump([]byte(f.Content))
+		if err != nil {
+			resp.Meta.Warnings = append(resp.Meta.Warnings, fmt.Sprintf("Failed to decode the stats of %s: %v", f.Table, err))
+			continue
+		}
+		resp.Stats = append(resp.Stats, stats)
+	}
+	if resp.Plan != nil {
+		resp.Plan.Analyze(tidbplan.DefaultTopN)
+		resp.Plan.CheckEstimation(0)
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/goccy/go-graphviz"
 	"github.com/google/pprof/driver"
 	"github.com/google/pprof/profile"
+
+	"github.com/pingcap/tidb-dashboard/util/graphvizutil"
 )
 
 func convertProtobufToSVG(content []byte, task TaskModel) ([]byte, error) {
@@ -57,17 +59,7 @@ func convertProtobufToDot(content []byte, task TaskModel) ([]byte, error) {
 }
 
 func convertDotToSVG(dotContent []byte) ([]byte, error) {
-	g := graphviz.New()
-	graph, err := graphviz.ParseBytes(dotContent)
-	if err != nil {
-		return nil, err
-	}
-
-	svgWriteCloser := &writeCloser{}
-	if err := g.Render(graph, graphviz.SVG, svgWriteCloser); err != nil {
-		return nil, err
-	}
-	return svgWriteCloser.data, nil
+	return graphvizutil.RenderDOT(dotContent, graphviz.SVG)
 }
 
 // implement a writer to write content to []byte.
@@ -0,0 +1,193 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const killTimeout = time.Second * 5
+
+// execution is a running execution of the statements submitted by the user.
+type execution struct {
+	id           string
+	user         string
+	statements   string
+	connectionID int64 // The connection ID in TiDB, used to kill the query
+	startTime    time.Time
+	cancel       context.CancelFunc
+
+	mu        sync.Mutex
+	cancelled bool
+}
+
+func (e *execution) markCancelled() {
+	e.mu.Lock()
+	e.cancelled = true
+	e.mu.Unlock()
+}
+
+func (e *execution) isCancelled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cancelled
+}
+
+// executionRegistry tracks the running executions, so that they can be cancelled by another request.
+type executionRegistry struct {
+	mu         sync.Mutex
+	executions map[string]*execution
+}
+
+func newExecutionRegistry() *executionRegistry {
+	return &executionRegistry{executions: make(map[string]*execution)}
+}
+
+func (r *executionRegistry) add(e *execution) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.executions[e.id]; ok {
+		return false
+	}
+	r.executions[e.id] = e
+	return true
+}
+
+func (r *executionRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.executions, id)
+	r.mu.Unlock()
+}
+
+func (r *executionRegistry) get(id string) *execution {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.executions[id]
+}
+
+func (r *executionRegistry) listByUser(user string) []*execution {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]*execution, 0)
+	for _, e := range r.executions {
+		if e.user == user {
+			result = append(result, e)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].startTime.Before(result[j].startTime)
+	})
+	return result
+}
+
+// execer is satisfied by *sql.DB and *sql.Conn.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// killQuery kills the running query of the connection. `KILL TIDB` is used as plain `KILL` does nothing in
+// TiDB by default. Note that the query can be only killed when the statement is sent to the same TiDB instance,
+// unless the global kill is enabled.
+func killQuery(db execer, connectionID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+	_, err := db.ExecContext(ctx, fmt.Sprintf("KILL TIDB QUERY %d", connectionID))
+	return err
+}
+
+// stop stops the running query. The query is killed in TiDB at best effort, and the connection is closed by
+// canceling the context, so that reading the result is interrupted even if the kill does not take effect.
+func (e *execution) stop(db execer) error {
+	err := killQuery(db, e.connectionID)
+	if err != nil {
+		log.Warn("Failed to kill query", zap.Int64("connection_id", e.connectionID), zap.Error(err))
+	}
+	e.cancel()
+	return err
+}
+
+type CancelRequest struct {
+	ExecutionID string `json:"execution_id" binding:"required"`
+}
+
+type CancelResponse struct {
+	// KillErrorMsg is the error of `KILL TIDB QUERY`, in which case the query may still run in TiDB until it
+	// notices the closed connection.
+	KillErrorMsg string `json:"kill_error_msg"`
+}
+
+// @ID queryEditorCancel
+// @Summary Cancel a running execution
+// @Param request body CancelRequest true "Request body"
+// @Success 200 {object} CancelResponse
+// @Router /query_editor/cancel [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) cancelHandler(c *gin.Context) {
+	var req CancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	e := s.executions.get(req.ExecutionID)
+	if e == nil {
+		_ = c.Error(rest.ErrNotFound.New("Execution %s is not running", req.ExecutionID))
+		return
+	}
+	if e.user != utils.GetSession(c).Identity() {
+		_ = c.Error(rest.ErrForbidden.New("Execution %s is not started by the current user", req.ExecutionID))
+		return
+	}
+	sqlDB, err := utils.GetTiDBConnection(c).DB()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	e.markCancelled()
+	resp := CancelResponse{}
+	if err := e.stop(sqlDB); err != nil {
+		resp.KillErrorMsg = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type ExecutionInfo struct {
+	ExecutionID string `json:"execution_id"`
+	Statements  string `json:"statements"`
+	StartTime   int64  `json:"start_time"` // Unix timestamp in milliseconds
+}
+
+// @ID queryEditorListExecutions
+// @Summary List running executions of the current user
+// @Success 200 {array} ExecutionInfo
+// @Router /query_editor/executions [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) listExecutionsHandler(c *gin.Context) {
+	executions := s.executions.listByUser(utils.GetSession(c).Identity())
+	result := make([]ExecutionInfo, 0, len(executions))
+	for _, e := range executions {
+		result = append(result, ExecutionInfo{
+			ExecutionID: e.id,
+			Statements:  e.statements,
+			StartTime:   e.startTime.UnixNano() / int64(time.Millisecond),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/mysql"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/sqlutil"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+type ExplainFormat string
+
+const (
+	ExplainFormatRow     ExplainFormat = "row"
+	ExplainFormatVerbose ExplainFormat = "verbose"
+)
+
+type ExplainRequest struct {
+	Statement string `json:"statement" binding:"required" example:"select * from t where a = 1"`
+	// Analyze executes the statement to collect the runtime stats. DML statements are executed in a transaction
+	// which is always rolled back.
+	Analyze bool          `json:"analyze"`
+	Format  ExplainFormat `json:"format" enums:"row,verbose"`
+	// QErrorThreshold is used to report the misestimated operators when Analyze is true.
+	QErrorThreshold float64 `json:"q_error_threshold"`
+}
+
+type ExplainResponse struct {
+	ErrorMsg    string         `json:"error_msg"`
+	Statement   string         `json:"statement"` // The executed EXPLAIN statement
+	Plan        *tidbplan.Plan `json:"plan"`
+	EstCost     *float64       `json:"est_cost"` // Estimated cost of the root operator, only in the verbose format
+	ExecutionMs int64          `json:"execution_ms"`
+}
+
+// normalizeSingleStatement parses the statement in the SQL mode, and returns its text without the trailing
+// semicolon. Only a single query (SELECT, set operations like UNION, and their WITH clauses) or DML statement is
+// accepted, which can be explained and traced.
+func normalizeSingleStatement(stmt string, sqlMode mysql.SQLMode) (string, error) {
+	if strings.TrimSpace(stmt) == "" {
+		return "", rest.ErrBadRequest.New("Statement is empty")
+	}
+	node, err := sqlutil.ParseOne(stmt, sqlMode)
+	if err != nil {
+		return "", rest.ErrBadRequest.WrapWithNoMessage(err)
+	}
+	switch node.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt, *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+		return sqlutil.StatementText(node), nil
+	default:
+		return "", rest.ErrBadRequest.New("Only a query or DML statement can be explained or traced")
+	}
+}
+
+// buildExplainStatement prefixes the statement with the EXPLAIN clause.
+func buildExplainStatement(req *ExplainRequest, sqlMode mysql.SQLMode) (string, error) {
+	stmt, err := normalizeSingleStatement(req.Statement, sqlMode)
+	if err != nil {
+		return "", err
+	}
+
+	clause := "EXPLAIN"
+	if req.Analyze {
+		clause += " ANALYZE"
+	}
+	switch req.Format {
+	case "", ExplainFormatRow:
+	case ExplainFormatVerbose:
+		clause += " FORMAT = 'verbose'"
+	default:
+		return "", rest.ErrBadRequest.New("Unsupported format %s", req.Format)
+	}
+	return fmt.Sprintf("%s %s", clause, stmt), nil
+}
+
+// runExplain executes the EXPLAIN statement. EXPLAIN ANALYZE executes the statement for real, so it is run in a
+// transaction that is always rolled back, to keep the data untouched when explaining DML statements.
+func runExplain(ctx context.Context, db *sql.DB, analyze bool, explainStmt string) ([]string, [][]interface{}, error) {
+	if !analyze {
+		return executeStatements(ctx, db, explainStmt)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	return executeStatements(ctx, tx, explainStmt)
+}
+
+// @ID queryEditorExplain
+// @Summary Explain a statement and get the structured plan
+// @Description Run EXPLAIN, EXPLAIN ANALYZE or EXPLAIN FORMAT = 'verbose' for the statement. Sessions without the write privilege can only analyze read-only statements.
+// @Param request body ExplainRequest true "Request body"
+// @Success 200 {object} ExplainResponse
+// @Router /query_editor/explain [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) explainHandler(c *gin.Context) {
+	var req ExplainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	sqlMode, err := sessionSQLMode(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	explainStmt, err := buildExplainStatement(&req, sqlMode)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	// EXPLAIN ANALYZE executes the statement, although DML statements are rolled back.
+	if err := requireReadOnly(c, explainStmt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.lifecycleCtx, time.Minute*5)
+	defer cancel()
+
+	sqlDB, err := utils.GetTiDBConnection(c).DB()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	startTime := time.Now()
+	colNames, rows, err := runExplain(ctx, sqlDB, req.Analyze, explainStmt)
+	elapsedTime := time.Since(startTime)
+
+	var plan *tidbplan.Plan
+	if err == nil {
+		plan, err = tidbplan.ParseRows(colNames, toStringRows(rows))
+	}
+	if err != nil {
+		log.Warn("Failed to explain user input statement", zap.String("statement", explainStmt), zap.Error(err))
+		c.JSON(http.StatusOK, ExplainResponse{
+			ErrorMsg:    err.Error(),
+			Statement:   explainStmt,
+			ExecutionMs: elapsedTime.Milliseconds(),
+		})
+		return
+	}
+
+	plan.Analyze(tidbplan.DefaultTopN)
+	if req.Analyze {
+		plan.CheckEstimation(req.QErrorThreshold)
+	}
+	c.JSON(http.StatusOK, ExplainResponse{
+		Statement:   explainStmt,
+		Plan:        plan,
+		EstCost:     plan.Root.EstCost,
+		ExecutionMs: elapsedTime.Milliseconds(),
+	})
+}
+
+func toStringRows(rows [][]interface{}) [][]string {
+	result := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		r := make([]string, len(row))
+		for i, v := range row {
+			if s, ok := v.(string); ok {
+				r[i] = s
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
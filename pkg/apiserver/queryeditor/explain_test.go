@@ -0,0 +1,44 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"testing"
+
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSingleStatement(t *testing.T) {
+	for sql, expected := range map[string]string{
+		" select * from t where a = ';' ; ":                      "select * from t where a = ';'",
+		"select 1 union select 2;":                               "select 1 union select 2",
+		"with cte as (select 1) select * from cte":               "with cte as (select 1) select * from cte",
+		"/* explain */ select 1":                                 "/* explain */ select 1",
+		"update t set a = 1 where b = 'trace'":                   "update t set a = 1 where b = 'trace'",
+		"(select a from t) except (select a from t2) order by a": "(select a from t) except (select a from t2) order by a",
+	} {
+		stmt, err := normalizeSingleStatement(sql, mysql.ModeNone)
+		require.NoError(t, err, sql)
+		require.Equal(t, expected, stmt)
+	}
+
+	for _, sql := range []string{
+		"",
+		" ; ",
+		"select 1; select 2",
+		"explain select 1",
+		"desc select 1",
+		"trace select 1",
+		"show tables",
+		"drop table t",
+		"select from",
+	} {
+		_, err := normalizeSingleStatement(sql, mysql.ModeNone)
+		require.Error(t, err, sql)
+	}
+
+	// Double quotes are identifiers under ANSI_QUOTES.
+	_, err := normalizeSingleStatement(`select "a;b" from t`, mysql.ModeANSIQuotes)
+	require.NoError(t, err)
+}
@@ -0,0 +1,225 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+// Older history entries are removed when a user has more entries than this.
+const maxHistoryPerUser = 1000
+
+// HistoryModel is an execution of statements in the query editor.
+type HistoryModel struct {
+	ID           uint   `json:"id" gorm:"primary_key"`
+	CreatedBy    string `json:"created_by" gorm:"index"` // Identity of the user
+	Statements   string `json:"statements" gorm:"type:text"`
+	SavedQueryID string `json:"saved_query_id"` // Not empty when running a saved query
+	ExecutionMs  int64  `json:"execution_ms"`
+	RowsCount    int    `json:"rows_count"` // Sum of actual_rows of all result sets, a lower bound when truncated
+	Truncated    bool   `json:"truncated"`
+	Cancelled    bool   `json:"cancelled"`
+	ErrorMsg     string `json:"error_msg" gorm:"type:text"`
+	CreatedAt    int64  `json:"created_at" gorm:"index"` // Unix timestamp in seconds when the execution starts
+}
+
+func (HistoryModel) TableName() string {
+	return "query_editor_history"
+}
+
+// recordHistory saves the execution into the history of the user. Failures are only logged, as they should
+// not fail the execution.
+func (s *Service) recordHistory(user string, req *RunRequest, savedQueryID string, startTime time.Time, resp *RunResponse) {
+	m := &HistoryModel{
+		CreatedBy:    user,
+		Statements:   req.Statements,
+		SavedQueryID: savedQueryID,
+		ExecutionMs:  resp.ExecutionMs,
+		Cancelled:    resp.Cancelled,
+		ErrorMsg:     resp.ErrorMsg,
+		CreatedAt:    startTime.Unix(),
+	}
+	for _, rs := range resp.ResultSets {
+		m.RowsCount += rs.ActualRows
+		m.Truncated = m.Truncated || rs.Truncated
+	}
+	db := s.params.LocalStore
+	if err := db.Create(m).Error; err != nil {
+		log.Warn("Failed to record query editor history", zap.Error(err))
+		return
+	}
+
+	var ids []uint
+	err := db.Model(&HistoryModel{}).
+		Where("created_by = ?", user).
+		Order("id DESC").
+		Offset(maxHistoryPerUser).
+		Limit(1).
+		Pluck("id", &ids).Error
+	if err == nil && len(ids) > 0 {
+		err = db.Where("created_by = ? AND id <= ?", user, ids[0]).Delete(&HistoryModel{}).Error
+	}
+	if err != nil {
+		log.Warn("Failed to remove old query editor history", zap.Error(err))
+	}
+}
+
+// likePattern builds the LIKE pattern matching the keyword as a substring. Wildcards in the keyword are
+// escaped by backslash.
+func likePattern(keyword string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(keyword) + "%"
+}
+
+type ListHistoryRequest struct {
+	Search string `json:"search" form:"search"` // Only list the executions whose statements contain the text
+	Limit  int    `json:"limit" form:"limit"`   // Default to 100, at most 1000
+	Offset int    `json:"offset" form:"offset"`
+}
+
+type ListHistoryResponse struct {
+	Total int64          `json:"total"`
+	Items []HistoryModel `json:"items"`
+}
+
+// @ID queryEditorListHistory
+// @Summary List the execution history of the current user
+// @Description The latest executions come first. Only the latest 1000 executions of each user are kept.
+// @Param q query ListHistoryRequest true "Query"
+// @Success 200 {object} ListHistoryResponse
+// @Router /query_editor/history [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) listHistoryHandler(c *gin.Context) {
+	var req ListHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if req.Limit > maxHistoryPerUser {
+		req.Limit = maxHistoryPerUser
+	}
+
+	query := s.params.LocalStore.Model(&HistoryModel{}).Where("created_by = ?", utils.GetSession(c).Identity())
+	if search := strings.TrimSpace(req.Search); search != "" {
+		query = query.Where(`statements LIKE ? ESCAPE '\'`, likePattern(search))
+	}
+	resp := ListHistoryResponse{Items: make([]HistoryModel, 0)}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := query.Order("id DESC").Limit(req.Limit).Offset(req.Offset).Find(&resp.Items).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// findHistory finds the history entry of the current user.
+func (s *Service) findHistory(c *gin.Context) (*HistoryModel, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, rest.ErrBadRequest.New("Invalid history ID %s", c.Param("id"))
+	}
+	var m HistoryModel
+	err = s.params.LocalStore.
+		Where("id = ? AND created_by = ?", id, utils.GetSession(c).Identity()).
+		First(&m).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, rest.ErrNotFound.New("History %d is not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// @ID queryEditorDeleteHistory
+// @Summary Delete an execution from the history of the current user
+// @Param id path string true "history ID"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /query_editor/history/{id} [delete]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) deleteHistoryHandler(c *gin.Context) {
+	m, err := s.findHistory(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := s.params.LocalStore.Delete(m).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+// @ID queryEditorClearHistory
+// @Summary Delete all executions from the history of the current user
+// @Success 200 {object} rest.EmptyResponse
+// @Router /query_editor/history [delete]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) clearHistoryHandler(c *gin.Context) {
+	err := s.params.LocalStore.
+		Where("created_by = ?", utils.GetSession(c).Identity()).
+		Delete(&HistoryModel{}).Error
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+type RerunRequest struct {
+	MaxRows     int    `json:"max_rows" example:"1000"`
+	ExecutionID string `json:"execution_id"`
+}
+
+// @ID queryEditorRerunHistory
+// @Summary Run the statements of an execution in the history again
+// @Description The execution is recorded in the history as a new entry
+// @Param id path string true "history ID"
+// @Param request body RerunRequest true "Request body"
+// @Success 200 {object} RunResponse
+// @Router /query_editor/history/{id}/rerun [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) rerunHistoryHandler(c *gin.Context) {
+	var req RerunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m, err := s.findHistory(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	s.run(c, &RunRequest{
+		Statements:  m.Statements,
+		MaxRows:     req.MaxRows,
+		ExecutionID: req.ExecutionID,
+	}, m.SavedQueryID)
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+type OptimizerTraceRequest struct {
+	Statement string `json:"statement" binding:"required" example:"select * from t where a = 1"`
+}
+
+type OptimizerTraceResponse struct {
+	ErrorMsg  string                   `json:"error_msg"`
+	Statement string                   `json:"statement"` // The executed TRACE PLAN statement
+	Trace     *tidbplan.OptimizerTrace `json:"trace"`
+}
+
+// fetchOptimizerTrace downloads the trace file dumped by `TRACE PLAN`. TiDB forwards the request to the
+// instance holding the file, so that any instance can be requested.
+func (s *Service) fetchOptimizerTrace(dumpLink string) (*tidbplan.OptimizerTrace, error) {
+	data, err := s.params.TiDBClient.SendGetRequest("/optimize_trace/dump/" + url.PathEscape(dumpLink))
+	if err != nil {
+		return nil, err
+	}
+	return tidbplan.ParseOptimizerTraceZip(data)
+}
+
+// @ID queryEditorOptimizerTrace
+// @Summary Trace how the optimizer builds the plan of a statement
+// @Description The trace contains the logical rewrite rules applied, and the physical alternatives considered with their costs. The statement is not executed.
+// @Param request body OptimizerTraceRequest true "Request body"
+// @Success 200 {object} OptimizerTraceResponse
+// @Router /query_editor/optimizer_trace [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) optimizerTraceHandler(c *gin.Context) {
+	var req OptimizerTraceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	sqlMode, err := sessionSQLMode(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	stmt, err := normalizeSingleStatement(req.Statement, sqlMode)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	traceStmt := fmt.Sprintf("TRACE PLAN %s", stmt)
+
+	ctx, cancel := context.WithTimeout(s.lifecycleCtx, time.Minute*5)
+	defer cancel()
+
+	sqlDB, err := utils.GetTiDBConnection(c).DB()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	var trace *tidbplan.OptimizerTrace
+	_, rows, err := executeStatements(ctx, sqlDB, traceStmt)
+	if err == nil {
+		if len(rows) == 0 || len(rows[0]) == 0 {
+			err = fmt.Errorf("TRACE PLAN returns no dump link")
+		} else {
+			trace, err = s.fetchOptimizerTrace(toStringRows(rows)[0][0])
+		}
+	}
+	if err != nil {
+		log.Warn("Failed to trace user input statement", zap.String("statement", traceStmt), zap.Error(err))
+		c.JSON(http.StatusOK, OptimizerTraceResponse{
+			ErrorMsg:  err.Error(),
+			Statement: traceStmt,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, OptimizerTraceResponse{
+		Statement: traceStmt,
+		Trace:     trace,
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/tidb/parser/mysql"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/sqlutil"
+)
+
+const maxStatementLenInError = 200
+
+// sessionSQLMode returns the SQL mode of the connection, which decides how the statements are parsed.
+func sessionSQLMode(c *gin.Context) (mysql.SQLMode, error) {
+	var sqlModeStr string
+	if err := utils.GetTiDBConnection(c).Raw("SELECT @@SESSION.sql_mode").Row().Scan(&sqlModeStr); err != nil {
+		return 0, err
+	}
+	return mysql.GetSQLMode(sqlModeStr)
+}
+
+// requireReadOnly rejects the statements if any of them is mutating, when the session has no write privilege,
+// e.g. a shared session whose write privilege is revoked. The statements are parsed in the SQL mode of the
+// connection, which decides how strings are quoted and thus how the statements are split.
+func requireReadOnly(c *gin.Context, sql string) error {
+	if utils.GetSession(c).IsWriteable {
+		return nil
+	}
+	sqlMode, err := sessionSQLMode(c)
+	if err != nil {
+		return err
+	}
+	stmt, err := sqlutil.FirstMutating(sql, sqlMode)
+	if err != nil {
+		return rest.ErrBadRequest.WrapWithNoMessage(err)
+	}
+	if stmt != "" {
+		text := []rune(stmt)
+		if len(text) > maxStatementLenInError {
+			text = append(text[:maxStatementLenInError], []rune("...")...)
+		}
+		return rest.ErrForbidden.New("Only read-only statements (SELECT, SHOW, EXPLAIN, DESC) are allowed without the write privilege, but got: %s", string(text))
+	}
+	return nil
+}
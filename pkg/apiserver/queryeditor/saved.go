@@ -0,0 +1,452 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/sqlutil"
+)
+
+var (
+	// Parameters are referenced in the statements by {{name}}.
+	parameterRefPattern  = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+	parameterNamePattern = regexp.MustCompile(`^\w+$`)
+	// Only decimal literals, which are substituted into the statements as is.
+	numberPattern = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][-+]?\d+)?$`)
+)
+
+type ParameterType string
+
+const (
+	// ParameterTypeString values are substituted as quoted string literals.
+	ParameterTypeString ParameterType = "string"
+	// ParameterTypeNumber values must be numbers, and are substituted as is.
+	ParameterTypeNumber ParameterType = "number"
+	// ParameterTypeIdentifier values are substituted as quoted identifiers, e.g. table names.
+	ParameterTypeIdentifier ParameterType = "identifier"
+)
+
+type SavedQueryParameter struct {
+	Name        string        `json:"name" binding:"required"`
+	Type        ParameterType `json:"type" enums:"string,number,identifier"` // Default to string
+	Default     string        `json:"default"`                               // The parameter is required when empty
+	Description string        `json:"description"`
+}
+
+// SavedQueryModel is a named query shared by all users, e.g. a diagnostic query of the runbooks.
+type SavedQueryModel struct {
+	ID          string `gorm:"primary_key"`
+	Name        string `gorm:"index"`
+	Description string `gorm:"type:text"`
+	Statements  string `gorm:"type:text"`
+	Parameters  string `gorm:"type:text"` // JSON of []SavedQueryParameter
+	CreatedAt   int64
+	CreatedBy   string
+	UpdatedAt   int64
+	UpdatedBy   string
+}
+
+func (SavedQueryModel) TableName() string {
+	return "query_editor_saved_queries"
+}
+
+type SavedQuery struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Statements  string                `json:"statements"`
+	Parameters  []SavedQueryParameter `json:"parameters"`
+	CreatedAt   int64                 `json:"created_at"` // Unix timestamp in seconds
+	CreatedBy   string                `json:"created_by"`
+	UpdatedAt   int64                 `json:"updated_at"` // Unix timestamp in seconds
+	UpdatedBy   string                `json:"updated_by"`
+}
+
+func newSavedQuery(m *SavedQueryModel) (*SavedQuery, error) {
+	q := &SavedQuery{
+		ID:          m.ID,
+		Name:        m.Name,
+		Description: m.Description,
+		Statements:  m.Statements,
+		Parameters:  make([]SavedQueryParameter, 0),
+		CreatedAt:   m.CreatedAt,
+		CreatedBy:   m.CreatedBy,
+		UpdatedAt:   m.UpdatedAt,
+		UpdatedBy:   m.UpdatedBy,
+	}
+	if m.Parameters != "" {
+		if err := json.Unmarshal([]byte(m.Parameters), &q.Parameters); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// validateParameters checks the parameter definitions, and that all parameters referenced in the statements
+// are defined.
+func validateParameters(statements string, params []SavedQueryParameter) error {
+	defined := make(map[string]bool, len(params))
+	for i := range params {
+		p := &params[i]
+		if !parameterNamePattern.MatchString(p.Name) {
+			return rest.ErrBadRequest.New("Invalid parameter name %s", p.Name)
+		}
+		if defined[p.Name] {
+			return rest.ErrBadRequest.New("Duplicated parameter %s", p.Name)
+		}
+		defined[p.Name] = true
+		switch p.Type {
+		case "":
+			p.Type = ParameterTypeString
+		case ParameterTypeString, ParameterTypeIdentifier:
+		case ParameterTypeNumber:
+			if p.Default != "" {
+				if !numberPattern.MatchString(p.Default) {
+					return rest.ErrBadRequest.New("Default value of parameter %s is not a number", p.Name)
+				}
+			}
+		default:
+			return rest.ErrBadRequest.New("Unsupported type %s of parameter %s", p.Type, p.Name)
+		}
+	}
+	for _, match := range parameterRefPattern.FindAllStringSubmatch(statements, -1) {
+		if !defined[match[1]] {
+			return rest.ErrBadRequest.New("Parameter %s is referenced but not defined", match[1])
+		}
+	}
+	return checkParameterRefs(statements)
+}
+
+// checkParameterRefs rejects the parameter references inside strings, quoted identifiers or comments, where the
+// quoted values would break out of the quotes instead of being literals. As whether a backslash escapes the quote
+// depends on the SQL mode, the references must be outside quotes both with and without NO_BACKSLASH_ESCAPES.
+func checkParameterRefs(statements string) error {
+	refs := parameterRefPattern.FindAllStringIndex(statements, -1)
+	if len(refs) == 0 {
+		return nil
+	}
+	for _, noBackslashEscapes := range []bool{false, true} {
+		code, err := sqlutil.Mask(statements, noBackslashEscapes)
+		if err != nil {
+			return rest.ErrBadRequest.WrapWithNoMessage(err)
+		}
+		for _, loc := range refs {
+			// A reference is either entirely in the code or not, as it has no quotes or comment delimiters.
+			if code[loc[0]] != '{' {
+				return rest.ErrBadRequest.New("Parameter reference %s is inside quotes or comments", statements[loc[0]:loc[1]])
+			}
+		}
+	}
+	return nil
+}
+
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// bindParameters substitutes the parameter references in the statements by the values, or the default values
+// if not specified. References must be outside quotes and comments. Values are quoted according to the parameter types, so that they cannot change the
+// structure of the statements.
+func bindParameters(statements string, params []SavedQueryParameter, values map[string]string) (string, error) {
+	if err := checkParameterRefs(statements); err != nil {
+		return "", err
+	}
+	literals := make(map[string]string, len(params))
+	for _, p := range params {
+		value, ok := values[p.Name]
+		if !ok {
+			if p.Default == "" {
+				continue
+			}
+			value = p.Default
+		}
+		switch p.Type {
+		case ParameterTypeNumber:
+			value = strings.TrimSpace(value)
+			if !numberPattern.MatchString(value) {
+				return "", rest.ErrBadRequest.New("Value of parameter %s is not a number", p.Name)
+			}
+			literals[p.Name] = value
+		case ParameterTypeIdentifier:
+			literals[p.Name] = quoteIdentifier(value)
+		default:
+			literals[p.Name] = quoteString(value)
+		}
+	}
+
+	var bindErr error
+	result := parameterRefPattern.ReplaceAllStringFunc(statements, func(ref string) string {
+		name := parameterRefPattern.FindStringSubmatch(ref)[1]
+		literal, ok := literals[name]
+		if !ok && bindErr == nil {
+			bindErr = rest.ErrBadRequest.New("Parameter %s is required", name)
+		}
+		return literal
+	})
+	if bindErr != nil {
+		return "", bindErr
+	}
+	return result, nil
+}
+
+type ListSavedQueriesRequest struct {
+	Search string `json:"search" form:"search"` // Only list the queries whose name, description or statements contain the text
+}
+
+// @ID queryEditorListSavedQueries
+// @Summary List saved queries
+// @Param q query ListSavedQueriesRequest true "Query"
+// @Success 200 {array} SavedQuery
+// @Router /query_editor/saved_queries [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) listSavedQueriesHandler(c *gin.Context) {
+	var req ListSavedQueriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	query := s.params.LocalStore.Order("name")
+	if search := strings.TrimSpace(req.Search); search != "" {
+		pattern := likePattern(search)
+		query = query.Where(
+			`name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR statements LIKE ? ESCAPE '\'`,
+			pattern, pattern, pattern)
+	}
+	var models []SavedQueryModel
+	if err := query.Find(&models).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	result := make([]*SavedQuery, 0, len(models))
+	for i := range models {
+		q, err := newSavedQuery(&models[i])
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		result = append(result, q)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Service) findSavedQuery(id string) (*SavedQueryModel, error) {
+	var m SavedQueryModel
+	err := s.params.LocalStore.Where("id = ?", id).First(&m).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, rest.ErrNotFound.New("Saved query %s is not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// @ID queryEditorGetSavedQuery
+// @Summary Get a saved query
+// @Param id path string true "saved query ID"
+// @Success 200 {object} SavedQuery
+// @Router /query_editor/saved_queries/{id} [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) getSavedQueryHandler(c *gin.Context) {
+	m, err := s.findSavedQuery(c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	q, err := newSavedQuery(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+type SaveQueryRequest struct {
+	Name        string                `json:"name" binding:"required"`
+	Description string                `json:"description"`
+	Statements  string                `json:"statements" binding:"required" example:"select * from t where a = {{a}}"`
+	Parameters  []SavedQueryParameter `json:"parameters"`
+}
+
+// fillSavedQuery validates the request and fills the model.
+func fillSavedQuery(m *SavedQueryModel, req *SaveQueryRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return rest.ErrBadRequest.New("Name is empty")
+	}
+	if req.Parameters == nil {
+		req.Parameters = make([]SavedQueryParameter, 0)
+	}
+	if err := validateParameters(req.Statements, req.Parameters); err != nil {
+		return err
+	}
+	params, err := json.Marshal(req.Parameters)
+	if err != nil {
+		return err
+	}
+	m.Name = name
+	m.Description = req.Description
+	m.Statements = req.Statements
+	m.Parameters = string(params)
+	return nil
+}
+
+// @ID queryEditorCreateSavedQuery
+// @Summary Save a query
+// @Description Parameters are referenced in the statements by {{name}}, and are substituted when running the query
+// @Param request body SaveQueryRequest true "Request body"
+// @Success 200 {object} SavedQuery
+// @Router /query_editor/saved_queries [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) createSavedQueryHandler(c *gin.Context) {
+	var req SaveQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	now := time.Now().Unix()
+	user := utils.GetSession(c).DisplayName
+	m := &SavedQueryModel{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		CreatedBy: user,
+		UpdatedAt: now,
+		UpdatedBy: user,
+	}
+	if err := fillSavedQuery(m, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := s.params.LocalStore.Create(m).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	q, err := newSavedQuery(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+// @ID queryEditorUpdateSavedQuery
+// @Summary Update a saved query
+// @Param id path string true "saved query ID"
+// @Param request body SaveQueryRequest true "Request body"
+// @Success 200 {object} SavedQuery
+// @Router /query_editor/saved_queries/{id} [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) updateSavedQueryHandler(c *gin.Context) {
+	var req SaveQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m, err := s.findSavedQuery(c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := fillSavedQuery(m, &req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	m.UpdatedAt = time.Now().Unix()
+	m.UpdatedBy = utils.GetSession(c).DisplayName
+	if err := s.params.LocalStore.Save(m).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	q, err := newSavedQuery(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+// @ID queryEditorDeleteSavedQuery
+// @Summary Delete a saved query
+// @Param id path string true "saved query ID"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /query_editor/saved_queries/{id} [delete]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+func (s *Service) deleteSavedQueryHandler(c *gin.Context) {
+	if err := s.params.LocalStore.Where("id = ?", c.Param("id")).Delete(&SavedQueryModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+type RunSavedQueryRequest struct {
+	RerunRequest
+	Parameters map[string]string `json:"parameters"` // Parameter values by names
+}
+
+// @ID queryEditorRunSavedQuery
+// @Summary Run a saved query with the parameter values
+// @Param id path string true "saved query ID"
+// @Param request body RunSavedQueryRequest true "Request body"
+// @Success 200 {object} RunResponse
+// @Router /query_editor/saved_queries/{id}/run [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+func (s *Service) runSavedQueryHandler(c *gin.Context) {
+	var req RunSavedQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m, err := s.findSavedQuery(c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	q, err := newSavedQuery(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	statements, err := bindParameters(q.Statements, q.Parameters, req.Parameters)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	s.run(c, &RunRequest{
+		Statements:  statements,
+		MaxRows:     req.MaxRows,
+		ExecutionID: req.ExecutionID,
+	}, q.ID)
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateParameters(t *testing.T) {
+	params := []SavedQueryParameter{{Name: "db"}, {Name: "n", Type: ParameterTypeNumber, Default: "10"}}
+	require.NoError(t, validateParameters("select * from {{db}}.t limit {{ n }}", params))
+	require.Equal(t, ParameterTypeString, params[0].Type)
+
+	require.Error(t, validateParameters("select {{x}}", params))
+	require.Error(t, validateParameters("select 1", []SavedQueryParameter{{Name: "a b"}}))
+	require.Error(t, validateParameters("select 1", []SavedQueryParameter{{Name: "a"}, {Name: "a"}}))
+	require.Error(t, validateParameters("select 1", []SavedQueryParameter{{Name: "a", Type: "date"}}))
+	require.Error(t, validateParameters("select 1", []SavedQueryParameter{{Name: "a", Type: ParameterTypeNumber, Default: "x"}}))
+	require.Error(t, validateParameters("select '{{db}}'", params))
+}
+
+func TestBindParameters(t *testing.T) {
+	params := []SavedQueryParameter{
+		{Name: "user", Type: ParameterTypeString},
+		{Name: "table", Type: ParameterTypeIdentifier, Default: "t"},
+		{Name: "limit", Type: ParameterTypeNumber, Default: "10"},
+	}
+	sql := "select * from {{table}} where user = {{user}} and note = {{ user }} limit {{limit}}"
+
+	bound, err := bindParameters(sql, params, map[string]string{"user": `it's \ me`})
+	require.NoError(t, err)
+	require.Equal(t, "select * from `t` where user = 'it''s \\\\ me' and note = 'it''s \\\\ me' limit 10", bound)
+
+	bound, err = bindParameters(sql, params, map[string]string{"user": "", "table": "a`b", "limit": " 5 "})
+	require.NoError(t, err)
+	require.Equal(t, "select * from `a``b` where user = '' and note = '' limit 5", bound)
+
+	_, err = bindParameters(sql, params, map[string]string{})
+	require.Error(t, err)
+	_, err = bindParameters(sql, params, map[string]string{"user": "a", "limit": "1; drop table t"})
+	require.Error(t, err)
+	for _, limit := range []string{"NaN", "Inf", "0x10", "1_000", "1.", ".5", "1e"} {
+		_, err = bindParameters(sql, params, map[string]string{"user": "a", "limit": limit})
+		require.Error(t, err, limit)
+	}
+	for _, limit := range []string{"-1", "1.5", "1e3", "2.5E-2"} {
+		_, err = bindParameters(sql, params, map[string]string{"user": "a", "limit": limit})
+		require.NoError(t, err, limit)
+	}
+
+	// References in strings, quoted identifiers or comments are not substituted.
+	values := map[string]string{"user": "x"}
+	for _, sql := range []string{
+		"select '{{user}}'",
+		"select `{{user}}`",
+		"select 1 /* {{user}} */",
+		"select 1 -- {{user}}",
+		// The reference is outside the string only if backslashes escape quotes.
+		`select 'a\', {{user}} -- '`,
+		`select 'a\', {{user}}`,
+	} {
+		_, err = bindParameters(sql, params, values)
+		require.Error(t, err, sql)
+	}
+	bound, err = bindParameters("select '{{' /* }} */, {{user}} /*! , {{user}} */", params, values)
+	require.NoError(t, err)
+	require.Equal(t, "select '{{' /* }} */, 'x' /*! , 'x' */", bound)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/pingcap/log"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -16,6 +17,7 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	"github.com/pingcap/tidb-dashboard/util/rest"
 )
@@ -24,15 +26,20 @@ type ServiceParams struct {
 	fx.In
 	Config     *config.Config
 	TiDBClient *tidb.Client
+	LocalStore *dbstore.DB
 }
 
 type Service struct {
 	params       ServiceParams
 	lifecycleCtx context.Context
+	executions   *executionRegistry
 }
 
-func NewService(lc fx.Lifecycle, p ServiceParams) *Service {
-	service := &Service{params: p}
+func NewService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	service := &Service{params: p, executions: newExecutionRegistry()}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			service.lifecycleCtx = ctx
@@ -40,7 +47,11 @@ func NewService(lc fx.Lifecycle, p ServiceParams) *Service {
 		},
 	})
 
-	return service
+	return service, nil
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&HistoryModel{}, &SavedQueryModel{})
 }
 
 func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -48,71 +59,147 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.Use(auth.MWAuthRequired())
 	endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 	endpoint.Use(utils.MWForbidByExperimentalFlag(s.params.Config.EnableExperimental))
-	endpoint.POST("/run", auth.MWRequireWritePriv(), s.runHandler)
+	// Sessions without the write privilege are allowed to run read-only statements.
+	endpoint.POST("/run", s.runHandler)
+	endpoint.POST("/explain", s.explainHandler)
+	endpoint.POST("/optimizer_trace", s.optimizerTraceHandler)
+	endpoint.POST("/cancel", s.cancelHandler)
+	endpoint.GET("/executions", s.listExecutionsHandler)
+
+	history := endpoint.Group("/history")
+	{
+		history.GET("", s.listHistoryHandler)
+		history.DELETE("", s.clearHistoryHandler)
+		history.DELETE("/:id", s.deleteHistoryHandler)
+		history.POST("/:id/rerun", s.rerunHistoryHandler)
+	}
+	saved := endpoint.Group("/saved_queries")
+	{
+		saved.GET("", s.listSavedQueriesHandler)
+		saved.POST("", auth.MWRequireWritePriv(), s.createSavedQueryHandler)
+		saved.GET("/:id", s.getSavedQueryHandler)
+		saved.PUT("/:id", auth.MWRequireWritePriv(), s.updateSavedQueryHandler)
+		saved.DELETE("/:id", auth.MWRequireWritePriv(), s.deleteSavedQueryHandler)
+		saved.POST("/:id/run", s.runSavedQueryHandler)
+	}
 }
 
 type RunRequest struct {
 	Statements string `json:"statements" example:"show databases;"`
-	MaxRows    int    `json:"max_rows" example:"1000"`
+	MaxRows    int    `json:"max_rows" example:"1000"` // Max rows to read from each result set
+	// ExecutionID identifies the execution for canceling. It is generated when not specified, but specifying it
+	// allows canceling before the response is received.
+	ExecutionID string `json:"execution_id"`
+}
+
+// ResultSet is the result of a statement. Rows after MaxRows are not read, in which case Truncated is true and
+// the execution is stopped, so that the remaining statements are not executed.
+type ResultSet struct {
+	ColumnNames []string        `json:"column_names"`
+	Rows        [][]interface{} `json:"rows"`
+	Truncated   bool            `json:"truncated"`
+	// ActualRows is the number of rows read. When Truncated, it is a lower bound of the total, counting the row
+	// after MaxRows which tells there are more.
+	ActualRows int `json:"actual_rows"`
 }
 
 type RunResponse struct {
-	ErrorMsg    string          `json:"error_msg"`
+	ExecutionID string `json:"execution_id"`
+	ErrorMsg    string `json:"error_msg"`
+	Cancelled   bool   `json:"cancelled"`
+	// ColumnNames, Rows and ActualRows are of the first result set.
 	ColumnNames []string        `json:"column_names"`
 	Rows        [][]interface{} `json:"rows"`
 	ExecutionMs int64           `json:"execution_ms"`
 	ActualRows  int             `json:"actual_rows"`
+	ResultSets  []ResultSet     `json:"result_sets"`
 }
 
-func executeStatements(context context.Context, db *sql.DB, statements string) ([]string, [][]interface{}, error) {
-	rows, err := db.QueryContext(context, statements)
-	if err != nil {
-		return nil, nil, err
-	}
+const defaultMaxRows = 1000
 
-	defer rows.Close()
+// queryer is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
 
-	colNames, err := rows.Columns()
+// readResultSets executes the statements and reads the result sets one by one. When a result set has more than
+// maxRows rows, the reading stops and then stop is called to interrupt the execution, as closing the rows would
+// otherwise read the remaining rows and execute the remaining statements. All rows are kept when maxRows is
+// negative.
+func readResultSets(ctx context.Context, db queryer, statements string, maxRows int, stop func()) ([]ResultSet, error) {
+	rows, err := db.QueryContext(ctx, statements)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	retRows := make([][]interface{}, 0)
-
-	values := make([]sql.RawBytes, len(colNames))
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
+		return nil, err
 	}
+	defer rows.Close()
 
-	for rows.Next() {
-		err = rows.Scan(scanArgs...)
+	resultSets := make([]ResultSet, 0, 1)
+	for {
+		colNames, err := rows.Columns()
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
+		rs := ResultSet{ColumnNames: colNames, Rows: make([][]interface{}, 0)}
 
-		retRow := make([]interface{}, 0, len(values))
-		var value interface{}
-		for _, col := range values {
-			if col == nil {
-				value = nil
-			} else {
-				value = string(col)
+		values := make([]sql.RawBytes, len(colNames))
+		scanArgs := make([]interface{}, len(values))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		for rows.Next() {
+			if maxRows >= 0 && len(rs.Rows) >= maxRows {
+				rs.Truncated = true
+				break
+			}
+			if err := rows.Scan(scanArgs...); err != nil {
+				return nil, err
 			}
-			retRow = append(retRow, value)
+			row := make([]interface{}, 0, len(values))
+			for _, col := range values {
+				if col == nil {
+					row = append(row, nil)
+				} else {
+					row = append(row, string(col))
+				}
+			}
+			rs.Rows = append(rs.Rows, row)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
 		}
-		retRows = append(retRows, retRow)
+		rs.ActualRows = len(rs.Rows)
+		if rs.Truncated {
+			rs.ActualRows++
+		}
+		resultSets = append(resultSets, rs)
+		if rs.Truncated {
+			if stop != nil {
+				stop()
+			}
+			return resultSets, nil
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
+	return resultSets, nil
+}
 
-	if err = rows.Err(); err != nil {
+// executeStatements executes the statements and returns all rows of the first result set.
+func executeStatements(context context.Context, db queryer, statements string) ([]string, [][]interface{}, error) {
+	resultSets, err := readResultSets(context, db, statements, -1, nil)
+	if err != nil {
 		return nil, nil, err
 	}
-
-	return colNames, retRows, nil
+	return resultSets[0].ColumnNames, resultSets[0].Rows, nil
 }
 
 // @ID queryEditorRun
 // @Summary Run statements
+// @Description Rows are streamed and the execution is stopped once a result set has more than max_rows rows, where the rows after max_rows are not read. The execution can be cancelled by the execution ID. Sessions without the write privilege can only run read-only statements.
 // @Param request body RunRequest true "Request body"
 // @Success 200 {object} RunResponse
 // @Router /query_editor/run [post]
@@ -126,6 +213,22 @@ func (s *Service) runHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	s.run(c, &req, "")
+}
+
+// run executes the statements for the user and records the execution in the history, along with the saved
+// query being run if any.
+func (s *Service) run(c *gin.Context, req *RunRequest, savedQueryID string) {
+	if err := requireReadOnly(c, req.Statements); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.MaxRows <= 0 {
+		req.MaxRows = defaultMaxRows
+	}
+	if req.ExecutionID == "" {
+		req.ExecutionID = uuid.New().String()
+	}
 
 	ctx, cancel := context.WithTimeout(s.lifecycleCtx, time.Minute*5)
 	defer cancel()
@@ -133,32 +236,67 @@ func (s *Service) runHandler(c *gin.Context) {
 	startTime := time.Now()
 	sqlDB, err := utils.GetTiDBConnection(c).DB()
 	if err != nil {
-		panic(err)
+		_ = c.Error(err)
+		return
 	}
-	colNames, rows, err := executeStatements(ctx, sqlDB, req.Statements)
-	elapsedTime := time.Since(startTime)
-
+	// A dedicated connection is used, so that the query can be killed by its connection ID.
+	conn, err := sqlDB.Conn(ctx)
 	if err != nil {
-		log.Warn("Failed to execute user input statements", zap.String("statements", req.Statements), zap.Error(err))
-		c.JSON(http.StatusOK, RunResponse{
-			ErrorMsg:    err.Error(),
-			ColumnNames: nil,
-			Rows:        nil,
-			ExecutionMs: elapsedTime.Milliseconds(),
-			ActualRows:  0,
-		})
+		_ = c.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	var connectionID int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connectionID); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	truncatedRows := rows
-	if len(truncatedRows) > req.MaxRows {
-		truncatedRows = truncatedRows[:req.MaxRows]
+	e := &execution{
+		id:           req.ExecutionID,
+		user:         utils.GetSession(c).Identity(),
+		statements:   req.Statements,
+		connectionID: connectionID,
+		startTime:    startTime,
+		cancel:       cancel,
+	}
+	if !s.executions.add(e) {
+		_ = c.Error(rest.ErrBadRequest.New("Execution %s is already running", req.ExecutionID))
+		return
 	}
+	defer s.executions.remove(req.ExecutionID)
 
-	c.JSON(http.StatusOK, RunResponse{
-		ColumnNames: colNames,
-		Rows:        truncatedRows,
-		ExecutionMs: elapsedTime.Milliseconds(),
-		ActualRows:  len(rows),
+	resultSets, err := readResultSets(ctx, conn, req.Statements, req.MaxRows, func() {
+		_ = e.stop(sqlDB)
 	})
+	elapsedTime := time.Since(startTime)
+
+	var resp RunResponse
+	if err != nil {
+		resp = RunResponse{
+			ExecutionID: req.ExecutionID,
+			ErrorMsg:    err.Error(),
+			Cancelled:   e.isCancelled(),
+			ExecutionMs: elapsedTime.Milliseconds(),
+		}
+		if resp.Cancelled {
+			resp.ErrorMsg = "Execution is cancelled"
+		} else {
+			log.Warn("Failed to execute user input statements", zap.String("statements", req.Statements), zap.Error(err))
+		}
+	} else {
+		first := resultSets[0]
+		resp = RunResponse{
+			ExecutionID: req.ExecutionID,
+			ColumnNames: first.ColumnNames,
+			Rows:        first.Rows,
+			ExecutionMs: elapsedTime.Milliseconds(),
+			ActualRows:  first.ActualRows,
+			ResultSets:  resultSets,
+		}
+	}
+	s.recordHistory(e.user, req, savedQueryID, startTime, &resp)
+	c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,40 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package queryeditor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResultSets(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"a"}).AddRow("1").AddRow("2").AddRow("3").AddRow("4")
+	mock.ExpectQuery("SELECT a FROM t").WillReturnRows(rows)
+
+	stopped := false
+	resultSets, err := readResultSets(context.Background(), db, "SELECT a FROM t", 2, func() {
+		stopped = true
+	})
+	require.NoError(t, err)
+	require.True(t, stopped)
+	require.Len(t, resultSets, 1)
+	require.Equal(t, [][]interface{}{{"1"}, {"2"}}, resultSets[0].Rows)
+	require.True(t, resultSets[0].Truncated)
+	// The rows after the one telling the result is truncated are not read.
+	require.Equal(t, 3, resultSets[0].ActualRows)
+
+	rows = sqlmock.NewRows([]string{"a"}).AddRow("1").AddRow(nil)
+	mock.ExpectQuery("SELECT a FROM t").WillReturnRows(rows)
+	resultSets, err = readResultSets(context.Background(), db, "SELECT a FROM t", 2, nil)
+	require.NoError(t, err)
+	require.Equal(t, [][]interface{}{{"1"}, {nil}}, resultSets[0].Rows)
+	require.False(t, resultSets[0].Truncated)
+	require.Equal(t, 2, resultSets[0].ActualRows)
+}
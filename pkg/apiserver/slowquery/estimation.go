@@ -0,0 +1,154 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+type GetEstimationSummaryRequest struct {
+	Digest          string   `json:"digest" form:"digest"`
+	Plans           []string `json:"plans" form:"plans"`
+	BeginTime       int      `json:"begin_time" form:"begin_time"`
+	EndTime         int      `json:"end_time" form:"end_time"`
+	QErrorThreshold float64  `json:"q_error_threshold" form:"q_error_threshold"`
+	Limit           int      `json:"limit" form:"limit"` // Max number of latest executions to check
+}
+
+// OperatorEstimationSummary is the estimation quality of an operator across executions of the same plan.
+type OperatorEstimationSummary struct {
+	PlanDigest     string  `json:"plan_digest"`
+	ID             string  `json:"id"`
+	AccessObject   string  `json:"access_object"`
+	Executions     int     `json:"executions"`
+	Misestimations int     `json:"misestimations"`
+	Origins        int     `json:"origins"` // Times that the error starts from this operator
+	MaxQError      float64 `json:"max_q_error"`
+	AvgQError      float64 `json:"avg_q_error"`
+	AvgEstRows     float64 `json:"avg_est_rows"` // As displayed in the plan, i.e. per loop for the inner side of index joins
+	AvgActRows     float64 `json:"avg_act_rows"`
+}
+
+type EstimationSummaryResponse struct {
+	Digest     string                      `json:"digest"`
+	Threshold  float64                     `json:"threshold"`
+	Executions int                         `json:"executions"` // Number of executions whose plan is checked
+	Operators  []OperatorEstimationSummary `json:"operators"`  // Operators misestimated at least once
+}
+
+type slowQueryPlan struct {
+	PlanDigest string `gorm:"column:Plan_digest"`
+	Plan       string `gorm:"column:Plan"`
+}
+
+// QueryEstimationSummary checks the estimation of the plans in the slow log executions of a digest, and
+// aggregates the q-error of each operator.
+func QueryEstimationSummary(req *GetEstimationSummaryRequest, db *gorm.DB) (*EstimationSummaryResponse, error) {
+	if req.Limit <= 0 {
+		req.Limit = 1000
+	}
+	tx := db.
+		Select("Plan_digest, Plan").
+		Where("Digest = ?", req.Digest).
+		Order("Time DESC").
+		Limit(req.Limit)
+	if req.BeginTime != 0 && req.EndTime != 0 {
+		tx = tx.Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.BeginTime, req.EndTime)
+	}
+	if len(req.Plans) > 0 {
+		tx = tx.Where("Plan_digest IN (?)", req.Plans)
+	}
+
+	var rows []slowQueryPlan
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	threshold := req.QErrorThreshold
+	if threshold <= 1 {
+		threshold = tidbplan.DefaultQErrorThreshold
+	}
+	resp := &EstimationSummaryResponse{
+		Digest:    req.Digest,
+		Threshold: threshold,
+		Operators: make([]OperatorEstimationSummary, 0),
+	}
+
+	type operatorKey struct {
+		planDigest string
+		id         string
+	}
+	type operatorAgg struct {
+		summary    OperatorEstimationSummary
+		sumQError  float64
+		sumEstRows float64
+		sumActRows float64
+	}
+	aggs := map[operatorKey]*operatorAgg{}
+	var keys []operatorKey
+
+	for _, row := range rows {
+		plan, err := tidbplan.Parse(row.Plan)
+		if err != nil {
+			// The plan may be absent or truncated in the slow log, skip it.
+			continue
+		}
+		resp.Executions++
+		report := plan.CheckEstimation(threshold)
+		origins := map[string]bool{}
+		for _, op := range report.Operators {
+			origins[op.ID] = op.Origin
+		}
+
+		plan.Root.Walk(func(node *tidbplan.Node, _ int) bool {
+			if node.QError == nil {
+				return true
+			}
+			key := operatorKey{planDigest: row.PlanDigest, id: node.ID}
+			agg, ok := aggs[key]
+			if !ok {
+				agg = &operatorAgg{summary: OperatorEstimationSummary{
+					PlanDigest:   row.PlanDigest,
+					ID:           node.ID,
+					AccessObject: node.AccessObject,
+				}}
+				aggs[key] = agg
+				keys = append(keys, key)
+			}
+			agg.summary.Executions++
+			if node.Misestimated {
+				agg.summary.Misestimations++
+			}
+			if origins[node.ID] {
+				agg.summary.Origins++
+			}
+			if *node.QError > agg.summary.MaxQError {
+				agg.summary.MaxQError = *node.QError
+			}
+			agg.sumQError += *node.QError
+			agg.sumEstRows += node.EstRows
+			agg.sumActRows += *node.ActRows
+			return true
+		})
+	}
+
+	for _, key := range keys {
+		agg := aggs[key]
+		if agg.summary.Misestimations == 0 {
+			continue
+		}
+		n := float64(agg.summary.Executions)
+		agg.summary.AvgQError = agg.sumQError / n
+		agg.summary.AvgEstRows = agg.sumEstRows / n
+		agg.summary.AvgActRows = agg.sumActRows / n
+		resp.Operators = append(resp.Operators, agg.summary)
+	}
+	sort.SliceStable(resp.Operators, func(i, j int) bool {
+		return resp.Operators[i].MaxQError > resp.Operators[j].MaxQError
+	})
+	return resp, nil
+}
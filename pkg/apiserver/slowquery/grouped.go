@@ -0,0 +1,148 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package slowquery
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const maxGroupedListLimit = 1000
+
+type GetGroupedListRequest struct {
+	BeginTime int      `json:"begin_time" form:"begin_time"`
+	EndTime   int      `json:"end_time" form:"end_time"`
+	DB        []string `json:"db" form:"db"`
+	Digest    string   `json:"digest" form:"digest"`
+	Plans     []string `json:"plans" form:"plans"`
+	OrderBy   string   `json:"orderBy" form:"orderBy" enums:"count,sum_query_time,p50_query_time,p90_query_time,p99_query_time,max_query_time,sum_process_keys,max_mem,first_seen,last_seen"`
+	IsDesc    bool     `json:"desc" form:"desc"`
+	Limit     int      `json:"limit" form:"limit"`
+	Offset    int      `json:"offset" form:"offset"`
+}
+
+// GroupedModel is the aggregation of the slow queries with the same SQL digest and plan digest. Times are in
+// seconds, the same as Query_time in the slow log.
+type GroupedModel struct {
+	Digest         string  `json:"digest" gorm:"column:Digest"`
+	PlanDigest     string  `json:"plan_digest" gorm:"column:Plan_digest"`
+	DB             string  `json:"db" gorm:"column:DB"`
+	Query          string  `json:"query" gorm:"column:Query"` // A sample of the statements
+	Count          int     `json:"count" gorm:"column:count"`
+	SumQueryTime   float64 `json:"sum_query_time" gorm:"column:sum_query_time"`
+	P50QueryTime   float64 `json:"p50_query_time" gorm:"column:p50_query_time"`
+	P90QueryTime   float64 `json:"p90_query_time" gorm:"column:p90_query_time"`
+	P99QueryTime   float64 `json:"p99_query_time" gorm:"column:p99_query_time"`
+	MaxQueryTime   float64 `json:"max_query_time" gorm:"column:max_query_time"`
+	SumProcessKeys uint64  `json:"sum_process_keys" gorm:"column:sum_process_keys"`
+	MaxMem         uint64  `json:"max_mem" gorm:"column:max_mem"`
+	FirstSeen      float64 `json:"first_seen" gorm:"column:first_seen"` // Unix timestamp
+	LastSeen       float64 `json:"last_seen" gorm:"column:last_seen"`   // Unix timestamp
+}
+
+type GroupedListResponse struct {
+	Total int            `json:"total"` // Number of groups
+	Items []GroupedModel `json:"items"`
+}
+
+var groupedOrderColumns = map[string]bool{
+	"count":            true,
+	"sum_query_time":   true,
+	"p50_query_time":   true,
+	"p90_query_time":   true,
+	"p99_query_time":   true,
+	"max_query_time":   true,
+	"sum_process_keys": true,
+	"max_mem":          true,
+	"first_seen":       true,
+	"last_seen":        true,
+}
+
+// percentileExpr selects the query time of the nearest rank, in the rows ranked by the query time within the
+// group. TiDB does not provide percentile aggregations, so that it is computed by window functions.
+func percentileExpr(p float64, alias string) string {
+	return fmt.Sprintf("MIN(IF(rn >= CEIL(cnt * %g), Query_time, NULL)) AS %s", p, alias)
+}
+
+// QuerySlowLogGroups aggregates the slow queries by the SQL digest and the plan digest.
+func QuerySlowLogGroups(req *GetGroupedListRequest, db *gorm.DB) (*GroupedListResponse, error) {
+	if req.OrderBy == "" {
+		req.OrderBy = "count"
+	}
+	if !groupedOrderColumns[req.OrderBy] {
+		return nil, rest.ErrBadRequest.New("Unknown order by field %s", req.OrderBy)
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if req.Limit > maxGroupedListLimit {
+		req.Limit = maxGroupedListLimit
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	filter := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Table(SlowQueryTable)
+		if req.BeginTime != 0 && req.EndTime != 0 {
+			tx = tx.Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.BeginTime, req.EndTime)
+		}
+		if len(req.DB) > 0 {
+			tx = tx.Where("DB IN (?)", req.DB)
+		}
+		if req.Digest != "" {
+			tx = tx.Where("Digest = ?", req.Digest)
+		}
+		if len(req.Plans) > 0 {
+			tx = tx.Where("Plan_digest IN (?)", req.Plans)
+		}
+		return tx
+	}
+
+	var total int64
+	groups := filter(db.Session(&gorm.Session{NewDB: true})).
+		Select("1").
+		Group("Digest, Plan_digest")
+	if err := db.Session(&gorm.Session{NewDB: true}).Table("(?) AS g", groups).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	ranked := filter(db.Session(&gorm.Session{NewDB: true})).
+		Select(`Digest, Plan_digest, DB, Query, Time, Query_time, Process_keys, Mem_max,
+			ROW_NUMBER() OVER (PARTITION BY Digest, Plan_digest ORDER BY Query_time) AS rn,
+			COUNT(*) OVER (PARTITION BY Digest, Plan_digest) AS cnt`)
+	items := make([]GroupedModel, 0)
+	err := db.Session(&gorm.Session{NewDB: true}).
+		Table("(?) AS r", ranked).
+		Select(`Digest, Plan_digest, ANY_VALUE(DB) AS DB, ANY_VALUE(Query) AS Query,
+			COUNT(*) AS count,
+			SUM(Query_time) AS sum_query_time, ` +
+			percentileExpr(0.5, "p50_query_time") + ", " +
+			percentileExpr(0.9, "p90_query_time") + ", " +
+			percentileExpr(0.99, "p99_query_time") + `,
+			MAX(Query_time) AS max_query_time,
+			SUM(Process_keys) AS sum_process_keys,
+			MAX(Mem_max) AS max_mem,
+			(UNIX_TIMESTAMP(MIN(Time)) + 0E0) AS first_seen,
+			(UNIX_TIMESTAMP(MAX(Time)) + 0E0) AS last_seen`).
+		Group("Digest, Plan_digest").
+		Order(groupedOrder(req.OrderBy, req.IsDesc)).
+		Limit(req.Limit).
+		Offset(req.Offset).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return &GroupedListResponse{Total: int(total), Items: items}, nil
+}
+
+// groupedOrder orders by the field, with the digests as the tie breaker so that the pages are stable.
+func groupedOrder(field string, desc bool) string {
+	if desc {
+		return field + " DESC, Digest, Plan_digest"
+	}
+	return field + " ASC, Digest, Plan_digest"
+}
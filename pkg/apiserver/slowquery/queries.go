@@ -38,7 +38,28 @@ type GetDetailRequest struct {
 	ConnectID string `json:"connect_id" form:"connect_id"`
 }
 
+type GetPlanTreeRequest struct {
+	GetDetailRequest
+	Top             int     `json:"top" form:"top"` // Number of hot operators to rank
+	QErrorThreshold float64 `json:"q_error_threshold" form:"q_error_threshold"`
+}
+
 func QuerySlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.DB) ([]Model, error) {
+	tx, err := BuildSlowLogListQuery(req, sysSchema, db)
+	if err != nil {
+		return nil, err
+	}
+	var results []Model
+	err = tx.Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BuildSlowLogListQuery builds the query of the slow log list, which can be either fetched at once or iterated
+// row by row for exporting.
+func BuildSlowLogListQuery(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.DB) (*gorm.DB, error) {
 	slowQueryColumns, err := sysSchema.GetTableColumnNames(db, SlowQueryTable)
 	if err != nil {
 		return nil, err
@@ -98,13 +119,7 @@ func QuerySlowLogList(req *GetListRequest, sysSchema *utils.SysSchema, db *gorm.
 	if len(req.Digest) > 0 {
 		tx = tx.Where("Digest = ?", req.Digest)
 	}
-
-	var results []Model
-	err = tx.Find(&results).Error
-	if err != nil {
-		return nil, err
-	}
-	return results, nil
+	return tx, nil
 }
 
 func QuerySlowLogDetail(req *GetDetailRequest, db *gorm.DB) (*Model, error) {
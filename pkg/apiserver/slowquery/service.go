@@ -16,7 +16,10 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/util/exportutil"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
 )
 
 var (
@@ -32,10 +35,11 @@ type ServiceParams struct {
 
 type Service struct {
 	params ServiceParams
+	fSwap  *fileswap.Handler
 }
 
 func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+	return &Service{params: p, fSwap: fileswap.New()}
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -47,7 +51,11 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 		endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
 		{
 			endpoint.GET("/list", s.getList)
+			endpoint.GET("/grouped", s.getGroupedList)
 			endpoint.GET("/detail", s.getDetails)
+			endpoint.GET("/plan/tree", s.getPlanTree)
+			endpoint.GET("/plan/export", s.exportPlan)
+			endpoint.GET("/estimation", s.getEstimationSummary)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
@@ -80,6 +88,29 @@ func (s *Service) getList(c *gin.Context) {
 	c.JSON(http.StatusOK, results)
 }
 
+// @Summary List slow queries grouped by the SQL digest and the plan digest, with the query time percentiles
+// @Param q query GetGroupedListRequest true "Query"
+// @Success 200 {object} GroupedListResponse
+// @Router /slow_query/grouped [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getGroupedList(c *gin.Context) {
+	var req GetGroupedListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	result, err := QuerySlowLogGroups(&req, db)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // @Summary Get details of a slow query
 // @Param q query GetDetailRequest true "Query"
 // @Success 200 {object} Model
@@ -102,67 +133,158 @@ func (s *Service) getDetails(c *gin.Context) {
 	c.JSON(http.StatusOK, *result)
 }
 
+// @Summary Get the structured operator tree of a slow query's execution plan, with the time and estimation analysis
+// @Param q query GetPlanTreeRequest true "Query"
+// @Success 200 {object} tidbplan.Plan
+// @Router /slow_query/plan/tree [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) getPlanTree(c *gin.Context) {
+	var req GetPlanTreeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	result, err := QuerySlowLogDetail(&req.GetDetailRequest, db.Table(SlowQueryTable))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan, err := tidbplan.Parse(result.Plan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	plan.Analyze(req.Top)
+	plan.CheckEstimation(req.QErrorThreshold)
+	c.JSON(http.StatusOK, plan)
+}
+
+type ExportPlanRequest struct {
+	GetPlanTreeRequest
+	utils.PlanExportOptions
+}
+
+// @Summary Export the execution plan of a slow query as JSON, DOT, Mermaid, the text tree or Markdown
+// @Param q query ExportPlanRequest true "Query"
+// @Produce json,text/vnd.graphviz,text/markdown,plain
+// @Success 200 {string} string
+// @Router /slow_query/plan/export [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) exportPlan(c *gin.Context) {
+	var req ExportPlanRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	result, err := QuerySlowLogDetail(&req.GetDetailRequest, db.Table(SlowQueryTable))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan, err := tidbplan.Parse(result.Plan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	plan.Analyze(req.Top)
+	plan.CheckEstimation(req.QErrorThreshold)
+	utils.WritePlanExport(c, plan, req.Format)
+}
+
+// @Summary Get the cardinality estimation errors of operators across slow query executions of a digest
+// @Param q query GetEstimationSummaryRequest true "Query"
+// @Success 200 {object} EstimationSummaryResponse
+// @Router /slow_query/estimation [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) getEstimationSummary(c *gin.Context) {
+	var req GetEstimationSummaryRequest
+	if err := c.ShouldBindQuery(&req); err != nil || req.Digest == "" {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	result, err := QueryEstimationSummary(&req, db.Table(SlowQueryTable))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type ExportListRequest struct {
+	GetListRequest
+	exportutil.Options
+}
+
 // @Router /slow_query/download/token [post]
 // @Summary Generate a download token for exported slow query statements
+// @Description Slow queries are streamed into an encrypted temporary file in CSV, JSON Lines or Parquet format
 // @Produce plain
-// @Param request body GetListRequest true "Request body"
+// @Param request body ExportListRequest true "Request body"
 // @Success 200 {string} string "xxx"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadTokenHandler(c *gin.Context) {
-	var req GetListRequest
+	var req ExportListRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
-	fields := []string{}
-	if strings.TrimSpace(req.Fields) != "" {
-		fields = strings.Split(req.Fields, ",")
+	if strings.TrimSpace(req.Fields) == "" {
+		req.Fields = "*"
 	}
+	fields := strings.Split(req.Fields, ",")
 	db := utils.GetTiDBConnection(c)
-	list, err := QuerySlowLogList(&req, s.params.SysSchema, db.Table(SlowQueryTable))
+	query, err := BuildSlowLogListQuery(&req.GetListRequest, s.params.SysSchema, db.Table(SlowQueryTable))
 	if err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
-	if len(list) == 0 {
-		_ = c.Error(ErrNoData.NewWithNoMessage())
-		return
-	}
-
-	// interface{} tricky
-	rawData := make([]interface{}, len(list))
-	for i, v := range list {
-		rawData[i] = v
-	}
 
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{})
-
-	// generate temp file that persist encrypted data
 	timeLayout := "0102150405"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("slowquery_%s_%s_*.csv", beginTime, endTime),
-		"slowquery/download")
+	token, rows, err := utils.ExportQuery(s.fSwap, &utils.ExportRequest{
+		Query:      query,
+		Row:        &Model{},
+		Fields:     fields,
+		TimeFields: []string{"timestamp"},
+		Options:    req.Options,
+		FileName:   fmt.Sprintf("slowquery_%s_%s", beginTime, endTime),
+	})
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
+	if rows == 0 {
+		_ = c.Error(ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /slow_query/download [get]
 // @Summary Download slow query statements
-// @Produce text/csv
+// @Produce octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "slowquery/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Query table columns
@@ -0,0 +1,297 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+// BindingScope is the scope of a SQL binding. Note that session bindings only live in the connection serving
+// the request, so that a session binding created by the dashboard does not affect any application session.
+type BindingScope string
+
+const (
+	BindingScopeGlobal  BindingScope = "global"
+	BindingScopeSession BindingScope = "session"
+)
+
+func (s BindingScope) keyword() (string, error) {
+	switch s {
+	case "", BindingScopeGlobal:
+		return "GLOBAL", nil
+	case BindingScopeSession:
+		return "SESSION", nil
+	default:
+		return "", rest.ErrBadRequest.New("Unknown binding scope %s", s)
+	}
+}
+
+var (
+	sqlDigestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	// Hints are placed right after the first keyword of the statement, e.g. `SELECT /*+ ... */`.
+	hintPositionPattern = regexp.MustCompile(`(?is)^(\s*(?:/\*.*?\*/\s*)*(?:select|update|delete|insert|replace)\b)`)
+	// The sample text is truncated by `tidb_stmt_summary_max_sql_length`, with its length appended.
+	truncatedSQLPattern = regexp.MustCompile(`\(len:\d+\)\s*$`)
+	// The sample text of a prepared statement is followed by its arguments, e.g. `... a = ? [arguments: 1]`.
+	preparedArgumentsPattern = regexp.MustCompile(`(?s)\s*\[arguments: .*\]\s*$`)
+)
+
+// Binding is a row of `SHOW BINDINGS`. SQLDigest and PlanDigest are only available in TiDB 6.0 and later.
+type Binding struct {
+	OriginalSQL string `json:"original_sql" gorm:"column:Original_sql"`
+	BindSQL     string `json:"bind_sql" gorm:"column:Bind_sql"`
+	DefaultDB   string `json:"default_db" gorm:"column:Default_db"`
+	Status      string `json:"status" gorm:"column:Status"` // e.g. enabled, disabled, using
+	CreateTime  string `json:"create_time" gorm:"column:Create_time"`
+	UpdateTime  string `json:"update_time" gorm:"column:Update_time"`
+	Source      string `json:"source" gorm:"column:Source"`
+	SQLDigest   string `json:"sql_digest" gorm:"column:Sql_digest"`
+	PlanDigest  string `json:"plan_digest" gorm:"column:Plan_digest"`
+}
+
+func queryBindings(db *gorm.DB, scope BindingScope) ([]Binding, error) {
+	keyword, err := scope.keyword()
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]Binding, 0)
+	err = db.Raw(fmt.Sprintf("SHOW %s BINDINGS", keyword)).Scan(&bindings).Error
+	return bindings, err
+}
+
+// BindingsOptions is accepted by the statement list and plans, to fill the Bound field at the cost of an extra
+// query of the bindings.
+type BindingsOptions struct {
+	WithBindings bool `json:"with_bindings" form:"with_bindings"`
+}
+
+// markBound sets Bound of the statements whose digest has a global or session binding. Failures are ignored,
+// as the bindings are only informative for the statement list.
+func markBound(db *gorm.DB, statements []Model) {
+	bound := make(map[string]bool)
+	for _, scope := range []BindingScope{BindingScopeGlobal, BindingScopeSession} {
+		bindings, err := queryBindings(db, scope)
+		if err != nil {
+			log.Warn("Failed to query bindings", zap.String("scope", string(scope)), zap.Error(err))
+			return
+		}
+		for _, b := range bindings {
+			if b.SQLDigest != "" && !strings.EqualFold(b.Status, "deleted") {
+				bound[b.SQLDigest] = true
+			}
+		}
+	}
+	for i := range statements {
+		statements[i].Bound = bound[statements[i].AggDigest]
+	}
+}
+
+// bindingOriginalSQL returns the statement to bind from the sample text of the statements summary.
+func bindingOriginalSQL(sample string) string {
+	sql := preparedArgumentsPattern.ReplaceAllString(sample, "")
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(sql), ";"))
+}
+
+// buildBindSQL places the plan hints into the statement.
+func buildBindSQL(sql, planHint string) (string, error) {
+	if truncatedSQLPattern.MatchString(sql) {
+		return "", rest.ErrBadRequest.New("The sample statement is truncated, increase tidb_stmt_summary_max_sql_length and retry")
+	}
+	loc := hintPositionPattern.FindStringIndex(sql)
+	if loc == nil {
+		return "", rest.ErrBadRequest.New("Hints cannot be placed into this statement")
+	}
+	return sql[:loc[1]] + " /*+ " + planHint + " */" + sql[loc[1]:], nil
+}
+
+type GetBindingsRequest struct {
+	Scope  BindingScope `json:"scope" form:"scope" enums:"global,session"`
+	Digest string       `json:"digest" form:"digest"` // Filter by the SQL digest
+}
+
+// @Summary Get SQL bindings
+// @Param q query GetBindingsRequest true "Query"
+// @Success 200 {array} Binding
+// @Router /statements/bindings [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) bindingsHandler(c *gin.Context) {
+	var req GetBindingsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	bindings, err := queryBindings(utils.GetTiDBConnection(c), req.Scope)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.Digest != "" {
+		filtered := make([]Binding, 0)
+		for _, b := range bindings {
+			if b.SQLDigest == req.Digest {
+				filtered = append(filtered, b)
+			}
+		}
+		bindings = filtered
+	}
+	c.JSON(http.StatusOK, bindings)
+}
+
+type CreateBindingRequest struct {
+	GetPlansRequest
+	PlanDigest string       `json:"plan_digest" binding:"required"`
+	Scope      BindingScope `json:"scope" enums:"global,session"`
+}
+
+type CreateBindingResponse struct {
+	OriginalSQL string `json:"original_sql"`
+	BindSQL     string `json:"bind_sql"`
+}
+
+// @Summary Pin a plan of a statement by creating a SQL binding
+// @Description The binding uses the hints of the plan, which requires the plan_hint column of the statements summary
+// @Param request body CreateBindingRequest true "Request body"
+// @Success 200 {object} CreateBindingResponse
+// @Router /statements/bindings [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) createBindingHandler(c *gin.Context) {
+	var req CreateBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	keyword, err := req.Scope.keyword()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	detail, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, []string{req.PlanDigest})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if detail.AggPlanHint == "" {
+		_ = c.Error(rest.ErrBadRequest.New("Plan hints of this plan are not available"))
+		return
+	}
+	originalSQL := bindingOriginalSQL(detail.AggQuerySampleText)
+	bindSQL, err := buildBindSQL(originalSQL, detail.AggPlanHint)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+	sqlDB, err := db.DB()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	// The binding resolves unqualified tables by the current database, so USE must be run in the same connection.
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if detail.AggSchemaName != "" {
+		if _, err := conn.ExecContext(ctx, "USE `"+strings.ReplaceAll(detail.AggSchemaName, "`", "``")+"`"); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE %s BINDING FOR %s USING %s", keyword, originalSQL, bindSQL)); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, CreateBindingResponse{OriginalSQL: originalSQL, BindSQL: bindSQL})
+}
+
+type SetBindingStatusRequest struct {
+	SQLDigest string `json:"sql_digest" binding:"required"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// @Summary Enable or disable a global SQL binding
+// @Param request body SetBindingStatusRequest true "Request body"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /statements/bindings/status [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) setBindingStatusHandler(c *gin.Context) {
+	var req SetBindingStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !sqlDigestPattern.MatchString(req.SQLDigest) {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	status := "DISABLED"
+	if req.Enabled {
+		status = "ENABLED"
+	}
+	// The digest is validated, as the statement cannot be prepared.
+	stmt := fmt.Sprintf("SET BINDING %s FOR SQL DIGEST '%s'", status, req.SQLDigest)
+	if err := utils.GetTiDBConnection(c).Exec(stmt).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+type DropBindingRequest struct {
+	SQLDigest string       `json:"sql_digest" form:"sql_digest" binding:"required"`
+	Scope     BindingScope `json:"scope" form:"scope" enums:"global,session"`
+}
+
+// @Summary Drop a SQL binding
+// @Param q query DropBindingRequest true "Query"
+// @Success 200 {object} rest.EmptyResponse
+// @Router /statements/bindings [delete]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) dropBindingHandler(c *gin.Context) {
+	var req DropBindingRequest
+	if err := c.ShouldBindQuery(&req); err != nil || !sqlDigestPattern.MatchString(req.SQLDigest) {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	keyword, err := req.Scope.keyword()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	stmt := fmt.Sprintf("DROP %s BINDING FOR SQL DIGEST '%s'", keyword, req.SQLDigest)
+	if err := utils.GetTiDBConnection(c).Exec(stmt).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testBindingSuite{})
+
+type testBindingSuite struct{}
+
+func (t *testBindingSuite) Test_buildBindSQL(c *C) {
+	sql, err := buildBindSQL("select * from t where a = 1", "use_index(@`sel_1` `test`.`t` `idx_a`)")
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "select /*+ use_index(@`sel_1` `test`.`t` `idx_a`) */ * from t where a = 1")
+
+	sql, err = buildBindSQL("/* comment */ UPDATE t SET a = 1", "use_index(@`upd_1` `test`.`t` )")
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "/* comment */ UPDATE /*+ use_index(@`upd_1` `test`.`t` ) */ t SET a = 1")
+
+	_, err = buildBindSQL("with cte as (select 1) select * from cte", "hint")
+	c.Assert(err, NotNil)
+	_, err = buildBindSQL("selectx * from t", "hint")
+	c.Assert(err, NotNil)
+	_, err = buildBindSQL("select * from t where a in (1, 2, 3, 4(len:4096)", "hint")
+	c.Assert(err, NotNil)
+}
+
+func (t *testBindingSuite) Test_bindingOriginalSQL(c *C) {
+	c.Assert(bindingOriginalSQL(" select * from t where a = 1; "), Equals, "select * from t where a = 1")
+	c.Assert(bindingOriginalSQL("select * from t where a = ? and b = ? [arguments: (1, \"x\")]"), Equals,
+		"select * from t where a = ? and b = ?")
+	c.Assert(bindingOriginalSQL("select * from t where a = ?; [arguments: 1]"), Equals, "select * from t where a = ?")
+}
@@ -0,0 +1,256 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/gtank/cryptopasta"
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+const (
+	defaultRegressionIntervalSecs = 1800
+	minRegressionIntervalSecs     = 60
+	regressionDetectorID          = 1
+)
+
+// RegressionDetectorModel is the configuration and the state of the background plan regression detector.
+// There is at most one row.
+type RegressionDetectorModel struct {
+	ID             uint    `json:"-" gorm:"primary_key"`
+	Enabled        bool    `json:"enabled"`
+	IntervalSecs   int     `json:"interval_secs"`
+	RatioThreshold float64 `json:"ratio_threshold"`
+	MinExecCount   int     `json:"min_exec_count"`
+	// The detector reads the statements summary as this SQL user, which is owned by TiDB Dashboard instead of
+	// any signed in user. The encryption key is placed in the data directory, outside of the local store.
+	SQLUser       string `json:"sql_user" gorm:"size:128"`
+	EncryptedPass string `json:"-" gorm:"type:text"`
+	LastRunAt     int64  `json:"last_run_at"`
+	LastError     string `json:"last_error" gorm:"type:text"`
+}
+
+func (RegressionDetectorModel) TableName() string {
+	return "statement_regression_detector"
+}
+
+type RegressionDetectorConfig struct {
+	Enabled        bool    `json:"enabled"`
+	IntervalSecs   int     `json:"interval_secs" example:"1800"` // Default to 1800, at least 60
+	RatioThreshold float64 `json:"ratio_threshold" example:"2"`  // Default to 2, must be greater than 1
+	MinExecCount   int     `json:"min_exec_count" example:"10"`  // Default to 10
+	// The SQL user to scan the statements summary with, required when enabled. The password is verified and
+	// then saved encrypted.
+	SQLUser  string `json:"sql_user"`
+	Password string `json:"password"`
+}
+
+func (cfg *RegressionDetectorConfig) normalize() {
+	if cfg.IntervalSecs <= 0 {
+		cfg.IntervalSecs = defaultRegressionIntervalSecs
+	}
+	if cfg.IntervalSecs < minRegressionIntervalSecs {
+		cfg.IntervalSecs = minRegressionIntervalSecs
+	}
+	if cfg.RatioThreshold <= 1 {
+		cfg.RatioThreshold = defaultRegressionRatioThreshold
+	}
+	if cfg.MinExecCount <= 0 {
+		cfg.MinExecCount = defaultRegressionMinExecCount
+	}
+}
+
+// This function is thread-safe.
+func (s *Service) getOrCreateEncKey() (*[32]byte, error) {
+	s.encKeyLock.Lock()
+	defer s.encKeyLock.Unlock()
+
+	b, err := ioutil.ReadFile(s.encKeyPath)
+	if err == nil {
+		if len(b) != 32 {
+			return nil, fmt.Errorf("encryption key is broken")
+		}
+		var key [32]byte
+		copy(key[:], b)
+		return &key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := cryptopasta.NewEncryptionKey()
+	if err := ioutil.WriteFile(s.encKeyPath, key[:], 0o400); err != nil { // read only for owner
+		return nil, fmt.Errorf("persist key failed: %v", err)
+	}
+	return key, nil
+}
+
+func (s *Service) encryptPassword(password string) (string, error) {
+	key, err := s.getOrCreateEncKey()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := cryptopasta.Encrypt([]byte(password), key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encrypted), nil
+}
+
+func (s *Service) decryptPassword(encryptedInHex string) (string, error) {
+	key, err := s.getOrCreateEncKey()
+	if err != nil {
+		return "", fmt.Errorf("bad encryption key: %v", err)
+	}
+	encrypted, err := hex.DecodeString(encryptedInHex)
+	if err != nil {
+		return "", fmt.Errorf("bad record: %v", err)
+	}
+	decrypted, err := cryptopasta.Decrypt(encrypted, key)
+	if err != nil {
+		return "", fmt.Errorf("bad record: %v", err)
+	}
+	return string(decrypted), nil
+}
+
+// loadRegressionDetector returns the saved detector, or the default one which is disabled.
+func (s *Service) loadRegressionDetector() (*RegressionDetectorModel, error) {
+	var m RegressionDetectorModel
+	err := s.params.LocalStore.Where("id = ?", regressionDetectorID).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &RegressionDetectorModel{
+			ID:             regressionDetectorID,
+			IntervalSecs:   defaultRegressionIntervalSecs,
+			RatioThreshold: defaultRegressionRatioThreshold,
+			MinExecCount:   defaultRegressionMinExecCount,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// configureRegressionDetector verifies the credential, saves the detector and restarts it.
+func (s *Service) configureRegressionDetector(cfg RegressionDetectorConfig) (*RegressionDetectorModel, error) {
+	cfg.normalize()
+	m := &RegressionDetectorModel{
+		ID:             regressionDetectorID,
+		Enabled:        cfg.Enabled,
+		IntervalSecs:   cfg.IntervalSecs,
+		RatioThreshold: cfg.RatioThreshold,
+		MinExecCount:   cfg.MinExecCount,
+	}
+	if cfg.Enabled {
+		if cfg.SQLUser == "" {
+			return nil, rest.ErrBadRequest.New("The SQL user is required to enable the detector")
+		}
+		db, err := s.params.TiDBClient.OpenSQLConn(cfg.SQLUser, cfg.Password)
+		if err != nil {
+			if errorx.IsOfType(err, tidb.ErrTiDBAuthFailed) {
+				// Not the credential of the session, so the user must not be signed out.
+				return nil, rest.ErrBadRequest.Wrap(err, "Invalid SQL credential")
+			}
+			return nil, err
+		}
+		_ = utils.CloseTiDBConnection(db)
+		if m.EncryptedPass, err = s.encryptPassword(cfg.Password); err != nil {
+			return nil, err
+		}
+		m.SQLUser = cfg.SQLUser
+	}
+
+	s.detectorLock.Lock()
+	defer s.detectorLock.Unlock()
+	if err := s.params.LocalStore.Save(m).Error; err != nil {
+		return nil, err
+	}
+	s.restartRegressionDetector(m)
+	return m, nil
+}
+
+// restartRegressionDetector stops the running detector, and starts a new one if enabled. The caller must hold
+// detectorLock.
+func (s *Service) restartRegressionDetector(m *RegressionDetectorModel) {
+	if s.detectorCancel != nil {
+		s.detectorCancel()
+		s.detectorCancel = nil
+	}
+	if !m.Enabled {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.lifecycleCtx)
+	s.detectorCancel = cancel
+	interval := time.Duration(m.IntervalSecs) * time.Second
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.runRegressionDetector(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Service) runRegressionDetector(ctx context.Context) {
+	err := s.detectWithSavedCredential(ctx)
+	if ctx.Err() != nil {
+		// The detector is reconfigured or stopped, drop the result.
+		return
+	}
+	lastError := ""
+	if err != nil {
+		log.Warn("Failed to detect plan regressions", zap.Error(err))
+		lastError = err.Error()
+	}
+	err = s.params.LocalStore.
+		Model(&RegressionDetectorModel{}).
+		Where("id = ?", regressionDetectorID).
+		Updates(map[string]interface{}{"last_run_at": time.Now().Unix(), "last_error": lastError}).
+		Error
+	if err != nil {
+		log.Warn("Failed to save the plan regression detector status", zap.Error(err))
+	}
+}
+
+func (s *Service) detectWithSavedCredential(ctx context.Context) error {
+	m, err := s.loadRegressionDetector()
+	if err != nil {
+		return err
+	}
+	password, err := s.decryptPassword(m.EncryptedPass)
+	if err != nil {
+		return err
+	}
+	db, err := s.params.TiDBClient.OpenSQLConn(m.SQLUser, password)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = utils.CloseTiDBConnection(db)
+	}()
+	_, err = detectAndSaveRegressions(db.WithContext(ctx), s.params.LocalStore, DetectPlanRegressionsRequest{
+		RatioThreshold: m.RatioThreshold,
+		MinExecCount:   m.MinExecCount,
+	})
+	return err
+}
@@ -51,6 +51,23 @@ func (s *Service) queryStatements(
 	text string,
 	reqFields []string,
 ) (result []Model, err error) {
+	query, err := s.statementsQuery(db, beginTime, endTime, schemas, stmtTypes, text, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	err = query.Find(&result).Error
+	return
+}
+
+// statementsQuery builds the query of the statements, which can be either fetched at once or iterated row by
+// row for exporting.
+func (s *Service) statementsQuery(
+	db *gorm.DB,
+	beginTime, endTime int,
+	schemas, stmtTypes []string,
+	text string,
+	reqFields []string,
+) (*gorm.DB, error) {
 	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
 	if err != nil {
 		return nil, err
@@ -95,9 +112,7 @@ func (s *Service) queryStatements(
 			)
 		}
 	}
-
-	err = query.Find(&result).Error
-	return
+	return query, nil
 }
 
 func (s *Service) queryPlans(
@@ -0,0 +1,206 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	defaultRegressionRatioThreshold = 2.0
+	defaultRegressionMinExecCount   = 10
+)
+
+// PlanRegressionModel is a plan flip of a SQL digest, where the new plan is materially worse than the
+// previous plan.
+type PlanRegressionModel struct {
+	ID            uint   `json:"id" gorm:"primary_key"`
+	SchemaName    string `json:"schema_name" gorm:"index:idx_plan_regression_key"`
+	Digest        string `json:"digest" gorm:"index:idx_plan_regression_key"`
+	DigestText    string `json:"digest_text" gorm:"type:text"`
+	OldPlanDigest string `json:"old_plan_digest" gorm:"index:idx_plan_regression_key"`
+	NewPlanDigest string `json:"new_plan_digest" gorm:"index:idx_plan_regression_key"`
+	FirstSeen     int64  `json:"first_seen" gorm:"index"` // When the new plan is first seen
+	LastSeen      int64  `json:"last_seen"`
+	DetectedAt    int64  `json:"detected_at"`
+
+	OldExecCount        int     `json:"old_exec_count"`
+	NewExecCount        int     `json:"new_exec_count"`
+	OldAvgLatency       float64 `json:"old_avg_latency"`
+	NewAvgLatency       float64 `json:"new_avg_latency"`
+	OldAvgProcessedKeys float64 `json:"old_avg_processed_keys"`
+	NewAvgProcessedKeys float64 `json:"new_avg_processed_keys"`
+	OldAvgMem           float64 `json:"old_avg_mem"`
+	NewAvgMem           float64 `json:"new_avg_mem"`
+
+	// The ratios are new / old, 0 when the old value is 0.
+	LatencyRatio       float64 `json:"latency_ratio"`
+	ProcessedKeysRatio float64 `json:"processed_keys_ratio"`
+	MemRatio           float64 `json:"mem_ratio"`
+	// DegradationRatio is the max of the ratios above.
+	DegradationRatio float64 `json:"degradation_ratio"`
+}
+
+func (PlanRegressionModel) TableName() string {
+	return "statement_plan_regressions"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&PlanRegressionModel{}, &RegressionDetectorModel{})
+}
+
+// planStats is the aggregated statistics of a plan in the statements summary history.
+type planStats struct {
+	SchemaName       string  `gorm:"column:schema_name"`
+	Digest           string  `gorm:"column:digest"`
+	DigestText       string  `gorm:"column:digest_text"`
+	PlanDigest       string  `gorm:"column:plan_digest"`
+	FirstSeen        int64   `gorm:"column:first_seen"`
+	LastSeen         int64   `gorm:"column:last_seen"`
+	ExecCount        int     `gorm:"column:exec_count"`
+	AvgLatency       float64 `gorm:"column:avg_latency"`
+	AvgProcessedKeys float64 `gorm:"column:avg_processed_keys"`
+	AvgMem           float64 `gorm:"column:avg_mem"`
+}
+
+func queryPlanStats(db *gorm.DB) ([]planStats, error) {
+	var stats []planStats
+	err := db.
+		Select(`schema_name, digest, ANY_VALUE(digest_text) AS digest_text, plan_digest,
+			UNIX_TIMESTAMP(MIN(first_seen)) AS first_seen,
+			UNIX_TIMESTAMP(MAX(last_seen)) AS last_seen,
+			SUM(exec_count) AS exec_count,
+			SUM(exec_count * avg_latency) / SUM(exec_count) AS avg_latency,
+			SUM(exec_count * avg_processed_keys) / SUM(exec_count) AS avg_processed_keys,
+			SUM(exec_count * avg_mem) / SUM(exec_count) AS avg_mem`).
+		Table(statementsTable).
+		Where("digest IS NOT NULL AND plan_digest IS NOT NULL AND plan_digest <> ''").
+		Group("schema_name, digest, plan_digest").
+		Find(&stats).Error
+	return stats, err
+}
+
+func ratio(newValue, oldValue float64) float64 {
+	if oldValue <= 0 {
+		return 0
+	}
+	return newValue / oldValue
+}
+
+// detectPlanRegressions compares each plan of a SQL digest with the plan that is seen right before it,
+// and reports the plans whose latency, processed keys or memory is at least ratioThreshold times of the
+// previous plan. Plans executed less than minExecCount times are ignored as the statistics are not stable.
+func detectPlanRegressions(stats []planStats, ratioThreshold float64, minExecCount int) []PlanRegressionModel {
+	type digestKey struct {
+		schemaName string
+		digest     string
+	}
+	plansByDigest := map[digestKey][]planStats{}
+	var keys []digestKey
+	for _, s := range stats {
+		if s.ExecCount < minExecCount {
+			continue
+		}
+		key := digestKey{s.SchemaName, s.Digest}
+		if _, ok := plansByDigest[key]; !ok {
+			keys = append(keys, key)
+		}
+		plansByDigest[key] = append(plansByDigest[key], s)
+	}
+
+	regressions := make([]PlanRegressionModel, 0)
+	for _, key := range keys {
+		plans := plansByDigest[key]
+		sort.SliceStable(plans, func(i, j int) bool {
+			return plans[i].FirstSeen < plans[j].FirstSeen
+		})
+		for i := 1; i < len(plans); i++ {
+			oldPlan, newPlan := plans[i-1], plans[i]
+			r := PlanRegressionModel{
+				SchemaName:          key.schemaName,
+				Digest:              key.digest,
+				DigestText:          newPlan.DigestText,
+				OldPlanDigest:       oldPlan.PlanDigest,
+				NewPlanDigest:       newPlan.PlanDigest,
+				FirstSeen:           newPlan.FirstSeen,
+				LastSeen:            newPlan.LastSeen,
+				OldExecCount:        oldPlan.ExecCount,
+				NewExecCount:        newPlan.ExecCount,
+				OldAvgLatency:       oldPlan.AvgLatency,
+				NewAvgLatency:       newPlan.AvgLatency,
+				OldAvgProcessedKeys: oldPlan.AvgProcessedKeys,
+				NewAvgProcessedKeys: newPlan.AvgProcessedKeys,
+				OldAvgMem:           oldPlan.AvgMem,
+				NewAvgMem:           newPlan.AvgMem,
+				LatencyRatio:        ratio(newPlan.AvgLatency, oldPlan.AvgLatency),
+				ProcessedKeysRatio:  ratio(newPlan.AvgProcessedKeys, oldPlan.AvgProcessedKeys),
+				MemRatio:            ratio(newPlan.AvgMem, oldPlan.AvgMem),
+			}
+			for _, v := range []float64{r.LatencyRatio, r.ProcessedKeysRatio, r.MemRatio} {
+				if v > r.DegradationRatio {
+					r.DegradationRatio = v
+				}
+			}
+			if r.DegradationRatio >= ratioThreshold {
+				regressions = append(regressions, r)
+			}
+		}
+	}
+	return regressions
+}
+
+// saveRegression inserts the regression, or updates the existing one of the same plan flip.
+func saveRegression(db *dbstore.DB, r *PlanRegressionModel) error {
+	var existing PlanRegressionModel
+	err := db.
+		Where("schema_name = ? AND digest = ? AND old_plan_digest = ? AND new_plan_digest = ?",
+			r.SchemaName, r.Digest, r.OldPlanDigest, r.NewPlanDigest).
+		First(&existing).Error
+	switch {
+	case err == nil:
+		r.ID = existing.ID
+		r.DetectedAt = existing.DetectedAt
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		r.DetectedAt = time.Now().Unix()
+	default:
+		return err
+	}
+	return db.Save(r).Error
+}
+
+type DetectPlanRegressionsRequest struct {
+	RatioThreshold float64 `json:"ratio_threshold" example:"2"` // Default to 2, must be greater than 1
+	MinExecCount   int     `json:"min_exec_count" example:"10"` // Default to 10
+}
+
+func (r *DetectPlanRegressionsRequest) normalize() {
+	if r.RatioThreshold <= 1 {
+		r.RatioThreshold = defaultRegressionRatioThreshold
+	}
+	if r.MinExecCount <= 0 {
+		r.MinExecCount = defaultRegressionMinExecCount
+	}
+}
+
+// detectAndSaveRegressions scans the statements summary history through the given connection, which is either
+// the connection of the current session or the one of the background detector, and saves the regressions found.
+func detectAndSaveRegressions(tidbDB *gorm.DB, localStore *dbstore.DB, req DetectPlanRegressionsRequest) ([]PlanRegressionModel, error) {
+	req.normalize()
+	stats, err := queryPlanStats(tidbDB)
+	if err != nil {
+		return nil, err
+	}
+	regressions := detectPlanRegressions(stats, req.RatioThreshold, req.MinExecCount)
+	for i := range regressions {
+		if err := saveRegression(localStore, &regressions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return regressions, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testRegressionSuite{})
+
+type testRegressionSuite struct{}
+
+func (t *testRegressionSuite) Test_detectPlanRegressions(c *C) {
+	stats := []planStats{
+		{SchemaName: "test", Digest: "d1", PlanDigest: "p2", FirstSeen: 200, ExecCount: 100, AvgLatency: 5000, AvgProcessedKeys: 100, AvgMem: 1024},
+		{SchemaName: "test", Digest: "d1", PlanDigest: "p1", FirstSeen: 100, ExecCount: 100, AvgLatency: 1000, AvgProcessedKeys: 100, AvgMem: 1024},
+		// Faster than the previous plan.
+		{SchemaName: "test", Digest: "d1", PlanDigest: "p3", FirstSeen: 300, ExecCount: 100, AvgLatency: 1000, AvgProcessedKeys: 100, AvgMem: 1024},
+		// Executed too few times.
+		{SchemaName: "test", Digest: "d2", PlanDigest: "p4", FirstSeen: 100, ExecCount: 100, AvgLatency: 1000},
+		{SchemaName: "test", Digest: "d2", PlanDigest: "p5", FirstSeen: 200, ExecCount: 1, AvgLatency: 9000},
+		// Same digest in another schema is another SQL.
+		{SchemaName: "other", Digest: "d1", PlanDigest: "p6", FirstSeen: 400, ExecCount: 100, AvgLatency: 9000},
+	}
+	regressions := detectPlanRegressions(stats, 2, 10)
+	c.Assert(regressions, HasLen, 1)
+	r := regressions[0]
+	c.Assert(r.Digest, Equals, "d1")
+	c.Assert(r.OldPlanDigest, Equals, "p1")
+	c.Assert(r.NewPlanDigest, Equals, "p2")
+	c.Assert(r.FirstSeen, Equals, int64(200))
+	c.Assert(r.LatencyRatio, Equals, 5.0)
+	c.Assert(r.ProcessedKeysRatio, Equals, 1.0)
+	c.Assert(r.DegradationRatio, Equals, 5.0)
+}
+
+func (t *testRegressionSuite) Test_RegressionDetectorConfig_normalize(c *C) {
+	cfg := RegressionDetectorConfig{IntervalSecs: 10, RatioThreshold: 0.5}
+	cfg.normalize()
+	c.Assert(cfg.IntervalSecs, Equals, minRegressionIntervalSecs)
+	c.Assert(cfg.RatioThreshold, Equals, defaultRegressionRatioThreshold)
+	c.Assert(cfg.MinExecCount, Equals, defaultRegressionMinExecCount)
+
+	cfg = RegressionDetectorConfig{}
+	cfg.normalize()
+	c.Assert(cfg.IntervalSecs, Equals, defaultRegressionIntervalSecs)
+}
+
+func (t *testRegressionSuite) Test_encryptPassword(c *C) {
+	s := &Service{encKeyPath: filepath.Join(c.MkDir(), "ek.bin")}
+	encrypted, err := s.encryptPassword("secret")
+	c.Assert(err, IsNil)
+	c.Assert(encrypted, Not(Equals), "secret")
+
+	// The key is persisted, so the password can be decrypted by another service.
+	s2 := &Service{encKeyPath: s.encKeyPath}
+	password, err := s2.decryptPassword(encrypted)
+	c.Assert(err, IsNil)
+	c.Assert(password, Equals, "secret")
+
+	_, err = s2.decryptPassword("00" + encrypted)
+	c.Assert(err, NotNil)
+}
@@ -3,9 +3,12 @@
 package statement
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,9 +18,14 @@ import (
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
+	"github.com/pingcap/tidb-dashboard/util/exportutil"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
 )
 
 var (
@@ -29,14 +37,52 @@ type ServiceParams struct {
 	fx.In
 	TiDBClient *tidb.Client
 	SysSchema  *commonUtils.SysSchema
+	LocalStore *dbstore.DB
+	Config     *config.Config
 }
 
 type Service struct {
-	params ServiceParams
+	params       ServiceParams
+	lifecycleCtx context.Context
+	fSwap        *fileswap.Handler
+
+	encKeyPath     string
+	encKeyLock     sync.Mutex
+	wg             sync.WaitGroup
+	detectorLock   sync.Mutex
+	detectorCancel context.CancelFunc
 }
 
-func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+func newService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	s := &Service{
+		params:     p,
+		fSwap:      fileswap.New(),
+		encKeyPath: path.Join(p.Config.DataDir, "stmt_regression_ek.bin"),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.lifecycleCtx = ctx
+			m, err := s.loadRegressionDetector()
+			if err != nil {
+				return err
+			}
+			s.detectorLock.Lock()
+			defer s.detectorLock.Unlock()
+			s.restartRegressionDetector(m)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.detectorLock.Lock()
+			s.restartRegressionDetector(&RegressionDetectorModel{Enabled: false})
+			s.detectorLock.Unlock()
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s, nil
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -53,7 +99,19 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 			endpoint.GET("/stmt_types", s.stmtTypesHandler)
 			endpoint.GET("/list", s.listHandler)
 			endpoint.GET("/plans", s.plansHandler)
+			endpoint.GET("/timeseries", s.timeSeriesHandler)
 			endpoint.GET("/plan/detail", s.planDetailHandler)
+			endpoint.GET("/plan/tree", s.planTreeHandler)
+			endpoint.GET("/plan/export", s.planExportHandler)
+			endpoint.GET("/plan/diff", s.planDiffHandler)
+			endpoint.GET("/bindings", s.bindingsHandler)
+			endpoint.POST("/bindings", auth.MWRequireWritePriv(), s.createBindingHandler)
+			endpoint.PUT("/bindings/status", auth.MWRequireWritePriv(), s.setBindingStatusHandler)
+			endpoint.DELETE("/bindings", auth.MWRequireWritePriv(), s.dropBindingHandler)
+			endpoint.GET("/plan_regressions", s.planRegressionsHandler)
+			endpoint.POST("/plan_regressions/detect", auth.MWRequireWritePriv(), s.detectPlanRegressionsHandler)
+			endpoint.GET("/plan_regressions/detector", s.regressionDetectorHandler)
+			endpoint.PUT("/plan_regressions/detector", auth.MWRequireWritePriv(), s.configureRegressionDetectorHandler)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
@@ -156,6 +214,7 @@ type GetStatementsRequest struct {
 
 // @Summary Get a list of statements
 // @Param q query GetStatementsRequest true "Query"
+// @Param opts query BindingsOptions false "Options"
 // @Success 200 {array} Model
 // @Router /statements/list [get]
 // @Security JwtAuth
@@ -163,10 +222,15 @@ type GetStatementsRequest struct {
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) listHandler(c *gin.Context) {
 	var req GetStatementsRequest
+	var opts BindingsOptions
 	if err := c.ShouldBindQuery(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	fields := []string{}
 	if strings.TrimSpace(req.Fields) != "" {
@@ -183,6 +247,9 @@ func (s *Service) listHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	if opts.WithBindings {
+		markBound(db, overviews)
+	}
 	c.JSON(http.StatusOK, overviews)
 }
 
@@ -195,22 +262,31 @@ type GetPlansRequest struct {
 
 // @Summary Get execution plans of a statement
 // @Param q query GetPlansRequest true "Query"
+// @Param opts query BindingsOptions false "Options"
 // @Success 200 {array} Model
 // @Router /statements/plans [get]
 // @Security JwtAuth
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) plansHandler(c *gin.Context) {
 	var req GetPlansRequest
+	var opts BindingsOptions
 	if err := c.ShouldBindQuery(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
+	if err := c.ShouldBindQuery(&opts); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
 	db := utils.GetTiDBConnection(c)
 	plans, err := s.queryPlans(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
+	if opts.WithBindings {
+		markBound(db, plans)
+	}
 	c.JSON(http.StatusOK, plans)
 }
 
@@ -240,26 +316,252 @@ func (s *Service) planDetailHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+type GetPlanTreeRequest struct {
+	GetPlanDetailRequest
+	Top             int     `json:"top" form:"top"` // Number of hot operators to rank
+	QErrorThreshold float64 `json:"q_error_threshold" form:"q_error_threshold"`
+}
+
+// @Summary Get the structured operator tree of a statement's execution plan, with the time and estimation analysis
+// @Param q query GetPlanTreeRequest true "Query"
+// @Success 200 {object} tidbplan.Plan
+// @Router /statements/plan/tree [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) planTreeHandler(c *gin.Context) {
+	var req GetPlanTreeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, req.Plans)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan, err := tidbplan.Parse(result.AggPlan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	plan.Analyze(req.Top)
+	plan.CheckEstimation(req.QErrorThreshold)
+	c.JSON(http.StatusOK, plan)
+}
+
+type ExportPlanRequest struct {
+	GetPlanTreeRequest
+	utils.PlanExportOptions
+}
+
+// @Summary Export a statement's execution plan as JSON, DOT, Mermaid, the text tree or Markdown
+// @Param q query ExportPlanRequest true "Query"
+// @Produce json,text/vnd.graphviz,text/markdown,plain
+// @Success 200 {string} string
+// @Router /statements/plan/export [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) planExportHandler(c *gin.Context) {
+	var req ExportPlanRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, req.Plans)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan, err := tidbplan.Parse(result.AggPlan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	plan.Analyze(req.Top)
+	plan.CheckEstimation(req.QErrorThreshold)
+	utils.WritePlanExport(c, plan, req.Format)
+}
+
+type GetPlanDiffRequest struct {
+	GetPlansRequest
+	OldPlan string `json:"old_plan" form:"old_plan" binding:"required"` // Plan digest
+	NewPlan string `json:"new_plan" form:"new_plan" binding:"required"` // Plan digest
+}
+
+type PlanDiffResponse struct {
+	tidbplan.PlanDiff
+	OldAvgLatency int `json:"old_avg_latency"`
+	NewAvgLatency int `json:"new_avg_latency"`
+}
+
+// @Summary Compare two execution plans of a statement
+// @Description Align the operators of the two plans, and report the changed operators, access paths, tasks, join order, as well as the row and latency deltas
+// @Param q query GetPlanDiffRequest true "Query"
+// @Success 200 {object} PlanDiffResponse
+// @Router /statements/plan/diff [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) planDiffHandler(c *gin.Context) {
+	var req GetPlanDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	details := make([]Model, 2)
+	plans := make([]*tidbplan.Plan, 2)
+	for i, planDigest := range []string{req.OldPlan, req.NewPlan} {
+		result, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, []string{planDigest})
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		plan, err := tidbplan.Parse(result.AggPlan)
+		if err != nil {
+			_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+			return
+		}
+		details[i] = result
+		plans[i] = plan
+	}
+	c.JSON(http.StatusOK, PlanDiffResponse{
+		PlanDiff:      *tidbplan.Diff(plans[0], plans[1]),
+		OldAvgLatency: details[0].AggAvgLatency,
+		NewAvgLatency: details[1].AggAvgLatency,
+	})
+}
+
+type GetPlanRegressionsRequest struct {
+	BeginTime int    `json:"begin_time" form:"begin_time"` // Filter by the first seen time of the new plan
+	EndTime   int    `json:"end_time" form:"end_time"`
+	Digest    string `json:"digest" form:"digest"`
+}
+
+// @Summary Get the saved plan regressions
+// @Param q query GetPlanRegressionsRequest true "Query"
+// @Success 200 {array} PlanRegressionModel
+// @Router /statements/plan_regressions [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) planRegressionsHandler(c *gin.Context) {
+	var req GetPlanRegressionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	query := s.params.LocalStore.Order("first_seen DESC")
+	if req.BeginTime != 0 && req.EndTime != 0 {
+		query = query.Where("first_seen BETWEEN ? AND ?", req.BeginTime, req.EndTime)
+	}
+	if req.Digest != "" {
+		query = query.Where("digest = ?", req.Digest)
+	}
+	regressions := make([]PlanRegressionModel, 0)
+	if err := query.Find(&regressions).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, regressions)
+}
+
+// @Summary Detect plan regressions
+// @Description Scans the statements summary history as the current user, and saves the regressions found, which are also returned
+// @Param request body DetectPlanRegressionsRequest true "Request body"
+// @Success 200 {array} PlanRegressionModel
+// @Router /statements/plan_regressions/detect [post]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) detectPlanRegressionsHandler(c *gin.Context) {
+	var req DetectPlanRegressionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	regressions, err := detectAndSaveRegressions(utils.GetTiDBConnection(c), s.params.LocalStore, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, regressions)
+}
+
+// @Summary Get the configuration and the status of the background plan regression detector
+// @Success 200 {object} RegressionDetectorModel
+// @Router /statements/plan_regressions/detector [get]
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) regressionDetectorHandler(c *gin.Context) {
+	m, err := s.loadRegressionDetector()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// @Summary Enable or disable the background plan regression detector
+// @Description The detector periodically scans the statements summary history as the given SQL user, and saves the regressions found
+// @Param request body RegressionDetectorConfig true "Request body"
+// @Success 200 {object} RegressionDetectorModel
+// @Router /statements/plan_regressions/detector [put]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) configureRegressionDetectorHandler(c *gin.Context) {
+	var req RegressionDetectorConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m, err := s.configureRegressionDetector(req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+type ExportStatementsRequest struct {
+	GetStatementsRequest
+	exportutil.Options
+}
+
 // @Router /statements/download/token [post]
 // @Summary Generate a download token for exported statements
+// @Description Statements are streamed into an encrypted temporary file in CSV, JSON Lines or Parquet format
 // @Produce plain
-// @Param request body GetStatementsRequest true "Request body"
+// @Param request body ExportStatementsRequest true "Request body"
 // @Success 200 {string} string "xxx"
 // @Security JwtAuth
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadTokenHandler(c *gin.Context) {
-	var req GetStatementsRequest
+	var req ExportStatementsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
 	db := utils.GetTiDBConnection(c)
-	fields := []string{}
+	fields := []string{"*"}
 	if strings.TrimSpace(req.Fields) != "" {
 		fields = strings.Split(req.Fields, ",")
 	}
-	overviews, err := s.queryStatements(
+	query, err := s.statementsQuery(
 		db,
 		req.BeginTime, req.EndTime,
 		req.Schemas,
@@ -270,43 +572,37 @@ func (s *Service) downloadTokenHandler(c *gin.Context) {
 		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
 		return
 	}
-	if len(overviews) == 0 {
-		_ = c.Error(ErrNoData.NewWithNoMessage())
-		return
-	}
-
-	// interface{} tricky
-	rawData := make([]interface{}, len(overviews))
-	for i, v := range overviews {
-		rawData[i] = v
-	}
 
-	// convert data
-	csvData := utils.GenerateCSVFromRaw(rawData, fields, []string{"first_seen", "last_seen"})
-
-	// generate temp file that persist encrypted data
 	timeLayout := "01021504"
 	beginTime := time.Unix(int64(req.BeginTime), 0).Format(timeLayout)
 	endTime := time.Unix(int64(req.EndTime), 0).Format(timeLayout)
-	token, err := utils.ExportCSV(csvData,
-		fmt.Sprintf("statements_%s_%s_*.csv", beginTime, endTime),
-		"statements/download")
+	token, rows, err := utils.ExportQuery(s.fSwap, &utils.ExportRequest{
+		Query:      query,
+		Row:        &Model{},
+		Fields:     fields,
+		TimeFields: []string{"first_seen", "last_seen"},
+		Options:    req.Options,
+		FileName:   fmt.Sprintf("statements_%s_%s", beginTime, endTime),
+	})
 	if err != nil {
 		_ = c.Error(err)
 		return
 	}
+	if rows == 0 {
+		_ = c.Error(ErrNoData.NewWithNoMessage())
+		return
+	}
 	c.String(http.StatusOK, token)
 }
 
 // @Router /statements/download [get]
 // @Summary Download statements
-// @Produce text/csv
+// @Produce octet-stream
 // @Param token query string true "download token"
 // @Failure 400 {object} rest.ErrorResponse
 // @Failure 401 {object} rest.ErrorResponse
 func (s *Service) downloadHandler(c *gin.Context) {
-	token := c.Query("token")
-	utils.DownloadByToken(token, "statements/download", c)
+	s.fSwap.HandleDownloadRequest(c)
 }
 
 // @Summary Query table columns
@@ -0,0 +1,171 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+)
+
+type GetTimeSeriesRequest struct {
+	GetPlansRequest
+}
+
+// TimeSeriesPlan is the statistics of a plan in a summary window.
+type TimeSeriesPlan struct {
+	PlanDigest string  `json:"plan_digest"`
+	ExecCount  int     `json:"exec_count"`
+	AvgLatency float64 `json:"avg_latency"`
+}
+
+// TimeSeriesPoint is the statistics of a summary window, aggregated over all instances and plans. Latencies are
+// in nanoseconds.
+type TimeSeriesPoint struct {
+	BeginTime        int              `json:"begin_time"`
+	EndTime          int              `json:"end_time"`
+	ExecCount        int              `json:"exec_count"`
+	AvgLatency       float64          `json:"avg_latency"`
+	MaxLatency       int              `json:"max_latency"`
+	AvgProcessedKeys float64          `json:"avg_processed_keys"`
+	AvgMem           float64          `json:"avg_mem"`
+	PlanDigest       string           `json:"plan_digest"` // The plan executed most in the window
+	Plans            []TimeSeriesPlan `json:"plans"`       // Sorted by the execution count
+}
+
+// PlanChange marks the window where the most executed plan changes.
+type PlanChange struct {
+	Time          int    `json:"time"` // Begin time of the window
+	OldPlanDigest string `json:"old_plan_digest"`
+	NewPlanDigest string `json:"new_plan_digest"`
+}
+
+type TimeSeriesResponse struct {
+	Points      []TimeSeriesPoint `json:"points"`
+	PlanChanges []PlanChange      `json:"plan_changes"`
+}
+
+type timeSeriesRow struct {
+	BeginTime        int     `gorm:"column:begin_time"`
+	EndTime          int     `gorm:"column:end_time"`
+	PlanDigest       string  `gorm:"column:plan_digest"`
+	ExecCount        int     `gorm:"column:exec_count"`
+	AvgLatency       float64 `gorm:"column:avg_latency"`
+	MaxLatency       int     `gorm:"column:max_latency"`
+	AvgProcessedKeys float64 `gorm:"column:avg_processed_keys"`
+	AvgMem           float64 `gorm:"column:avg_mem"`
+}
+
+func queryTimeSeries(db *gorm.DB, beginTime, endTime int, schemaName, digest string) ([]timeSeriesRow, error) {
+	var rows []timeSeriesRow
+	query := db.
+		Select(`FLOOR(UNIX_TIMESTAMP(summary_begin_time)) AS begin_time,
+			FLOOR(UNIX_TIMESTAMP(summary_end_time)) AS end_time,
+			plan_digest,
+			SUM(exec_count) AS exec_count,
+			SUM(exec_count * avg_latency) / SUM(exec_count) AS avg_latency,
+			MAX(max_latency) AS max_latency,
+			SUM(exec_count * avg_processed_keys) / SUM(exec_count) AS avg_processed_keys,
+			SUM(exec_count * avg_mem) / SUM(exec_count) AS avg_mem`).
+		Table(statementsTable).
+		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
+		Where("digest = ?", digest).
+		Group("summary_begin_time, summary_end_time, plan_digest").
+		Order("begin_time")
+	if schemaName != "" {
+		query = query.Where("schema_name = ?", schemaName)
+	}
+	err := query.Find(&rows).Error
+	return rows, err
+}
+
+// buildTimeSeries merges the plans of the same window into a point, and marks the windows where the most
+// executed plan differs from the previous window.
+func buildTimeSeries(rows []timeSeriesRow) TimeSeriesResponse {
+	resp := TimeSeriesResponse{
+		Points:      make([]TimeSeriesPoint, 0),
+		PlanChanges: make([]PlanChange, 0),
+	}
+	type sums struct {
+		latency       float64
+		processedKeys float64
+		mem           float64
+	}
+	var allSums []sums
+	index := make(map[int]int)
+	for _, row := range rows {
+		i, ok := index[row.BeginTime]
+		if !ok {
+			i = len(resp.Points)
+			index[row.BeginTime] = i
+			resp.Points = append(resp.Points, TimeSeriesPoint{BeginTime: row.BeginTime, EndTime: row.EndTime})
+			allSums = append(allSums, sums{})
+		}
+		p := &resp.Points[i]
+		p.ExecCount += row.ExecCount
+		if row.MaxLatency > p.MaxLatency {
+			p.MaxLatency = row.MaxLatency
+		}
+		allSums[i].latency += row.AvgLatency * float64(row.ExecCount)
+		allSums[i].processedKeys += row.AvgProcessedKeys * float64(row.ExecCount)
+		allSums[i].mem += row.AvgMem * float64(row.ExecCount)
+		p.Plans = append(p.Plans, TimeSeriesPlan{
+			PlanDigest: row.PlanDigest,
+			ExecCount:  row.ExecCount,
+			AvgLatency: row.AvgLatency,
+		})
+	}
+	sort.SliceStable(resp.Points, func(i, j int) bool {
+		return resp.Points[i].BeginTime < resp.Points[j].BeginTime
+	})
+
+	for i := range resp.Points {
+		p := &resp.Points[i]
+		s := allSums[index[p.BeginTime]]
+		if p.ExecCount > 0 {
+			n := float64(p.ExecCount)
+			p.AvgLatency = s.latency / n
+			p.AvgProcessedKeys = s.processedKeys / n
+			p.AvgMem = s.mem / n
+		}
+		sort.SliceStable(p.Plans, func(a, b int) bool {
+			return p.Plans[a].ExecCount > p.Plans[b].ExecCount
+		})
+		p.PlanDigest = p.Plans[0].PlanDigest
+		if i > 0 && resp.Points[i-1].PlanDigest != p.PlanDigest {
+			resp.PlanChanges = append(resp.PlanChanges, PlanChange{
+				Time:          p.BeginTime,
+				OldPlanDigest: resp.Points[i-1].PlanDigest,
+				NewPlanDigest: p.PlanDigest,
+			})
+		}
+	}
+	return resp
+}
+
+// @Summary Get the statistics of a statement in each summary window, with the windows where the plan changes
+// @Param q query GetTimeSeriesRequest true "Query"
+// @Success 200 {object} TimeSeriesResponse
+// @Router /statements/timeseries [get]
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+func (s *Service) timeSeriesHandler(c *gin.Context) {
+	var req GetTimeSeriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil || req.Digest == "" {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	rows, err := queryTimeSeries(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, buildTimeSeries(rows))
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statement
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTimeSeriesSuite{})
+
+type testTimeSeriesSuite struct{}
+
+func (t *testTimeSeriesSuite) Test_buildTimeSeries(c *C) {
+	rows := []timeSeriesRow{
+		{BeginTime: 1800, EndTime: 3600, PlanDigest: "p1", ExecCount: 10, AvgLatency: 100, MaxLatency: 200, AvgProcessedKeys: 10, AvgMem: 1024},
+		{BeginTime: 0, EndTime: 1800, PlanDigest: "p1", ExecCount: 30, AvgLatency: 100, MaxLatency: 150, AvgProcessedKeys: 10, AvgMem: 1024},
+		{BeginTime: 1800, EndTime: 3600, PlanDigest: "p2", ExecCount: 30, AvgLatency: 500, MaxLatency: 900, AvgProcessedKeys: 50, AvgMem: 2048},
+		{BeginTime: 3600, EndTime: 5400, PlanDigest: "p2", ExecCount: 20, AvgLatency: 600, MaxLatency: 800, AvgProcessedKeys: 60, AvgMem: 2048},
+	}
+	resp := buildTimeSeries(rows)
+	c.Assert(resp.Points, HasLen, 3)
+
+	p := resp.Points[1]
+	c.Assert(p.BeginTime, Equals, 1800)
+	c.Assert(p.ExecCount, Equals, 40)
+	c.Assert(p.AvgLatency, Equals, 400.0)
+	c.Assert(p.MaxLatency, Equals, 900)
+	c.Assert(p.AvgProcessedKeys, Equals, 40.0)
+	c.Assert(p.AvgMem, Equals, 1792.0)
+	c.Assert(p.PlanDigest, Equals, "p2")
+	c.Assert(p.Plans, HasLen, 2)
+	c.Assert(p.Plans[0].PlanDigest, Equals, "p2")
+
+	c.Assert(resp.Points[0].PlanDigest, Equals, "p1")
+	c.Assert(resp.PlanChanges, DeepEquals, []PlanChange{{Time: 1800, OldPlanDigest: "p1", NewPlanDigest: "p2"}})
+
+	empty := buildTimeSeries(nil)
+	c.Assert(empty.Points, HasLen, 0)
+	c.Assert(empty.PlanChanges, HasLen, 0)
+}
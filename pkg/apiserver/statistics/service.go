@@ -0,0 +1,120 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package statistics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/VividCortex/mysqlerr"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbstats"
+)
+
+var snapshotPattern = regexp.MustCompile(`^\d{14}$`)
+
+type ServiceParams struct {
+	fx.In
+	TiDBClient *tidb.Client
+}
+
+type Service struct {
+	params ServiceParams
+}
+
+func newService(p ServiceParams) *Service {
+	return &Service{params: p}
+}
+
+func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/statistics")
+	endpoint.Use(auth.MWAuthRequired())
+	endpoint.Use(utils.MWConnectTiDB(s.params.TiDBClient))
+	endpoint.GET("/table", s.getTableStats)
+}
+
+type GetTableStatsRequest struct {
+	DB    string `json:"db" form:"db" binding:"required"`
+	Table string `json:"table" form:"table" binding:"required"`
+	// Dump the statistics at a history point, in the format of yyyyMMddHHmmss.
+	Snapshot string `json:"snapshot" form:"snapshot"`
+}
+
+// @ID statisticsGetTable
+// @Summary Get the decoded statistics of a table
+// @Description Histograms, TopN and CMSketch summaries of each column and index are decoded from the stats dump. The current user must be able to access the table.
+// @Param q query GetTableStatsRequest true "Query"
+// @Success 200 {object} tidbstats.TableStats
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /statistics/table [get]
+func (s *Service) getTableStats(c *gin.Context) {
+	var req GetTableStatsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	path := fmt.Sprintf("/stats/dump/%s/%s", url.PathEscape(req.DB), url.PathEscape(req.Table))
+	if req.Snapshot != "" {
+		if !snapshotPattern.MatchString(req.Snapshot) {
+			_ = c.Error(rest.ErrBadRequest.New("Snapshot must be in the format of yyyyMMddHHmmss"))
+			return
+		}
+		path += "/" + req.Snapshot
+	}
+	// The stats dump contains the column values, while the status API is not protected by the SQL privileges.
+	if err := checkTableAccess(utils.GetTiDBConnection(c), req.DB, req.Table); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	data, err := s.params.TiDBClient.SendGetRequest(path)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	stats, err := tidbstats.ParseDump(data)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// checkTableAccess checks whether the table can be accessed by the user of the connection.
+func checkTableAccess(db *gorm.DB, dbName, table string) error {
+	rows, err := db.Raw(fmt.Sprintf("SHOW CREATE TABLE %s.%s", quoteIdentifier(dbName), quoteIdentifier(table))).Rows()
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) {
+			switch mysqlErr.Number {
+			case mysqlerr.ER_TABLEACCESS_DENIED_ERROR, mysqlerr.ER_DBACCESS_DENIED_ERROR:
+				return rest.ErrForbidden.Wrap(err, "No privilege to access table %s.%s", dbName, table)
+			case mysqlerr.ER_NO_SUCH_TABLE, mysqlerr.ER_BAD_DB_ERROR:
+				return rest.ErrNotFound.Wrap(err, "Table %s.%s is not found", dbName, table)
+			}
+		}
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package topsql
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+const statementsTable = "INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY"
+
+type EnrichedSummaryResponse struct {
+	Data []EnrichedSummaryItem `json:"data"`
+}
+
+type EnrichedSummaryItem struct {
+	SQLDigest string             `json:"sql_digest"`
+	SQLText   string             `json:"sql_text"`
+	IsOther   bool               `json:"is_other"`
+	Plans     []EnrichedPlanItem `json:"plans"`
+}
+
+type EnrichedPlanItem struct {
+	SummaryPlanItem
+	// Statement is the aggregation of the statements summary in the same time range, which is nil when the plan
+	// is evicted from the statements summary.
+	Statement *PlanStatementStats `json:"statement"`
+	Plan      *tidbplan.Plan      `json:"plan,omitempty"`
+}
+
+type PlanStatementStats struct {
+	SchemaName string  `json:"schema_name" gorm:"column:schema_name"`
+	ExecCount  int     `json:"exec_count" gorm:"column:exec_count"`
+	AvgLatency float64 `json:"avg_latency" gorm:"column:avg_latency"` // In nanoseconds
+	MaxLatency int64   `json:"max_latency" gorm:"column:max_latency"` // In nanoseconds
+	AvgMem     float64 `json:"avg_mem" gorm:"column:avg_mem"`
+	MaxMem     int64   `json:"max_mem" gorm:"column:max_mem"`
+}
+
+type planStatementRow struct {
+	PlanStatementStats
+	Digest     string `gorm:"column:digest"`
+	PlanDigest string `gorm:"column:plan_digest"`
+	Plan       string `gorm:"column:plan"`
+}
+
+type planKey struct {
+	digest     string
+	planDigest string
+}
+
+// queryPlanStatements aggregates the statements summary of the digests by plans. Summary windows overlapping
+// with [beginTime, endTime] are included, as Top SQL windows are not aligned with the summary windows.
+func queryPlanStatements(db *gorm.DB, digests []string, beginTime, endTime int64, tidbInstance string) (map[planKey]planStatementRow, error) {
+	result := make(map[planKey]planStatementRow)
+	if len(digests) == 0 {
+		return result, nil
+	}
+	query := db.
+		Select(`digest, plan_digest, ANY_VALUE(schema_name) AS schema_name,
+			SUM(exec_count) AS exec_count,
+			SUM(exec_count * avg_latency) / SUM(exec_count) AS avg_latency,
+			MAX(max_latency) AS max_latency,
+			SUM(exec_count * avg_mem) / SUM(exec_count) AS avg_mem,
+			MAX(max_mem) AS max_mem,
+			ANY_VALUE(plan) AS plan`).
+		Table(statementsTable).
+		Where("digest IN (?)", digests).
+		Group("digest, plan_digest")
+	if beginTime > 0 {
+		query = query.Where("summary_end_time >= FROM_UNIXTIME(?)", beginTime)
+	}
+	if endTime > 0 {
+		query = query.Where("summary_begin_time <= FROM_UNIXTIME(?)", endTime)
+	}
+	if tidbInstance != "" {
+		query = query.Where("instance = ?", tidbInstance)
+	}
+	var rows []planStatementRow
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[planKey{row.Digest, row.PlanDigest}] = row
+	}
+	return result, nil
+}
+
+// parsePlan parses the plan of the statements summary, or the plan text of Top SQL when the former is not
+// available. Failures are ignored so that the CPU time series can be still displayed.
+func parsePlan(planTexts ...string) *tidbplan.Plan {
+	for _, text := range planTexts {
+		if text == "" {
+			continue
+		}
+		// Encoded plans are decoded by Parse.
+		if plan, err := tidbplan.Parse(text); err == nil {
+			return plan
+		}
+	}
+	return nil
+}
+
+func enrichSummary(items []SummaryItem, statements map[planKey]planStatementRow) []EnrichedSummaryItem {
+	result := make([]EnrichedSummaryItem, 0, len(items))
+	for _, item := range items {
+		enriched := EnrichedSummaryItem{
+			SQLDigest: item.SQLDigest,
+			SQLText:   item.SQLText,
+			IsOther:   item.IsOther,
+			Plans:     make([]EnrichedPlanItem, 0, len(item.Plans)),
+		}
+		for _, p := range item.Plans {
+			plan := EnrichedPlanItem{SummaryPlanItem: p}
+			stmtPlan := ""
+			if row, ok := statements[planKey{item.SQLDigest, p.PlanDigest}]; ok {
+				stats := row.PlanStatementStats
+				plan.Statement = &stats
+				stmtPlan = row.Plan
+			}
+			plan.Plan = parsePlan(stmtPlan, p.PlanText)
+			enriched.Plans = append(enriched.Plans, plan)
+		}
+		result = append(result, enriched)
+	}
+	return result
+}
+
+func parseUnixSeconds(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+// @Summary Get summaries with the latency, memory and plan trees from the statements summary
+// @Description Top SQL only records the CPU time and the plan text. This API joins the digests and plan digests with the statements summary in the same time range.
+// @Router /topsql/summary/enriched [get]
+// @Security JwtAuth
+// @Param q query GetSummaryRequest true "Query"
+// @Success 200 {object} EnrichedSummaryResponse "ok"
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+func (s *Service) GetEnrichedSummary(c *gin.Context) {
+	var req GetSummaryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	query := url.Values{}
+	for k, v := range map[string]string{
+		"instance":      req.Instance,
+		"instance_type": req.InstanceType,
+		"start":         req.Start,
+		"end":           req.End,
+		"top":           req.Top,
+		"window":        req.Window,
+	} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	var summary SummaryResponse
+	if err := s.params.NgmProxy.SendGetRequest(c.Request.Context(), "/topsql/v1/summary", query, &summary); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	digests := make([]string, 0, len(summary.Data))
+	for _, item := range summary.Data {
+		if !item.IsOther && item.SQLDigest != "" {
+			digests = append(digests, item.SQLDigest)
+		}
+	}
+	tidbInstance := ""
+	if req.InstanceType == "tidb" {
+		tidbInstance = req.Instance
+	}
+	statements, err := queryPlanStatements(utils.GetTiDBConnection(c), digests, parseUnixSeconds(req.Start), parseUnixSeconds(req.End), tidbInstance)
+	if err != nil {
+		// The CPU time series is still useful without the statements summary.
+		log.Warn("Failed to query statements summary for Top SQL", zap.Error(err))
+		statements = map[planKey]planStatementRow{}
+	}
+	c.JSON(http.StatusOK, EnrichedSummaryResponse{Data: enrichSummary(summary.Data, statements)})
+}
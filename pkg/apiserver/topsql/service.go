@@ -46,6 +46,7 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 		endpoint.POST("/config", s.UpdateConfig)
 		endpoint.GET("/instances", s.params.NgmProxy.Route("/topsql/v1/instances"))
 		endpoint.GET("/summary", s.params.NgmProxy.Route("/topsql/v1/summary"))
+		endpoint.GET("/summary/enriched", s.GetEnrichedSummary)
 	}
 }
 
@@ -75,12 +76,12 @@ func (s *Service) GetInstance(c *gin.Context) {
 }
 
 type GetSummaryRequest struct {
-	Instance     string `json:"instance"`
-	InstanceType string `json:"instance_type"`
-	Start        string `json:"start"`
-	End          string `json:"end"`
-	Top          string `json:"top"`
-	Window       string `json:"window"`
+	Instance     string `json:"instance" form:"instance"`
+	InstanceType string `json:"instance_type" form:"instance_type"`
+	Start        string `json:"start" form:"start"`
+	End          string `json:"end" form:"end"`
+	Top          string `json:"top" form:"top"`
+	Window       string `json:"window" form:"window"`
 }
 
 type SummaryResponse struct {
@@ -3,6 +3,7 @@
 package code
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"time"
@@ -67,6 +68,8 @@ func (s *Service) NewSessionFromSharingCode(codeInHex string) *utils.SessionUser
 	}
 
 	shared.Session.SharedSessionExpireAt = shared.ExpireAt
+	sharingID := sha256.Sum256(encrypted)
+	shared.Session.SharingID = hex.EncodeToString(sharingID[:])
 	shared.Session.DisplayName = fmt.Sprintf("Shared from %s", shared.Session.DisplayName)
 	shared.Session.IsShareable = false
 	if shared.RevokeWritePriv {
@@ -3,6 +3,7 @@
 package utils
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,8 +25,9 @@ type SessionUser struct {
 	TiDBUsername string
 	TiDBPassword string
 
-	// This field only exists for CodeAuth.
+	// These fields only exist for CodeAuth. SharingID is the hash of the sharing code.
 	SharedSessionExpireAt time.Time `msgpack:"-" json:",omitempty"`
+	SharingID             string    `msgpack:"-" json:",omitempty"`
 
 	// This field only exists for SSOAuth
 	OIDCIDToken string `json:",omitempty"`
@@ -38,6 +40,15 @@ type SessionUser struct {
 	IsWriteable bool
 }
 
+// Identity identifies the user across sessions, for keeping data per user. Unlike DisplayName, sessions
+// shared by different sharing codes have different identities.
+func (u *SessionUser) Identity() string {
+	if u.SharingID != "" {
+		return "shared:" + u.SharingID
+	}
+	return fmt.Sprintf("%d:%s", u.AuthFrom, u.DisplayName)
+}
+
 const (
 	// The key that attached the SessionUser in the gin Context.
 	SessionUserKey = "user"
@@ -3,141 +3,81 @@
 package utils
 
 import (
-	"encoding/base64"
-	"encoding/csv"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"reflect"
-	"strings"
 	"time"
 
-	"github.com/Xeoncross/go-aesctr-with-hmac"
-	"github.com/gin-gonic/gin"
-	"github.com/gtank/cryptopasta"
-	"github.com/oleiade/reflections"
-	"github.com/pingcap/log"
-	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
 
+	"github.com/pingcap/tidb-dashboard/util/exportutil"
 	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/rest/fileswap"
 )
 
-// TODO: Better to be a streaming interface.
-func GenerateCSVFromRaw(rawData []interface{}, fields []string, timeFields []string) (data [][]string) {
-	timeFieldsMap := make(map[string]struct{})
-	for _, f := range timeFields {
-		timeFieldsMap[f] = struct{}{}
-	}
-
-	fieldsMap := make(map[string]string)
-	t := reflect.TypeOf(rawData[0])
-	fieldsNum := t.NumField()
-	allFields := make([]string, fieldsNum)
-	for i := 0; i < fieldsNum; i++ {
-		field := t.Field(i)
-		allFields[i] = strings.ToLower(field.Tag.Get("json"))
-		fieldsMap[allFields[i]] = field.Name
-	}
-	if len(fields) == 1 && fields[0] == "*" {
-		fields = allFields
-	}
+const exportDownloadExpire = time.Minute * 5
 
-	data = [][]string{fields}
-	timeLayout := "01-02 15:04:05"
-	for _, overview := range rawData {
-		row := []string{}
-		for _, field := range fields {
-			fieldName := fieldsMap[field]
-			s, _ := reflections.GetField(overview, fieldName)
-			var val string
-			switch t := s.(type) {
-			case int:
-				if _, ok := timeFieldsMap[field]; ok {
-					val = time.Unix(int64(t), 0).Format(timeLayout)
-				} else {
-					val = fmt.Sprintf("%d", t)
-				}
-			case uint:
-				val = fmt.Sprintf("%d", t)
-			case float64:
-				val = fmt.Sprintf("%f", t)
-			default:
-				val = fmt.Sprintf("%s", t)
-			}
-			row = append(row, val)
-		}
-		data = append(data, row)
-	}
-	return
+type ExportRequest struct {
+	Query      *gorm.DB
+	Row        interface{} // A pointer to the struct that rows are scanned into
+	Fields     []string    // JSON names of the exported fields, or empty to export all fields
+	TimeFields []string    // JSON names of the fields which are unix timestamps in seconds
+	Options    exportutil.Options
+	FileName   string // Without the extension
 }
 
-// TODO: Better to be a streaming interface.
-func ExportCSV(data [][]string, filename, tokenNamespace string) (token string, err error) {
-	csvFile, err := ioutil.TempFile("", filename)
+// ExportQuery iterates the rows of the query and streams them into an encrypted temporary file, so that the
+// rows are never held in memory at once. It returns the download token of the file and the number of exported
+// rows. The file is removed when there are no rows.
+func ExportQuery(fSwap *fileswap.Handler, req *ExportRequest) (token string, rowsCount int, err error) {
+	loc, err := req.Options.Normalize()
 	if err != nil {
-		return
+		return "", 0, rest.ErrBadRequest.WrapWithNoMessage(err)
 	}
-	defer csvFile.Close() // #nosec
-
-	// generate encryption key
-	secretKey := *cryptopasta.NewEncryptionKey()
-
-	pr, pw := io.Pipe()
-	go func() {
-		csvwriter := csv.NewWriter(pw)
-		_ = csvwriter.WriteAll(data)
-		_ = pw.Close()
-	}()
-	err = aesctr.Encrypt(pr, csvFile, secretKey[0:16], secretKey[16:])
+	rows, err := req.Query.Rows()
 	if err != nil {
-		return
+		return "", 0, err
 	}
+	defer rows.Close() // #nosec
 
-	// generate token by filepath and secretKey
-	secretKeyStr := base64.StdEncoding.EncodeToString(secretKey[:])
-	token, err = NewJWTString(tokenNamespace, secretKeyStr+" "+csvFile.Name())
-	return
-}
-
-// FIXME: Remove or refine this function, as it is not general.
-func DownloadByToken(token, tokenNamespace string, c *gin.Context) {
-	tokenPlain, err := ParseJWTString(tokenNamespace, token)
+	writer, err := fSwap.NewFileWriter("export")
 	if err != nil {
-		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
-	}
-	arr := strings.Fields(tokenPlain)
-	if len(arr) != 2 {
-		_ = c.Error(rest.ErrBadRequest.New("invalid token"))
-		return
+		return "", 0, err
 	}
-	secretKey, err := base64.StdEncoding.DecodeString(arr[0])
+	exporter, err := exportutil.NewWriter(writer, req.Options.Format, req.Row, req.Fields, req.TimeFields, loc)
 	if err != nil {
-		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
-		return
+		writer.Remove()
+		return "", 0, rest.ErrBadRequest.WrapWithNoMessage(err)
 	}
-
-	filePath := arr[1]
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		_ = c.Error(err)
-		return
+	for rows.Next() {
+		if err = req.Query.ScanRows(rows, req.Row); err != nil {
+			break
+		}
+		// Hooks are not called when scanning rows one by one.
+		if hook, ok := req.Row.(callbacks.AfterFindInterface); ok {
+			if err = hook.AfterFind(req.Query); err != nil {
+				break
+			}
+		}
+		if err = exporter.Write(req.Row); err != nil {
+			break
+		}
 	}
-	f, err := os.Open(filepath.Clean(filePath))
-	if err != nil {
-		_ = c.Error(err)
-		return
+	if err == nil {
+		err = rows.Err()
 	}
-
-	c.Writer.Header().Set("Content-type", "text/csv")
-	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileInfo.Name()))
-	err = aesctr.Decrypt(f, c.Writer, secretKey[0:16], secretKey[16:])
+	if err == nil {
+		err = exporter.Close()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil || exporter.Rows() == 0 {
+		writer.Remove()
+		return "", 0, err
+	}
+	token, err = writer.GetDownloadToken(req.FileName+req.Options.Format.Extension(), exportDownloadExpire)
 	if err != nil {
-		log.Error("decrypt csv failed", zap.Error(err))
+		writer.Remove()
+		return "", 0, err
 	}
-	// delete it anyway
-	_ = f.Close()
-	_ = os.Remove(filePath)
+	return token, exporter.Rows(), nil
 }
@@ -17,6 +17,7 @@ import (
 	"golang.org/x/sync/singleflight"
 
 	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+	"github.com/pingcap/tidb-dashboard/util/client/httpclient"
 )
 
 var (
@@ -47,13 +48,18 @@ type NgmProxy struct {
 	etcdClient   *clientv3.Client
 	ngmReqGroup  singleflight.Group
 	ngmAddrCache atomic.Value
+	httpClient   *httpclient.Client
 }
 
 func NewNgmProxy(lc fx.Lifecycle, etcdClient *clientv3.Client) (*NgmProxy, error) {
-	s := &NgmProxy{etcdClient: etcdClient}
+	s := &NgmProxy{
+		etcdClient: etcdClient,
+		httpClient: httpclient.New(httpclient.Config{KindTag: "ngm"}),
+	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			s.lifecycleCtx = ctx
+			s.httpClient.SetDefaultCtx(ctx)
 			return nil
 		},
 	})
@@ -77,6 +83,21 @@ func (n *NgmProxy) Route(targetPath string) gin.HandlerFunc {
 	}
 }
 
+// SendGetRequest sends a GET request to NgMonitoring and decodes the JSON response, for the APIs which need
+// to post-process the result instead of proxying it.
+func (n *NgmProxy) SendGetRequest(ctx context.Context, path string, query url.Values, destination interface{}) error {
+	ngmAddr, err := n.getNgmAddrFromCache()
+	if err != nil {
+		return err
+	}
+	_, err = n.httpClient.LR().
+		SetContext(ctx).
+		SetQueryParamsFromValues(query).
+		Get(ngmAddr + path).
+		ReadBodyAsJSON(destination)
+	return err
+}
+
 func (n *NgmProxy) getNgmAddrFromCache() (string, error) {
 	fn := func() (string, error) {
 		// Check whether cache is valid, and use the cache if possible.
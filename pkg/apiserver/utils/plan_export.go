@@ -0,0 +1,26 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+type PlanExportOptions struct {
+	Format tidbplan.ExportFormat `json:"format" form:"format" binding:"required" enums:"json,dot,mermaid,text,markdown"`
+}
+
+// WritePlanExport responds the plan in the export format.
+func WritePlanExport(c *gin.Context, plan *tidbplan.Plan, format tidbplan.ExportFormat) {
+	content, err := plan.Export(format)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	c.Data(http.StatusOK, format.ContentType(), content)
+}
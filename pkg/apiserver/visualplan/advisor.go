@@ -0,0 +1,189 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package visualplan
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+// AdvisorRuleModel is a custom advisor rule, evaluated in addition to the built-in rules.
+type AdvisorRuleModel struct {
+	Name      string            `json:"name" gorm:"primary_key"`
+	Severity  tidbplan.Severity `json:"severity"`
+	Condition string            `json:"condition" gorm:"type:text"`
+	Message   string            `json:"message" gorm:"type:text"`
+}
+
+func (AdvisorRuleModel) TableName() string {
+	return "visual_plan_advisor_rules"
+}
+
+func (m *AdvisorRuleModel) rule() tidbplan.Rule {
+	return tidbplan.Rule{Name: m.Name, Severity: m.Severity, Condition: m.Condition, Message: m.Message}
+}
+
+func isBuiltInRule(name string) bool {
+	for _, rule := range tidbplan.DefaultRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compiledRules returns the built-in rules and the custom rules. Custom rules that are no longer valid,
+// e.g. after the environment is changed, are skipped.
+func (s *Service) compiledRules() ([]*tidbplan.CompiledRule, error) {
+	var models []AdvisorRuleModel
+	if err := s.params.LocalStore.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	rules := make([]*tidbplan.CompiledRule, 0, len(tidbplan.DefaultRules)+len(models))
+	for _, rule := range tidbplan.DefaultRules {
+		compiled, err := tidbplan.CompileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled)
+	}
+	for i := range models {
+		if compiled, err := tidbplan.CompileRule(models[i].rule()); err == nil {
+			rules = append(rules, compiled)
+		}
+	}
+	return rules, nil
+}
+
+type AdviseRequest struct {
+	// Any format supported by the plan import is accepted.
+	Plan string `json:"plan"`
+	// Advise on an imported plan instead of the plan text.
+	ImportedID string `json:"imported_id"`
+}
+
+// @ID adviseVisualPlan
+// @Summary Get suggestions for a plan
+// @Description Suggestions are ranked by the severity and then the share of the execution time
+// @Param req body AdviseRequest true "Request body"
+// @Success 200 {array} tidbplan.Suggestion
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/advise [post]
+func (s *Service) advise(c *gin.Context) {
+	var req AdviseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.ImportedID != "" {
+		imported, err := s.findImportedPlan(req.ImportedID, "content")
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		req.Plan = imported.Content
+	}
+	plan, _, err := tidbplan.ParseAny(req.Plan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	rules, err := s.compiledRules()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, plan.Advise(rules))
+}
+
+type AdvisorRule struct {
+	tidbplan.Rule
+	BuiltIn bool `json:"built_in"`
+}
+
+// @ID listVisualPlanAdvisorRules
+// @Summary List the built-in and custom advisor rules
+// @Success 200 {array} AdvisorRule
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/advisor/rules [get]
+func (s *Service) listAdvisorRules(c *gin.Context) {
+	var models []AdvisorRuleModel
+	if err := s.params.LocalStore.Order("name").Find(&models).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	rules := make([]AdvisorRule, 0, len(tidbplan.DefaultRules)+len(models))
+	for _, rule := range tidbplan.DefaultRules {
+		rules = append(rules, AdvisorRule{Rule: rule, BuiltIn: true})
+	}
+	for i := range models {
+		rules = append(rules, AdvisorRule{Rule: models[i].rule()})
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// @ID saveVisualPlanAdvisorRule
+// @Summary Create or update a custom advisor rule
+// @Description The condition is an expr expression over tidbplan.RuleNode, and the message is a text/template over the same node
+// @Param req body tidbplan.Rule true "Request body"
+// @Success 200 {object} tidbplan.Rule
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/advisor/rules [put]
+func (s *Service) saveAdvisorRule(c *gin.Context) {
+	var req tidbplan.Rule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if isBuiltInRule(req.Name) {
+		_ = c.Error(rest.ErrBadRequest.New("Rule %s is built-in", req.Name))
+		return
+	}
+	if _, err := tidbplan.CompileRule(req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	m := AdvisorRuleModel{Name: req.Name, Severity: req.Severity, Condition: req.Condition, Message: req.Message}
+	if err := s.params.LocalStore.Save(&m).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// @ID deleteVisualPlanAdvisorRule
+// @Summary Delete a custom advisor rule
+// @Param name path string true "rule name"
+// @Success 200 {object} rest.EmptyResponse
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/advisor/rules/{name} [delete]
+func (s *Service) deleteAdvisorRule(c *gin.Context) {
+	name := c.Param("name")
+	if isBuiltInRule(name) {
+		_ = c.Error(rest.ErrBadRequest.New("Rule %s is built-in", name))
+		return
+	}
+	if err := s.params.LocalStore.Where("name = ?", name).Delete(&AdvisorRuleModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
@@ -0,0 +1,280 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package visualplan
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+const (
+	defaultShareExpire = 7 * 24 * time.Hour
+	maxShareExpire     = 30 * 24 * time.Hour
+)
+
+// ImportedPlanModel is a plan pasted by users, which is not necessarily from the connected cluster.
+type ImportedPlanModel struct {
+	ID        string               `json:"id" gorm:"primary_key"`
+	Title     string               `json:"title"`
+	Notes     string               `json:"notes" gorm:"type:text"`
+	Format    tidbplan.InputFormat `json:"format"`
+	Content   string               `json:"content,omitempty" gorm:"type:text"` // The original input
+	CreatedAt int64                `json:"created_at" gorm:"index"`
+	CreatedBy string               `json:"created_by"`
+}
+
+func (ImportedPlanModel) TableName() string {
+	return "visual_plan_imported_plans"
+}
+
+type ImportedPlanResponse struct {
+	ImportedPlanModel
+	Plan *tidbplan.Plan `json:"plan"`
+}
+
+func newImportedPlanResponse(m *ImportedPlanModel) (*ImportedPlanResponse, error) {
+	plan, _, err := tidbplan.ParseAny(m.Content)
+	if err != nil {
+		return nil, err
+	}
+	plan.Analyze(tidbplan.DefaultTopN)
+	plan.CheckEstimation(tidbplan.DefaultQErrorThreshold)
+	return &ImportedPlanResponse{ImportedPlanModel: *m, Plan: plan}, nil
+}
+
+type ImportPlanRequest struct {
+	Title string `json:"title"`
+	Notes string `json:"notes"`
+	// The plan in plain text, MySQL client table, JSON, or encoded by TiDB.
+	Content string `json:"content" binding:"required"`
+}
+
+// @ID importVisualPlan
+// @Summary Import a plan
+// @Description The plan can be the plain text, the MySQL client table, the JSON, or the plan encoded by TiDB
+// @Param req body ImportPlanRequest true "Request body"
+// @Success 200 {object} ImportedPlanResponse
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Router /visual_plan/imported [post]
+func (s *Service) importPlan(c *gin.Context) {
+	var req ImportPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	_, format, err := tidbplan.ParseAny(req.Content)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = "Untitled plan"
+	}
+
+	m := &ImportedPlanModel{
+		ID:        uuid.New().String(),
+		Title:     title,
+		Notes:     req.Notes,
+		Format:    format,
+		Content:   req.Content,
+		CreatedAt: time.Now().Unix(),
+		CreatedBy: utils.GetSession(c).DisplayName,
+	}
+	if err := s.params.LocalStore.Create(m).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	resp, err := newImportedPlanResponse(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @ID listImportedVisualPlans
+// @Summary List imported plans
+// @Success 200 {array} ImportedPlanModel
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Router /visual_plan/imported [get]
+func (s *Service) listImportedPlans(c *gin.Context) {
+	plans := make([]ImportedPlanModel, 0)
+	err := s.params.LocalStore.
+		Select("id, title, notes, format, created_at, created_by").
+		Order("created_at DESC").
+		Find(&plans).Error
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// findImportedPlan finds the imported plan by the ID, selecting only the columns if specified.
+func (s *Service) findImportedPlan(id string, columns ...string) (*ImportedPlanModel, error) {
+	query := s.params.LocalStore.Where("id = ?", id)
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+	var m ImportedPlanModel
+	err := query.First(&m).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, rest.ErrNotFound.New("Imported plan %s is not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *Service) queryImportedPlan(c *gin.Context, id string) {
+	m, err := s.findImportedPlan(id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	resp, err := newImportedPlanResponse(m)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @ID getImportedVisualPlan
+// @Summary Get an imported plan
+// @Param id path string true "plan ID"
+// @Success 200 {object} ImportedPlanResponse
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/imported/{id} [get]
+func (s *Service) getImportedPlan(c *gin.Context) {
+	s.queryImportedPlan(c, c.Param("id"))
+}
+
+// @ID deleteImportedVisualPlan
+// @Summary Delete an imported plan
+// @Param id path string true "plan ID"
+// @Success 200 {object} rest.EmptyResponse
+// @Security JwtAuth
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 403 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/imported/{id} [delete]
+func (s *Service) deleteImportedPlan(c *gin.Context) {
+	if err := s.params.LocalStore.Where("id = ?", c.Param("id")).Delete(&ImportedPlanModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rest.EmptyResponse{})
+}
+
+type ShareTokenRequest struct {
+	ExpireSecs int64 `json:"expire_secs"` // Defaults to 7 days, at most 30 days
+}
+
+// @ID getImportedVisualPlanShareToken
+// @Summary Get a read-only token to share an imported plan
+// @Description Colleagues can open the plan with the token at /visual_plan/shared without signing in
+// @Param id path string true "plan ID"
+// @Param req body ShareTokenRequest true "Request body"
+// @Produce plain
+// @Success 200 {string} string "token"
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/imported/{id}/share_token [post]
+func (s *Service) getShareToken(c *gin.Context) {
+	var req ShareTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	expire := time.Duration(req.ExpireSecs) * time.Second
+	if expire <= 0 {
+		expire = defaultShareExpire
+	}
+	if expire > maxShareExpire {
+		expire = maxShareExpire
+	}
+
+	m, err := s.findImportedPlan(c.Param("id"), "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	token, err := utils.NewJWTStringWithExpire("visual_plan/shared", m.ID, expire)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// @ID getSharedVisualPlan
+// @Summary Get an imported plan shared by a read-only token
+// @Param token query string true "share token"
+// @Success 200 {object} ImportedPlanResponse
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/shared [get]
+func (s *Service) getSharedPlan(c *gin.Context) {
+	id, err := utils.ParseJWTString("visual_plan/shared", c.Query("token"))
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	s.queryImportedPlan(c, id)
+}
+
+// @ID exportImportedVisualPlan
+// @Summary Export an imported plan as JSON, DOT, Mermaid, the text tree or Markdown
+// @Param id path string true "plan ID"
+// @Param q query utils.PlanExportOptions true "Query"
+// @Produce json,text/vnd.graphviz,text/markdown,plain
+// @Success 200 {string} string
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/imported/{id}/export [get]
+func (s *Service) exportImportedPlan(c *gin.Context) {
+	var req utils.PlanExportOptions
+	if err := c.ShouldBindQuery(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	m, err := s.findImportedPlan(c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan, _, err := tidbplan.ParseAny(m.Content)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan.Analyze(tidbplan.DefaultTopN)
+	plan.CheckEstimation(tidbplan.DefaultQErrorThreshold)
+	utils.WritePlanExport(c, plan, req.Format)
+}
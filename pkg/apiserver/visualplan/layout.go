@@ -0,0 +1,53 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package visualplan
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+type LayoutRequest struct {
+	// Any format supported by the plan import is accepted.
+	Plan string `json:"plan"`
+	// Lay out an imported plan instead of the plan text.
+	ImportedID string                 `json:"imported_id"`
+	Options    tidbplan.LayoutOptions `json:"options"`
+}
+
+// @ID layoutVisualPlan
+// @Summary Lay out the plan tree
+// @Description Get the coordinates of the operators and the routes of the edges, so that the plan can be drawn without graphviz. Long chains of Projection and Selection are collapsed.
+// @Param req body LayoutRequest true "Request body"
+// @Success 200 {object} tidbplan.Layout
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Router /visual_plan/layout [post]
+func (s *Service) layout(c *gin.Context) {
+	var req LayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.ImportedID != "" {
+		imported, err := s.findImportedPlan(req.ImportedID, "content")
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		req.Plan = imported.Content
+	}
+	plan, _, err := tidbplan.ParseAny(req.Plan)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+	plan.Analyze(tidbplan.DefaultTopN)
+	c.JSON(http.StatusOK, plan.Layout(req.Options))
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package visualplan
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ReneKroon/ttlcache/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-graphviz"
+	"github.com/google/uuid"
+	"go.uber.org/fx"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/util/graphvizutil"
+	"github.com/pingcap/tidb-dashboard/util/rest"
+	"github.com/pingcap/tidb-dashboard/util/tidbplan"
+)
+
+// Plans submitted for rendering are kept in memory until the action token expires.
+const planTTL = 30 * time.Minute
+
+// The operator type comes from the imported plan text, which can contain anything.
+var unsafeFileNameCharsRegex = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// downloadFileName returns the file name without the extension, e.g. `plan_HashJoin`.
+func downloadFileName(plan *tidbplan.Plan) string {
+	name := unsafeFileNameCharsRegex.ReplaceAllString(plan.Root.Type, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return "plan_" + name
+}
+
+type ServiceParams struct {
+	fx.In
+	LocalStore *dbstore.DB
+}
+
+type Service struct {
+	params ServiceParams
+	plans  *ttlcache.Cache
+}
+
+func newService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	plans := ttlcache.NewCache()
+	plans.SkipTTLExtensionOnHit(true)
+	_ = plans.SetTTL(planTTL)
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return plans.Close()
+		},
+	})
+	return &Service{params: p, plans: plans}, nil
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&ImportedPlanModel{}, &AdvisorRuleModel{})
+}
+
+func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
+	endpoint := r.Group("/visual_plan")
+	endpoint.POST("/action_token", auth.MWAuthRequired(), s.getActionToken)
+	endpoint.GET("/view", s.view)
+	endpoint.GET("/download", s.download)
+
+	endpoint.GET("/shared", s.getSharedPlan)
+	imported := endpoint.Group("/imported")
+	imported.Use(auth.MWAuthRequired())
+	{
+		imported.GET("", s.listImportedPlans)
+		imported.POST("", auth.MWRequireWritePriv(), s.importPlan)
+		imported.GET("/:id", s.getImportedPlan)
+		imported.DELETE("/:id", auth.MWRequireWritePriv(), s.deleteImportedPlan)
+		imported.POST("/:id/share_token", s.getShareToken)
+		imported.GET("/:id/export", s.exportImportedPlan)
+	}
+
+	endpoint.POST("/layout", auth.MWAuthRequired(), s.layout)
+	endpoint.POST("/advise", auth.MWAuthRequired(), s.advise)
+	rules := endpoint.Group("/advisor/rules")
+	rules.Use(auth.MWAuthRequired())
+	{
+		rules.GET("", s.listAdvisorRules)
+		rules.PUT("", auth.MWRequireWritePriv(), s.saveAdvisorRule)
+		rules.DELETE("/:name", auth.MWRequireWritePriv(), s.deleteAdvisorRule)
+	}
+}
+
+type Action string
+
+const (
+	ActionView     Action = "view"
+	ActionDownload Action = "download"
+)
+
+// OutputType is an image type, or any export format of the plan, e.g. mermaid and markdown.
+type OutputType string
+
+const (
+	OutputTypeSVG OutputType = "svg"
+	OutputTypePNG OutputType = "png"
+	OutputTypeDOT OutputType = "dot"
+)
+
+type ActionTokenRequest struct {
+	Action Action `json:"action" binding:"required" enums:"view,download"`
+	// The plan text, as shown in the statement or slow query detail, or the output of EXPLAIN ANALYZE.
+	// Any format supported by the plan import is accepted.
+	Plan string `json:"plan"`
+	// Render an imported plan instead of the plan text.
+	ImportedID string `json:"imported_id"`
+}
+
+// @ID getVisualPlanActionToken
+// @Summary Get an action token to view or download the rendered plan
+// @Description The plan is kept for 30 minutes, during which the token can be used without signing in
+// @Param req body ActionTokenRequest true "Request body"
+// @Produce plain
+// @Success 200 {string} string "token"
+// @Security JwtAuth
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 401 {object} rest.ErrorResponse
+// @Failure 404 {object} rest.ErrorResponse
+// @Router /visual_plan/action_token [post]
+func (s *Service) getActionToken(c *gin.Context) {
+	var req ActionTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	if req.Action != ActionView && req.Action != ActionDownload {
+		_ = c.Error(rest.ErrBadRequest.New("Unsupported action %s", req.Action))
+		return
+	}
+	if req.ImportedID != "" {
+		imported, err := s.findImportedPlan(req.ImportedID, "content")
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		req.Plan = imported.Content
+	}
+	// Validate the plan early, so that an invalid plan is reported to the caller rather than the viewer.
+	if _, _, err := tidbplan.ParseAny(req.Plan); err != nil {
+		_ = c.Error(rest.ErrBadRequest.WrapWithNoMessage(err))
+		return
+	}
+
+	id := uuid.New().String()
+	if err := s.plans.Set(id, req.Plan); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	token, err := utils.NewJWTStringWithExpire("visual_plan/"+string(req.Action), id, planTTL)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// @ID viewVisualPlan
+// @Summary View the rendered plan
+// @Description Nodes are colored by the exclusive time, and edge widths scale with the rows
+// @Produce image/svg+xml,image/png,text/vnd.graphviz,json,text/markdown,plain
+// @Param token query string true "view token"
+// @Param output_type query string false "svg (default), png, dot, json, mermaid, text or markdown"
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/view [get]
+func (s *Service) view(c *gin.Context) {
+	s.render(c, ActionView)
+}
+
+// @ID downloadVisualPlan
+// @Summary Download the rendered plan
+// @Description Nodes are colored by the exclusive time, and edge widths scale with the rows
+// @Produce image/svg+xml,image/png,text/vnd.graphviz,json,text/markdown,plain
+// @Param token query string true "download token"
+// @Param output_type query string false "svg (default), png, dot, json, mermaid, text or markdown"
+// @Failure 400 {object} rest.ErrorResponse
+// @Failure 500 {object} rest.ErrorResponse
+// @Router /visual_plan/download [get]
+func (s *Service) download(c *gin.Context) {
+	s.render(c, ActionDownload)
+}
+
+func (s *Service) render(c *gin.Context, action Action) {
+	id, err := utils.ParseJWTString("visual_plan/"+string(action), c.Query("token"))
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.NewWithNoMessage())
+		return
+	}
+	planText, err := s.plans.Get(id)
+	if err != nil {
+		_ = c.Error(rest.ErrBadRequest.New("The plan is expired"))
+		return
+	}
+	plan, _, err := tidbplan.ParseAny(planText.(string))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	plan.Analyze(tidbplan.DefaultTopN)
+	dotContent := plan.DOT()
+
+	outputType := OutputType(c.DefaultQuery("output_type", string(OutputTypeSVG)))
+	var content []byte
+	var contentType string
+	switch outputType {
+	case OutputTypeSVG:
+		content, err = graphvizutil.RenderDOT(dotContent, graphviz.SVG)
+		contentType = "image/svg+xml"
+	case OutputTypePNG:
+		content, err = graphvizutil.RenderDOT(dotContent, graphviz.PNG)
+		contentType = "image/png"
+	case OutputTypeDOT:
+		content = dotContent
+		contentType = "text/vnd.graphviz"
+	default:
+		format := tidbplan.ExportFormat(outputType)
+		if content, err = plan.Export(format); err != nil {
+			_ = c.Error(rest.ErrBadRequest.New("Cannot output plan as %s", outputType))
+			return
+		}
+		contentType = format.ContentType()
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if action == ActionDownload {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, downloadFileName(plan), outputType))
+	}
+	c.Data(http.StatusOK, contentType, content)
+}
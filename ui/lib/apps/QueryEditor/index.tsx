@@ -71,9 +71,9 @@ function App() {
                     <CheckOutlined /> Success (
                     {getValueFormat('ms')(results.execution_ms || 0, 1)},
                     {(results.actual_rows || 0) > (results.rows?.length || 0)
-                      ? `Displaying first ${results.rows?.length || 0} of ${
-                          results.actual_rows || 0
-                        } rows`
+                      ? `Displaying first ${
+                          results.rows?.length || 0
+                        } rows, more rows are not read`
                       : `${results.rows?.length || 0} rows`}
                     )
                   </Typography.Text>
@@ -0,0 +1,115 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package exportutil
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	// Rows are encoded into pages once the buffered values are large enough, and the pages are written as a row
+	// group once they are large enough, so that the memory usage is bounded.
+	parquetBufferMaxSize   = 1024 * 1024
+	parquetRowGroupMaxSize = 16 * 1024 * 1024
+)
+
+// streamFile is a write-only source.ParquetFile, as the Parquet writer only appends to the file.
+type streamFile struct {
+	io.Writer
+}
+
+func (f streamFile) Seek(int64, int) (int64, error) {
+	return 0, fmt.Errorf("seek is not supported")
+}
+
+func (f streamFile) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("read is not supported")
+}
+
+func (f streamFile) Close() error {
+	return nil
+}
+
+func (f streamFile) Open(string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("open is not supported")
+}
+
+func (f streamFile) Create(string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("create is not supported")
+}
+
+// parquetType returns the type in the schema metadata of parquet-go.
+func parquetType(t ColumnType) string {
+	switch t {
+	case ColumnInt:
+		return "INT_64"
+	case ColumnUint:
+		return "UINT_64"
+	case ColumnTime:
+		return "TIMESTAMP_MILLIS"
+	case ColumnFloat:
+		return "DOUBLE"
+	case ColumnBool:
+		return "BOOLEAN"
+	default:
+		return "UTF8"
+	}
+}
+
+type parquetEncoder struct {
+	w *writer.CSVWriter
+	// The size of the values buffered in the writer. The writer cannot tell the size of the values in a row, so
+	// it would otherwise buffer thousands of rows however large they are.
+	buffered int
+}
+
+func newParquetEncoder(w io.Writer, columns []Column) (encoder, error) {
+	md := make([]string, 0, len(columns))
+	for _, c := range columns {
+		md = append(md, fmt.Sprintf("name=%s, type=%s", c.Name, parquetType(c.Type)))
+	}
+	pw, err := writer.NewCSVWriter(md, streamFile{w}, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupMaxSize
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &parquetEncoder{w: pw}, nil
+}
+
+func (e *parquetEncoder) writeRow(values []interface{}) error {
+	// The writer keeps the row until the row group is flushed.
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			row[i] = v
+			e.buffered += len(v)
+		case uint64:
+			row[i] = int64(v)
+		case time.Time:
+			row[i] = v.UnixNano() / int64(time.Millisecond)
+		default:
+			row[i] = v
+		}
+		e.buffered += 8
+	}
+	if err := e.w.Write(row); err != nil {
+		return err
+	}
+	if e.buffered >= parquetBufferMaxSize {
+		e.buffered = 0
+		return e.w.Flush(false)
+	}
+	return nil
+}
+
+func (e *parquetEncoder) close() error {
+	return e.w.WriteStop()
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package exportutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// bytesFile is a read-only source.ParquetFile of the bytes.
+type bytesFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newBytesFile(data []byte) *bytesFile {
+	return &bytesFile{Reader: bytes.NewReader(data), data: data}
+}
+
+func (f *bytesFile) Open(string) (source.ParquetFile, error) {
+	return newBytesFile(f.data), nil
+}
+
+func (f *bytesFile) Create(string) (source.ParquetFile, error) {
+	panic("read only")
+}
+
+func (f *bytesFile) Write([]byte) (int, error) {
+	panic("read only")
+}
+
+func (f *bytesFile) Close() error {
+	return nil
+}
+
+func readParquetColumns(t *testing.T, data []byte) (int64, map[string][]interface{}) {
+	r, err := reader.NewParquetColumnReader(newBytesFile(data), 1)
+	require.NoError(t, err)
+	defer r.ReadStop()
+	rows := r.GetNumRows()
+	columns := make(map[string][]interface{})
+	for i, info := range r.SchemaHandler.Infos[1:] {
+		values, _, _, err := r.ReadColumnByIndex(int64(i), rows)
+		require.NoError(t, err)
+		columns[info.ExName] = values
+	}
+	return rows, columns
+}
+
+func parquetRowGroups(t *testing.T, data []byte) int {
+	r, err := reader.NewParquetColumnReader(newBytesFile(data), 1)
+	require.NoError(t, err)
+	defer r.ReadStop()
+	return len(r.Footer.RowGroups)
+}
+
+func TestParquet(t *testing.T) {
+	out := writeRows(t, FormatParquet, []string{"digest", "exec_count"}, nil)
+	require.Equal(t, "PAR1", string(out[:4]))
+	require.Equal(t, "PAR1", string(out[len(out)-4:]))
+	rows, columns := readParquetColumns(t, out)
+	require.Equal(t, int64(2), rows)
+	require.Len(t, columns, 2)
+
+	// Rows are flushed in multiple row groups when the buffered data is large. Booleans are bit packed, so
+	// that the values must be kept across the flushes.
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatParquet, testRow{}, []string{"digest", "bound"}, nil, nil)
+	require.NoError(t, err)
+	// Random data, so that the size is not reduced by the compression.
+	random := make([]byte, parquetRowGroupMaxSize/8)
+	rand.New(rand.NewSource(1)).Read(random)
+	long := hex.EncodeToString(random)
+	var digests []interface{}
+	var bounds []interface{}
+	for i := 0; i < 11; i++ {
+		row := testRow{Bound: i%3 == 0}
+		if i%2 == 0 {
+			row.Digest = long
+		}
+		require.NoError(t, w.Write(row))
+		digests = append(digests, row.Digest)
+		bounds = append(bounds, row.Bound)
+	}
+	require.NoError(t, w.Close())
+	require.Greater(t, parquetRowGroups(t, buf.Bytes()), 1)
+	rows, columns = readParquetColumns(t, buf.Bytes())
+	require.Equal(t, int64(11), rows)
+	require.Equal(t, digests, columns["digest"])
+	require.Equal(t, bounds, columns["bound"])
+}
+
+func TestParquetEmpty(t *testing.T) {
+	// Empty strings are not nulls.
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatParquet, testRow{}, []string{"digest", "exec_count"}, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testRow{Digest: "", ExecCount: 1}))
+	require.NoError(t, w.Write(testRow{Digest: "d", ExecCount: 2}))
+	require.NoError(t, w.Write(testRow{Digest: "", ExecCount: 3}))
+	require.NoError(t, w.Close())
+	rows, columns := readParquetColumns(t, buf.Bytes())
+	require.Equal(t, int64(3), rows)
+	require.Equal(t, []interface{}{"", "d", ""}, columns["digest"])
+	require.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, columns["exec_count"])
+
+	// A file without rows is still valid.
+	buf.Reset()
+	w, err = NewWriter(&buf, FormatParquet, testRow{}, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	rows, _ = readParquetColumns(t, buf.Bytes())
+	require.Equal(t, int64(0), rows)
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	rows, columns := readParquetColumns(t, writeRows(t, FormatParquet, nil, nil))
+	require.Equal(t, int64(2), rows)
+	require.Equal(t, []interface{}{"d1", "d,2"}, columns["digest"])
+	require.Equal(t, []interface{}{int64(10), int64(-1)}, columns["exec_count"])
+	require.Equal(t, []interface{}{int64(1024), int64(0)}, columns["max_mem"]) // Uint64 is stored as int64
+	require.Equal(t, []interface{}{0.5, 1e-7}, columns["latency"])
+	require.Equal(t, []interface{}{true, false}, columns["bound"])
+	require.Equal(t, []interface{}{int64(1633107235000), int64(0)}, columns["first_seen"])
+	require.Equal(t, []interface{}{int64(1633107235250), int64(0)}, columns["timestamp"])
+}
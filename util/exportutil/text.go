@@ -0,0 +1,123 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package exportutil
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/tidb-dashboard/util/timeutil"
+)
+
+type csvEncoder struct {
+	cw     *csv.Writer
+	loc    *time.Location
+	rowBuf []string
+}
+
+func newCSVEncoder(w io.Writer, columns []Column, loc *time.Location) (encoder, error) {
+	e := &csvEncoder{
+		cw:     csv.NewWriter(w),
+		loc:    loc,
+		rowBuf: make([]string, len(columns)),
+	}
+	for i, c := range columns {
+		e.rowBuf[i] = c.Name
+	}
+	if err := e.cw.Write(e.rowBuf); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *csvEncoder) writeRow(values []interface{}) error {
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			e.rowBuf[i] = v
+		case int64:
+			e.rowBuf[i] = strconv.FormatInt(v, 10)
+		case uint64:
+			e.rowBuf[i] = strconv.FormatUint(v, 10)
+		case float64:
+			e.rowBuf[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			e.rowBuf[i] = strconv.FormatBool(v)
+		case time.Time:
+			e.rowBuf[i] = v.In(e.loc).Format(timeutil.DateTimeFormat)
+		}
+	}
+	return e.cw.Write(e.rowBuf)
+}
+
+func (e *csvEncoder) close() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+// jsonLinesEncoder writes a JSON object per line. Keys are in the order of the columns, and times are in
+// RFC 3339 with the offset of the time zone.
+type jsonLinesEncoder struct {
+	bw   *bufio.Writer
+	loc  *time.Location
+	keys [][]byte
+	buf  []byte
+}
+
+func newJSONLinesEncoder(w io.Writer, columns []Column, loc *time.Location) (encoder, error) {
+	e := &jsonLinesEncoder{
+		bw:   bufio.NewWriter(w),
+		loc:  loc,
+		keys: make([][]byte, len(columns)),
+	}
+	for i, c := range columns {
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return nil, err
+		}
+		e.keys[i] = key
+	}
+	return e, nil
+}
+
+func (e *jsonLinesEncoder) writeRow(values []interface{}) error {
+	e.buf = append(e.buf[:0], '{')
+	for i, v := range values {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.buf = append(e.buf, e.keys[i]...)
+		e.buf = append(e.buf, ':')
+		switch v := v.(type) {
+		case int64:
+			e.buf = strconv.AppendInt(e.buf, v, 10)
+		case uint64:
+			e.buf = strconv.AppendUint(e.buf, v, 10)
+		case float64:
+			e.buf = strconv.AppendFloat(e.buf, v, 'f', -1, 64)
+		case bool:
+			e.buf = strconv.AppendBool(e.buf, v)
+		case time.Time:
+			e.buf = append(e.buf, '"')
+			e.buf = v.In(e.loc).AppendFormat(e.buf, time.RFC3339Nano)
+			e.buf = append(e.buf, '"')
+		default:
+			s, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			e.buf = append(e.buf, s...)
+		}
+	}
+	e.buf = append(e.buf, '}', '\n')
+	_, err := e.bw.Write(e.buf)
+	return err
+}
+
+func (e *jsonLinesEncoder) close() error {
+	return e.bw.Flush()
+}
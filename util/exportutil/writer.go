@@ -0,0 +1,255 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package exportutil writes rows of structs in CSV, JSON Lines or Parquet format, one row at a time, so that
+// large results can be streamed from the database cursor to the file without being held in memory.
+package exportutil
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+var (
+	ErrNS            = errorx.NewNamespace("export")
+	ErrInvalidOption = ErrNS.NewType("invalid_option")
+)
+
+type Format string
+
+const (
+	FormatCSV       Format = "csv"
+	FormatJSONLines Format = "jsonl"
+	FormatParquet   Format = "parquet"
+)
+
+// Extension returns the file extension of the format, including the dot.
+func (f Format) Extension() string {
+	switch f {
+	case FormatJSONLines:
+		return ".jsonl"
+	case FormatParquet:
+		return ".parquet"
+	default:
+		return ".csv"
+	}
+}
+
+// Options are the export options specified by the user.
+type Options struct {
+	Format   Format `json:"format" form:"format" enums:"csv,jsonl,parquet"`     // Default to csv
+	TimeZone string `json:"time_zone" form:"time_zone" example:"Asia/Shanghai"` // Default to UTC
+}
+
+// Normalize fills the default values and validates the options.
+func (o *Options) Normalize() (*time.Location, error) {
+	switch o.Format {
+	case "":
+		o.Format = FormatCSV
+	case FormatCSV, FormatJSONLines, FormatParquet:
+	default:
+		return nil, ErrInvalidOption.New("unknown format %s", o.Format)
+	}
+	if o.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		return nil, ErrInvalidOption.Wrap(err, "unknown time zone %s", o.TimeZone)
+	}
+	return loc, nil
+}
+
+type ColumnType int
+
+const (
+	ColumnString ColumnType = iota
+	ColumnInt
+	ColumnUint
+	ColumnFloat
+	ColumnBool
+	// ColumnTime is a unix timestamp in seconds in the struct, which is exported as a typed timestamp.
+	ColumnTime
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+
+	fieldIndex int
+}
+
+// encoder encodes the values of a row, whose types are string, int64, uint64, float64, bool or time.Time
+// according to the column types.
+type encoder interface {
+	writeRow(values []interface{}) error
+	close() error
+}
+
+// Writer writes structs as rows. Columns are the struct fields, named by the JSON tags.
+type Writer struct {
+	columns []Column
+	rowType reflect.Type
+	enc     encoder
+	values  []interface{}
+	rows    int
+}
+
+// NewWriter creates a writer for the rows of the same type as row. Only the fields whose JSON names are in
+// fields are exported, in the given order, and unknown names are ignored. All fields are exported when fields
+// is empty or is `*`. The fields
+// in timeFields are unix timestamps in seconds, which are formatted in loc for text formats.
+func NewWriter(w io.Writer, format Format, row interface{}, fields, timeFields []string, loc *time.Location) (*Writer, error) {
+	rowType := reflect.Indirect(reflect.ValueOf(row)).Type()
+	columns, err := resolveColumns(rowType, fields, timeFields)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	var enc encoder
+	switch format {
+	case "", FormatCSV:
+		enc, err = newCSVEncoder(w, columns, loc)
+	case FormatJSONLines:
+		enc, err = newJSONLinesEncoder(w, columns, loc)
+	case FormatParquet:
+		enc, err = newParquetEncoder(w, columns)
+	default:
+		err = ErrInvalidOption.New("unknown format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		columns: columns,
+		rowType: rowType,
+		enc:     enc,
+		values:  make([]interface{}, len(columns)),
+	}, nil
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return strings.ToLower(name)
+}
+
+func columnType(t reflect.Type) (ColumnType, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return ColumnString, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ColumnInt, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ColumnUint, true
+	case reflect.Float32, reflect.Float64:
+		return ColumnFloat, true
+	case reflect.Bool:
+		return ColumnBool, true
+	default:
+		return 0, false
+	}
+}
+
+func resolveColumns(rowType reflect.Type, fields, timeFields []string) ([]Column, error) {
+	if rowType.Kind() != reflect.Struct {
+		return nil, ErrInvalidOption.New("rows must be structs, got %s", rowType)
+	}
+	isTime := make(map[string]bool, len(timeFields))
+	for _, f := range timeFields {
+		isTime[f] = true
+	}
+	all := make([]Column, 0, rowType.NumField())
+	byName := make(map[string]Column, rowType.NumField())
+	for i := 0; i < rowType.NumField(); i++ {
+		f := rowType.Field(i)
+		name := jsonName(f)
+		typ, ok := columnType(f.Type)
+		if f.PkgPath != "" || name == "" || !ok {
+			continue
+		}
+		if isTime[name] && typ != ColumnString && typ != ColumnBool {
+			typ = ColumnTime
+		}
+		c := Column{Name: name, Type: typ, fieldIndex: i}
+		all = append(all, c)
+		byName[name] = c
+	}
+	if len(fields) == 0 || (len(fields) == 1 && fields[0] == "*") {
+		return all, nil
+	}
+	columns := make([]Column, 0, len(fields))
+	for _, name := range fields {
+		// Unknown fields are ignored, e.g. columns of another TiDB version selected in the UI.
+		if c, ok := byName[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns = append(columns, c)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, ErrInvalidOption.New("no known fields in %s", strings.Join(fields, ","))
+	}
+	return columns, nil
+}
+
+func unixToTime(v reflect.Value) time.Time {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		sec := v.Float()
+		whole := int64(sec)
+		return time.Unix(whole, int64((sec-float64(whole))*float64(time.Second)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return time.Unix(int64(v.Uint()), 0)
+	default:
+		return time.Unix(v.Int(), 0)
+	}
+}
+
+// Write writes a row, which must be of the same type as the one passed to NewWriter.
+func (w *Writer) Write(row interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.Type() != w.rowType {
+		return ErrInvalidOption.New("expect row of %s, got %s", w.rowType, v.Type())
+	}
+	for i, c := range w.columns {
+		fv := v.Field(c.fieldIndex)
+		switch c.Type {
+		case ColumnString:
+			w.values[i] = fv.String()
+		case ColumnInt:
+			w.values[i] = fv.Int()
+		case ColumnUint:
+			w.values[i] = fv.Uint()
+		case ColumnFloat:
+			w.values[i] = fv.Float()
+		case ColumnBool:
+			w.values[i] = fv.Bool()
+		case ColumnTime:
+			w.values[i] = unixToTime(fv)
+		}
+	}
+	w.rows++
+	return w.enc.writeRow(w.values)
+}
+
+// Rows returns the number of rows written.
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Columns returns the exported columns.
+func (w *Writer) Columns() []Column {
+	return w.columns
+}
+
+// Close flushes the buffered rows and writes the trailing data of the format. The underlying writer is not
+// closed.
+func (w *Writer) Close() error {
+	return w.enc.close()
+}
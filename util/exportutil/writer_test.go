@@ -0,0 +1,109 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package exportutil
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRow struct {
+	Digest    string  `json:"digest"`
+	ExecCount int     `json:"exec_count"`
+	MaxMem    uint    `json:"max_mem"`
+	Latency   float64 `json:"latency"`
+	Bound     bool    `json:"bound"`
+	FirstSeen int     `json:"first_seen"`
+	Timestamp float64 `json:"timestamp"`
+	Ignored   []int   `json:"ignored"`
+	Hidden    string  `json:"-"`
+	private   string
+}
+
+var testRows = []testRow{
+	{Digest: "d1", ExecCount: 10, MaxMem: 1024, Latency: 0.5, Bound: true, FirstSeen: 1633107235, Timestamp: 1633107235.25},
+	{Digest: "d,2", ExecCount: -1, Latency: 1e-7},
+}
+
+func writeRows(t *testing.T, format Format, fields []string, loc *time.Location) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, testRow{}, fields, []string{"first_seen", "timestamp"}, loc)
+	require.NoError(t, err)
+	for i := range testRows {
+		require.NoError(t, w.Write(&testRows[i]))
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, len(testRows), w.Rows())
+	return buf.Bytes()
+}
+
+func TestResolveColumns(t *testing.T) {
+	w, err := NewWriter(&bytes.Buffer{}, FormatCSV, testRow{}, nil, []string{"first_seen"}, nil)
+	require.NoError(t, err)
+	names := make([]string, 0)
+	for _, c := range w.Columns() {
+		names = append(names, c.Name)
+	}
+	require.Equal(t, []string{"digest", "exec_count", "max_mem", "latency", "bound", "first_seen", "timestamp"}, names)
+	require.Equal(t, ColumnTime, w.Columns()[5].Type)
+	require.Equal(t, ColumnFloat, w.Columns()[6].Type)
+
+	w, err = NewWriter(&bytes.Buffer{}, FormatCSV, testRow{}, []string{"digest", "unknown", "bound"}, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, w.Columns(), 2)
+	require.Equal(t, "bound", w.Columns()[1].Name)
+	_, err = NewWriter(&bytes.Buffer{}, FormatCSV, testRow{}, []string{"unknown"}, nil, nil)
+	require.Error(t, err)
+	_, err = NewWriter(&bytes.Buffer{}, FormatCSV, 1, nil, nil, nil)
+	require.Error(t, err)
+
+	w, err = NewWriter(&bytes.Buffer{}, FormatCSV, testRow{}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Error(t, w.Write(struct{}{}))
+}
+
+func TestCSV(t *testing.T) {
+	out := writeRows(t, FormatCSV, []string{"*"}, nil)
+	require.Equal(t, `digest,exec_count,max_mem,latency,bound,first_seen,timestamp
+d1,10,1024,0.5,true,2021-10-01 16:53:55 UTC,2021-10-01 16:53:55 UTC
+"d,2",-1,0,0.0000001,false,1970-01-01 00:00:00 UTC,1970-01-01 00:00:00 UTC
+`, string(out))
+
+	loc := time.FixedZone("CST", 8*3600)
+	out = writeRows(t, "", []string{"first_seen", "digest"}, loc)
+	require.Equal(t, `first_seen,digest
+2021-10-02 00:53:55 CST,d1
+1970-01-01 08:00:00 CST,"d,2"
+`, string(out))
+}
+
+func TestJSONLines(t *testing.T) {
+	out := writeRows(t, FormatJSONLines, []string{"digest", "max_mem", "latency", "bound", "timestamp"}, time.FixedZone("CST", 8*3600))
+	require.Equal(t, `{"digest":"d1","max_mem":1024,"latency":0.5,"bound":true,"timestamp":"2021-10-02T00:53:55.25+08:00"}
+{"digest":"d,2","max_mem":0,"latency":0.0000001,"bound":false,"timestamp":"1970-01-01T08:00:00+08:00"}
+`, string(out))
+}
+
+func TestOptions(t *testing.T) {
+	o := Options{}
+	loc, err := o.Normalize()
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, loc)
+	require.Equal(t, FormatCSV, o.Format)
+	require.Equal(t, ".csv", o.Format.Extension())
+
+	o = Options{Format: FormatParquet, TimeZone: "UTC"}
+	_, err = o.Normalize()
+	require.NoError(t, err)
+	require.Equal(t, ".parquet", o.Format.Extension())
+
+	o = Options{Format: "xlsx"}
+	_, err = o.Normalize()
+	require.Error(t, err)
+	o = Options{TimeZone: "Mars/Olympus"}
+	_, err = o.Normalize()
+	require.Error(t, err)
+}
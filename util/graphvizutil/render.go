@@ -0,0 +1,31 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package graphvizutil renders graphs described in the DOT language.
+package graphvizutil
+
+import (
+	"bytes"
+
+	"github.com/goccy/go-graphviz"
+)
+
+// RenderDOT renders the graph described in the DOT language into the given format, e.g. graphviz.SVG.
+func RenderDOT(dotContent []byte, format graphviz.Format) ([]byte, error) {
+	g := graphviz.New()
+	defer func() {
+		_ = g.Close()
+	}()
+	graph, err := graphviz.ParseBytes(dotContent)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = graph.Close()
+	}()
+
+	var buf bytes.Buffer
+	if err := g.Render(graph, format, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package sqlutil checks SQL statements submitted by users. Statements are classified by the TiDB parser, while
+// a lexer following the lexical rules of TiDB tells the code from the strings and comments in SQL templates, which
+// cannot be parsed.
+package sqlutil
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/joomcode/errorx"
+)
+
+var (
+	ErrNS     = errorx.NewNamespace("sql")
+	ErrSyntax = ErrNS.NewType("syntax_error")
+)
+
+type lexer struct {
+	src string
+	pos int
+	// inExecComment is true inside `/*! ... */` or `/*T! ... */`, whose content is executed by TiDB.
+	inExecComment bool
+	// noBackslashEscapes follows the NO_BACKSLASH_ESCAPES SQL mode, where backslashes are ordinary characters.
+	noBackslashEscapes bool
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+offset]
+}
+
+// skipSpaceAndComments skips the whitespaces and comments. Executable comments are entered instead of being
+// skipped, so that their content is tokenized.
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case c == '#' || (c == '-' && l.peek(1) == '-' && (l.peek(2) <= ' ')):
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end < 0 {
+				l.pos = len(l.src)
+			} else {
+				l.pos += end + 1
+			}
+		case c == '*' && l.peek(1) == '/' && l.inExecComment:
+			l.pos += 2
+			l.inExecComment = false
+		case c == '/' && l.peek(1) == '*':
+			if l.inExecComment {
+				return ErrSyntax.New("nested comment at position %d", l.pos)
+			}
+			switch {
+			case l.peek(2) == '!':
+				// MySQL executable comment, optionally with a version number: /*!50100 ... */
+				l.pos += 3
+				for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+					l.pos++
+				}
+				l.inExecComment = true
+			case l.peek(2) == 'T' && l.peek(3) == '!':
+				// TiDB executable comment, optionally with feature IDs: /*T![clustered_index] ... */
+				l.pos += 4
+				if l.peek(0) == '[' {
+					end := strings.IndexByte(l.src[l.pos:], ']')
+					if end < 0 {
+						return ErrSyntax.New("unterminated comment at position %d", l.pos)
+					}
+					l.pos += end + 1
+				}
+				l.inExecComment = true
+			default:
+				// Ordinary comments and optimizer hints.
+				end := strings.Index(l.src[l.pos+2:], "*/")
+				if end < 0 {
+					return ErrSyntax.New("unterminated comment at position %d", l.pos)
+				}
+				l.pos += end + 4
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// scanQuoted skips a quoted string or identifier starting at the quote. Quotes can be escaped by doubling, and
+// by backslash except in identifiers or under NO_BACKSLASH_ESCAPES.
+func (l *lexer) scanQuoted() error {
+	quote := l.src[l.pos]
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && quote != '`' && !l.noBackslashEscapes && l.pos+1 < len(l.src):
+			l.pos += 2
+		case c == quote && l.peek(1) == quote:
+			l.pos += 2
+		case c == quote:
+			l.pos++
+			return nil
+		default:
+			l.pos++
+		}
+	}
+	return ErrSyntax.New("unterminated quoted string at position %d", start)
+}
+
+func (l *lexer) scanWord() {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isWordRune(r) {
+			break
+		}
+		l.pos += size
+	}
+}
+
+// next scans the next token, which starts at the returned offset and ends at l.pos. isCode is true for words and
+// punctuations, and false for strings, quoted identifiers and variables. It returns false at the end of the input.
+func (l *lexer) next() (start int, isCode bool, ok bool, err error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return 0, false, false, err
+	}
+	if l.pos >= len(l.src) {
+		if l.inExecComment {
+			return 0, false, false, ErrSyntax.New("unterminated comment")
+		}
+		return 0, false, false, nil
+	}
+	start = l.pos
+	switch c := l.src[l.pos]; c {
+	case '\'', '"', '`':
+		err = l.scanQuoted()
+	case '@':
+		l.pos++
+		for l.peek(0) == '@' {
+			l.pos++
+		}
+		if q := l.peek(0); q == '\'' || q == '"' || q == '`' {
+			err = l.scanQuoted()
+		} else {
+			l.scanWord()
+		}
+	default:
+		isCode = true
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if isWordRune(r) {
+			l.scanWord()
+		} else {
+			l.pos += size
+		}
+	}
+	if err != nil {
+		return 0, false, false, err
+	}
+	return start, isCode, true, nil
+}
+
+// Mask replaces the content of strings, quoted identifiers, variables and comments in the SQL by spaces, keeping
+// the offsets, so that only the code is left. The content of executable comments is code. Backslashes escape
+// quotes in strings, unless noBackslashEscapes is set as the NO_BACKSLASH_ESCAPES SQL mode.
+func Mask(sql string, noBackslashEscapes bool) (string, error) {
+	l := &lexer{src: sql, noBackslashEscapes: noBackslashEscapes}
+	masked := []byte(strings.Repeat(" ", len(sql)))
+	for {
+		start, isCode, ok, err := l.next()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		if isCode {
+			copy(masked[start:l.pos], sql[start:l.pos])
+		}
+	}
+	return string(masked), nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package sqlutil
+
+import (
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexer(t *testing.T) {
+	masked, err := Mask("select 'it''s', \"a\\\"b\", 'c\\';' from t -- comment;\n /* ; */ `a;b`; # x;\n @@x", false)
+	require.NoError(t, err)
+	require.Equal(t, "select        ,       ,        from t                           ;          ", masked)
+
+	// Executable comments are code.
+	masked, err = Mask("/*!40101 SET */ /*T![clustered_index] DELETE */ /*+ hint */", false)
+	require.NoError(t, err)
+	require.Equal(t, "         SET                          DELETE               ", masked)
+
+	for _, sql := range []string{"select 'a", "select `a", "select /* a", "/*! select 1"} {
+		_, err := Mask(sql, false)
+		require.Error(t, err, sql)
+		require.True(t, errorx.IsOfType(err, ErrSyntax), sql)
+	}
+}
+
+func TestMask(t *testing.T) {
+	masked, err := Mask("select 'a{{p}}', `{{p}}`, @\"x\" -- {{p}}\nfrom t /* c */ where a = {{p}} /*! and b */", false)
+	require.NoError(t, err)
+	require.Equal(t, "select         ,        ,               from t         where a = {{p}}     and b   ", masked)
+
+	// A backslash does not escape the quote under NO_BACKSLASH_ESCAPES.
+	sql := `select 'a\'; delete from t; -- '`
+	masked, err = Mask(sql, false)
+	require.NoError(t, err)
+	require.Equal(t, "select                          ", masked)
+	masked, err = Mask(sql, true)
+	require.NoError(t, err)
+	require.Equal(t, "select     ; delete from t;     ", masked)
+
+	_, err = Mask(`select 'a\'`, false)
+	require.Error(t, err)
+	_, err = Mask(`select 'a\'`, true)
+	require.NoError(t, err)
+}
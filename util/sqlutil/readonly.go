@@ -0,0 +1,117 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package sqlutil
+
+import (
+	"strings"
+
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/mysql"
+
+	// Required by the parser to create the literal values.
+	_ "github.com/pingcap/tidb/parser/test_driver"
+)
+
+// Functions that change the state of the database or the session, even in a SELECT statement.
+var mutatingFuncs = map[string]bool{
+	ast.NextVal:         true,
+	ast.SetVal:          true,
+	ast.GetLock:         true,
+	ast.ReleaseLock:     true,
+	ast.ReleaseAllLocks: true,
+}
+
+// FirstMutating parses the SQL as TiDB does in the SQL mode, and returns the text of the first statement that is
+// not read-only without the trailing semicolon, or an empty string if all statements are read-only. SQL which cannot be parsed is an error, as
+// the SQL mode, e.g. NO_BACKSLASH_ESCAPES and ANSI_QUOTES, changes how the statements are split.
+func FirstMutating(sql string, sqlMode mysql.SQLMode) (string, error) {
+	statements, err := parse(sql, sqlMode)
+	if err != nil {
+		return "", err
+	}
+	for _, stmt := range statements {
+		if !IsReadOnly(stmt) {
+			return StatementText(stmt), nil
+		}
+	}
+	return "", nil
+}
+
+// ParseOne parses the SQL as TiDB does in the SQL mode. The SQL must contain exactly one statement.
+func ParseOne(sql string, sqlMode mysql.SQLMode) (ast.StmtNode, error) {
+	statements, err := parse(sql, sqlMode)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) != 1 {
+		return nil, ErrSyntax.New("expect a single statement, but got %d", len(statements))
+	}
+	return statements[0], nil
+}
+
+// StatementText returns the text of the parsed statement without the trailing semicolon.
+func StatementText(stmt ast.StmtNode) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt.Text()), ";"))
+}
+
+func parse(sql string, sqlMode mysql.SQLMode) ([]ast.StmtNode, error) {
+	p := parser.New()
+	p.SetSQLMode(sqlMode)
+	statements, _, err := p.Parse(sql, "", "")
+	if err != nil {
+		return nil, ErrSyntax.Wrap(err, "cannot parse the statements")
+	}
+	return statements, nil
+}
+
+// IsReadOnly returns whether the statement only reads data. Only SELECT, TABLE, VALUES and their set operations,
+// SHOW, EXPLAIN and DESC are allowed. Queries must not lock rows, write files, assign variables or call functions
+// which change the state, e.g. `SELECT ... FOR UPDATE` and `SELECT nextval(s)`. EXPLAIN ANALYZE executes the
+// statement, so that the statement must be read-only too.
+func IsReadOnly(stmt ast.StmtNode) bool {
+	switch s := stmt.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		v := &readOnlyQueryVisitor{readOnly: true}
+		stmt.Accept(v)
+		return v.readOnly
+	case *ast.ShowStmt, *ast.ExplainForStmt:
+		return true
+	case *ast.ExplainStmt:
+		return !s.Analyze || IsReadOnly(s.Stmt)
+	default:
+		return false
+	}
+}
+
+// readOnlyQueryVisitor checks the query blocks and expressions in a query, including the subqueries and common
+// table expressions.
+type readOnlyQueryVisitor struct {
+	readOnly bool
+}
+
+func (v *readOnlyQueryVisitor) Enter(n ast.Node) (ast.Node, bool) {
+	switch n := n.(type) {
+	case *ast.SelectStmt:
+		if n.LockInfo != nil && n.LockInfo.LockType != ast.SelectLockNone {
+			v.readOnly = false
+		}
+		if n.SelectIntoOpt != nil {
+			v.readOnly = false
+		}
+	case *ast.VariableExpr:
+		// `@a := 1`
+		if n.Value != nil {
+			v.readOnly = false
+		}
+	case *ast.FuncCallExpr:
+		if mutatingFuncs[n.FnName.L] {
+			v.readOnly = false
+		}
+	}
+	return n, !v.readOnly
+}
+
+func (v *readOnlyQueryVisitor) Leave(n ast.Node) (ast.Node, bool) {
+	return n, v.readOnly
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package sqlutil
+
+import (
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	cases := []struct {
+		sql      string
+		readOnly bool
+	}{
+		{"SELECT * FROM t", true},
+		{"select * from t lock in share mode", false},
+		{"(select 1) union (select 2)", true},
+		{"/*+ hint */ select 1", true},
+		{"select /*+ use_index(t, a) */ * from t", true},
+		{"table t", true},
+		{"values row(1, 2)", true},
+		{"with cte as (select 1) select * from cte", true},
+		{"with recursive cte(n) as (select 1 union all select n + 1 from cte where n < 10) select * from cte", true},
+		{"select * from t where a in (select b from t2)", true},
+		{"select @a, @@tidb_mem_quota_query, lastval(s)", true},
+		{"show databases", true},
+		{"SHOW CREATE TABLE t", true},
+		{"desc t", true},
+		{"describe t", true},
+		{"explain select * from t", true},
+		{"explain delete from t", true},
+		{"explain format = 'verbose' select 1", true},
+		{"explain analyze select * from t", true},
+		{"explain analyze format = 'brief' select * from t", true},
+		{"explain for connection 1", true},
+
+		{"select * from t for update", false},
+		{"select * from t for update nowait", false},
+		{"select * from t where a in (select b from t2 for update)", false},
+		{"(select 1) union (select * from t for share)", false},
+		{"with cte as (select * from t for update) select * from cte", false},
+		{"select nextval(s)", false},
+		{"select next value for s", false},
+		{"select setval(s, 10)", false},
+		{"select * from t where a = (select nextval(s))", false},
+		{"select get_lock('a', 1)", false},
+		{"select @a := 1", false},
+		{"select * from t into outfile '/tmp/t'", false},
+		{"explain analyze delete from t", false},
+		{"explain analyze select * from t for update", false},
+		{"desc analyze update t set a = 1", false},
+		{"with cte as (select 1) delete from t", false},
+		{"with cte as (select 1) update t, cte set t.a = 1", false},
+		{"insert into t select * from t2", false},
+		{"update t set a = 1", false},
+		{"delete from t", false},
+		{"replace into t values (1)", false},
+		{"create table t (a int)", false},
+		{"drop table t", false},
+		{"set global tidb_mem_quota_query = 1", false},
+		{"admin check table t", false},
+		{"trace select 1", false},
+		{"use test", false},
+		{"/*!40101 delete from t */", false},
+		{"/*T![clustered_index] drop table t */", false},
+		{"-- select\ndelete from t", false},
+	}
+	for _, c := range cases {
+		stmt, err := FirstMutating(c.sql, mysql.ModeNone)
+		require.NoError(t, err, c.sql)
+		require.Equal(t, c.readOnly, stmt == "", c.sql)
+	}
+}
+
+func TestFirstMutating(t *testing.T) {
+	stmt, err := FirstMutating("select 1; show tables; delete from t where a = ';'; drop table t", mysql.ModeNone)
+	require.NoError(t, err)
+	require.Equal(t, "delete from t where a = ';'", stmt)
+
+	stmt, err = FirstMutating("select 1; explain select 2;", mysql.ModeNone)
+	require.NoError(t, err)
+	require.Empty(t, stmt)
+
+	// The statements are split following the SQL mode.
+	sql := `SELECT 'a\'; DELETE FROM t; -- '`
+	stmt, err = FirstMutating(sql, mysql.ModeNone)
+	require.NoError(t, err)
+	require.Empty(t, stmt)
+	stmt, err = FirstMutating(sql, mysql.ModeNoBackslashEscapes)
+	require.NoError(t, err)
+	require.Equal(t, "DELETE FROM t", stmt)
+
+	sql = `SELECT "a"; DELETE FROM t`
+	stmt, err = FirstMutating(sql, mysql.ModeANSIQuotes)
+	require.NoError(t, err)
+	require.Equal(t, "DELETE FROM t", stmt)
+
+	for _, sql := range []string{"select 'a", "selectx 1", "select 1; delete", "`select` 1"} {
+		_, err := FirstMutating(sql, mysql.ModeNone)
+		require.Error(t, err, sql)
+		require.True(t, errorx.IsOfType(err, ErrSyntax), sql)
+	}
+}
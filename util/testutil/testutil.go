@@ -13,6 +13,7 @@ import (
 func TestMain(m *testing.M) {
 	EnableDebugLog()
 	gin.SetMode(gin.TestMode)
-	goleak.VerifyTestMain(m)
+	// The zstd decoders are started on init by the compression library of the Parquet exports.
+	goleak.VerifyTestMain(m, goleak.IgnoreTopFunction("github.com/klauspost/compress/zstd.(*blockDec).startDecoder"))
 	runtime.GC()
 }
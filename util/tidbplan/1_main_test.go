@@ -0,0 +1,13 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+
+	"github.com/pingcap/tidb-dashboard/util/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.TestMain(m)
+}
@@ -0,0 +1,283 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+)
+
+var ErrInvalidRule = ErrNS.NewType("invalid_rule")
+
+// Severity is how much a suggestion is expected to improve the plan.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+func (s Severity) weight() int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Rule is an advisor rule evaluated against each operator of a plan.
+//
+// Condition is an expr (https://github.com/antonmedv/expr) expression over RuleNode, which must return a bool,
+// e.g. `Type == "Sort" and DiskBytes > 0`. Message is a text/template over the same RuleNode, with the extra
+// functions `rows`, `bytes` and `duration` to format the values.
+type Rule struct {
+	Name      string   `json:"name"`
+	Severity  Severity `json:"severity"`
+	Condition string   `json:"condition"`
+	Message   string   `json:"message"`
+}
+
+// RuleNode is the environment of the rule expressions. Fields of the related operators are accessed through
+// Parent, Build, Probe and Children. The related operators may be absent, so that they must be checked
+// by HasParent, HasBuild and HasProbe first.
+type RuleNode struct {
+	ID    string
+	Type  string
+	Task  string
+	Table string // The table accessed by the operator, empty if the operator does not access a table
+	// Role is "build" or "probe" for the children of joins and readers, otherwise empty.
+	Role     string
+	EstRows  float64
+	ActRows  float64
+	Executed bool
+	// Rows is the actual rows when the plan is executed, otherwise the estimated rows.
+	Rows  float64
+	Loops int64
+	// Time is the execution time of the operator including its children, ExclusiveTime excludes the
+	// children, and TimeRatio is ExclusiveTime divided by the execution time of the whole plan.
+	Time          time.Duration
+	ExclusiveTime time.Duration
+	TimeRatio     float64
+	MemoryBytes   int64
+	DiskBytes     int64
+	// CopTasks, CopWaitTime and CopProcessTime are the total of the coprocessor tasks sent by a reader.
+	CopTasks       int64
+	CopWaitTime    time.Duration
+	CopProcessTime time.Duration
+	QError         float64 // 0 if the plan is not executed
+
+	HasParent bool
+	Parent    *RuleNode
+	HasBuild  bool
+	Build     *RuleNode
+	HasProbe  bool
+	Probe     *RuleNode
+	Children  []*RuleNode
+}
+
+func newRuleNode(node *Node, parent *RuleNode, planTime time.Duration) *RuleNode {
+	r := &RuleNode{
+		ID:            node.ID,
+		Type:          node.Type,
+		Task:          node.Task,
+		Table:         AccessTable(node.AccessObject),
+		EstRows:       node.EstRows,
+		Executed:      node.ActRows != nil,
+		Rows:          nodeRows(node),
+		Loops:         operatorLoops(node),
+		Time:          node.TotalTime,
+		ExclusiveTime: node.ExclusiveTime,
+		Parent:        parent,
+		HasParent:     parent != nil,
+		Children:      make([]*RuleNode, 0, len(node.Children)),
+	}
+	switch {
+	case strings.HasSuffix(node.ID, "(Build)"):
+		r.Role = "build"
+	case strings.HasSuffix(node.ID, "(Probe)"):
+		r.Role = "probe"
+	}
+	if node.ActRows != nil {
+		r.ActRows = *node.ActRows
+		r.QError = QError(node.EstRows, *node.ActRows)
+	}
+	if planTime > 0 {
+		r.TimeRatio = float64(node.ExclusiveTime) / float64(planTime)
+	}
+	if node.MemoryBytes != nil {
+		r.MemoryBytes = *node.MemoryBytes
+	}
+	if node.DiskBytes != nil {
+		r.DiskBytes = *node.DiskBytes
+	}
+	if stats := node.RuntimeStats; stats != nil && stats.CopTask != nil {
+		r.CopTasks = stats.CopTask.Num
+		r.CopWaitTime = stats.CopTask.TotWait
+		r.CopProcessTime = stats.CopTask.TotProc
+	}
+
+	for _, child := range node.Children {
+		c := newRuleNode(child, r, planTime)
+		r.Children = append(r.Children, c)
+		switch c.Role {
+		case "build":
+			r.Build, r.HasBuild = c, true
+		case "probe":
+			r.Probe, r.HasProbe = c, true
+		}
+	}
+	return r
+}
+
+func (r *RuleNode) walk(fn func(node *RuleNode)) {
+	fn(r)
+	for _, child := range r.Children {
+		child.walk(fn)
+	}
+}
+
+var messageFuncs = template.FuncMap{
+	"rows":     formatRows,
+	"bytes":    FormatBytes,
+	"duration": func(d time.Duration) string { return d.Round(time.Microsecond).String() },
+}
+
+// CompiledRule is a rule whose condition and message are compiled.
+type CompiledRule struct {
+	Rule
+	condition *vm.Program
+	message   *template.Template
+}
+
+// CompileRule validates and compiles the rule.
+func CompileRule(rule Rule) (*CompiledRule, error) {
+	if rule.Name == "" {
+		return nil, ErrInvalidRule.New("rule name is missing")
+	}
+	switch rule.Severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return nil, ErrInvalidRule.New("rule %s has unknown severity %s", rule.Name, rule.Severity)
+	}
+	condition, err := expr.Compile(rule.Condition, expr.Env(&RuleNode{}), expr.AsBool())
+	if err != nil {
+		return nil, ErrInvalidRule.Wrap(err, "rule %s has invalid condition", rule.Name)
+	}
+	message, err := template.New(rule.Name).Funcs(messageFuncs).Option("missingkey=error").Parse(rule.Message)
+	if err != nil {
+		return nil, ErrInvalidRule.Wrap(err, "rule %s has invalid message", rule.Name)
+	}
+	return &CompiledRule{Rule: rule, condition: condition, message: message}, nil
+}
+
+// match returns the message when the node matches the rule. Rules that fail on the node, e.g. accessing the
+// parent of the root, are considered not matched.
+func (r *CompiledRule) match(node *RuleNode) (string, bool) {
+	out, err := expr.Run(r.condition, node)
+	if err != nil {
+		return "", false
+	}
+	if matched, _ := out.(bool); !matched {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := r.message.Execute(&buf, node); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// DefaultRules are the built-in advisor rules.
+var DefaultRules = []Rule{
+	{
+		Name:     "selective_full_scan",
+		Severity: SeverityCritical,
+		Condition: `Type == "TableFullScan" and Rows >= 10000 and HasParent and Parent.Type == "Selection" and ` +
+			`Parent.Rows * 10 <= Rows`,
+		Message: "Table {{.Table}} is fully scanned for {{rows .Rows}}, but only {{rows .Parent.Rows}} pass " +
+			"the filter. Consider adding an index on the filtered columns.",
+	},
+	{
+		Name:      "index_lookup_double_read",
+		Severity:  SeverityWarning,
+		Condition: `Type == "IndexLookUp" and HasProbe and Probe.Rows >= 100000`,
+		Message: "{{.ID}} looks up {{rows .Probe.Rows}} from table {{.Probe.Table}} after reading the index. " +
+			"Consider a covering index to avoid the double read, or a table scan if most rows are read.",
+	},
+	{
+		Name:     "hash_join_build_larger",
+		Severity: SeverityWarning,
+		Condition: `Type == "HashJoin" and HasBuild and HasProbe and Build.Rows >= 10000 and ` +
+			`Build.Rows > Probe.Rows * 2`,
+		Message: "The build side of {{.ID}} ({{rows .Build.Rows}}) is larger than its probe side " +
+			"({{rows .Probe.Rows}}). Consider updating the statistics, or swapping the sides by the HASH_JOIN_BUILD hint.",
+	},
+	{
+		Name:      "cop_wait_dominates",
+		Severity:  SeverityWarning,
+		Condition: `CopTasks > 0 and CopWaitTime > CopProcessTime and CopWaitTime >= 100000000`,
+		Message: "The coprocessor tasks of {{.ID}} wait {{duration .CopWaitTime}} but only process " +
+			"{{duration .CopProcessTime}}. The TiKV nodes may be busy or the read pool is too small.",
+	},
+	{
+		Name:      "disk_spill",
+		Severity:  SeverityCritical,
+		Condition: `Type in ["Sort", "TopN", "HashAgg", "HashJoin"] and DiskBytes > 0`,
+		Message: "{{.ID}} spills {{bytes .DiskBytes}} to disk. Consider raising tidb_mem_quota_query, " +
+			"or reducing the rows by a more selective filter.",
+	},
+}
+
+// Suggestion is a rule matched on an operator.
+type Suggestion struct {
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	ID        string   `json:"id"`
+	Message   string   `json:"message"`
+	TimeRatio float64  `json:"time_ratio"`
+}
+
+// Advise evaluates the rules against each operator of the plan, including the CTEs, and returns the
+// suggestions ranked by the severity and then the share of the execution time.
+func (p *Plan) Advise(rules []*CompiledRule) []Suggestion {
+	suggestions := make([]Suggestion, 0)
+	if p == nil || p.Root == nil {
+		return suggestions
+	}
+	if p.Analysis == nil {
+		p.Analyze(DefaultTopN)
+	}
+	for _, tree := range append([]*Node{p.Root}, p.CTEs...) {
+		newRuleNode(tree, nil, p.Analysis.TotalTime).walk(func(node *RuleNode) {
+			for _, rule := range rules {
+				if message, ok := rule.match(node); ok {
+					suggestions = append(suggestions, Suggestion{
+						Rule:      rule.Name,
+						Severity:  rule.Severity,
+						ID:        node.ID,
+						Message:   message,
+						TimeRatio: node.TimeRatio,
+					})
+				}
+			}
+		})
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Severity.weight() != b.Severity.weight() {
+			return a.Severity.weight() > b.Severity.weight()
+		}
+		return a.TimeRatio > b.TimeRatio
+	})
+	return suggestions
+}
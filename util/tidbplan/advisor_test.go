@@ -0,0 +1,78 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func mustCompileRules(t *testing.T, rules []Rule) []*CompiledRule {
+	compiled := make([]*CompiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := CompileRule(rule)
+		require.NoError(t, err)
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+func TestAdvise(t *testing.T) {
+	plan, err := Parse("\tid\ttask\testRows\taccess object\toperator info\tmemory\tdisk\n" +
+		"\tSort_5\troot\t500\t\ttest.t1.a\t1 GB\t300 MB\n" +
+		"\t└─HashJoin_8\troot\t500\t\tinner join\tN/A\tN/A\n" +
+		"\t  ├─TableReader_11(Build)\troot\t200000\t\tdata:TableFullScan_10\tN/A\tN/A\n" +
+		"\t  │ └─TableFullScan_10\tcop[tikv]\t200000\ttable:t2\tkeep order:false\tN/A\tN/A\n" +
+		"\t  └─TableReader_14(Probe)\troot\t1000\t\tdata:Selection_13\tN/A\tN/A\n" +
+		"\t    └─Selection_13\tcop[tikv]\t1000\t\teq(test.t1.b, 1)\tN/A\tN/A\n" +
+		"\t      └─TableFullScan_12\tcop[tikv]\t1000000\ttable:t1\tkeep order:false\tN/A\tN/A\n")
+	require.NoError(t, err)
+
+	suggestions := plan.Advise(mustCompileRules(t, DefaultRules))
+	require.Len(t, suggestions, 3)
+	require.Equal(t, "disk_spill", suggestions[0].Rule)
+	require.Equal(t, "Sort_5", suggestions[0].ID)
+	require.Equal(t, "Sort_5 spills 300 MB to disk. Consider raising tidb_mem_quota_query, "+
+		"or reducing the rows by a more selective filter.", suggestions[0].Message)
+	require.Equal(t, "selective_full_scan", suggestions[1].Rule)
+	require.Equal(t, "TableFullScan_12", suggestions[1].ID)
+	require.Equal(t, "Table t1 is fully scanned for 1000000 rows, but only 1000 rows pass the filter. "+
+		"Consider adding an index on the filtered columns.", suggestions[1].Message)
+	require.Equal(t, SeverityWarning, suggestions[2].Severity)
+	require.Equal(t, "hash_join_build_larger", suggestions[2].Rule)
+	require.Equal(t, "HashJoin_8", suggestions[2].ID)
+
+	// Custom rules are evaluated the same way. Accessing the absent parent of the root is not matched.
+	custom := mustCompileRules(t, []Rule{{
+		Name:      "root_reader",
+		Severity:  SeverityInfo,
+		Condition: `Parent.Type == "HashJoin" and len(Children) == 1`,
+		Message:   "{{.ID}} reads {{rows .Rows}} for {{.Parent.ID}}",
+	}})
+	suggestions = plan.Advise(custom)
+	require.Len(t, suggestions, 2)
+	require.Equal(t, "TableReader_11(Build) reads 200000 rows for HashJoin_8", suggestions[0].Message)
+	require.Equal(t, "TableReader_14(Probe)", suggestions[1].ID)
+}
+
+func TestCompileRuleInvalid(t *testing.T) {
+	valid := Rule{Name: "r", Severity: SeverityInfo, Condition: `Rows > 1`, Message: "{{.ID}}"}
+	_, err := CompileRule(valid)
+	require.NoError(t, err)
+
+	for _, modify := range []func(r *Rule){
+		func(r *Rule) { r.Name = "" },
+		func(r *Rule) { r.Severity = "fatal" },
+		func(r *Rule) { r.Condition = `Rows +` },
+		func(r *Rule) { r.Condition = `Rows` },
+		func(r *Rule) { r.Condition = `NoSuchField > 1` },
+		func(r *Rule) { r.Message = "{{.ID" },
+	} {
+		rule := valid
+		modify(&rule)
+		_, err := CompileRule(rule)
+		require.True(t, errorx.IsOfType(err, ErrInvalidRule), "%+v", rule)
+	}
+}
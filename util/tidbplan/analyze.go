@@ -0,0 +1,268 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTopN is the default number of hot operators reported by Analyze.
+const DefaultTopN = 5
+
+// HotOperator is an operator ranked by its exclusive time.
+type HotOperator struct {
+	ID            string        `json:"id"`
+	ExclusiveTime time.Duration `json:"exclusive_time"`
+	Loops         int64         `json:"loops"`
+	// Ratio is the exclusive time divided by the total time of the plan.
+	Ratio float64 `json:"ratio"`
+}
+
+// Analysis is the time distribution of an executed plan.
+type Analysis struct {
+	// HasRuntimeStats is false when the plan is not executed, e.g. a plain EXPLAIN. In this case,
+	// the critical path is chosen by the estimated rows.
+	HasRuntimeStats bool          `json:"has_runtime_stats"`
+	TotalTime       time.Duration `json:"total_time"`
+	CriticalPath    []string      `json:"critical_path"`
+	HotOperators    []HotOperator `json:"hot_operators"`
+}
+
+// Analyze computes the total and exclusive time of each operator, marks the most expensive root-to-leaf path
+// and ranks the topN operators by exclusive time. The result is filled into the nodes and the plan. The CTEs
+// are timed and ranked as well, while the critical path only follows the plan tree.
+//
+// The execution time of an operator is cumulative over all of its loops. For operators in the root task it
+// is the `time` field. For coprocessor operators it is the slowest task (`proc max`), as tasks run concurrently.
+// When an operator runs its children concurrently, i.e. it has more than one worker, or the children are in
+// another task, only the slowest child is subtracted. Otherwise the time of all children is subtracted.
+//
+// Loops are not scaled: TiDB accumulates the time of a root operator over all of its loops, including the
+// re-executions on the inner side of loop joins (IndexJoin, IndexHashJoin, IndexMergeJoin and Apply), so that
+// it is comparable with the time of its parent. However, the inner side may be executed by several workers
+// at the same time, whose time is also accumulated. The time of the root operators on the inner side is divided
+// by the number of inner workers, so that it does not exceed the time of the join.
+//
+// Operators in TiFlash MPP tasks are also grouped into fragments, see GroupMPPFragments.
+func (p *Plan) Analyze(topN int) *Analysis {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+	analysis := &Analysis{
+		CriticalPath: make([]string, 0),
+		HotOperators: make([]HotOperator, 0),
+	}
+	if p == nil || p.Root == nil {
+		p.setAnalysis(analysis)
+		return analysis
+	}
+
+	p.walkAll(func(node *Node, _ int) bool {
+		node.TotalTime = operatorTime(node)
+		if node.TotalTime > 0 {
+			analysis.HasRuntimeStats = true
+		}
+		return true
+	})
+	normalizeLoopJoinInner(p.Root, 1)
+	for _, cte := range p.CTEs {
+		normalizeLoopJoinInner(cte, 1)
+	}
+
+	p.walkAll(func(node *Node, _ int) bool {
+		node.ExclusiveTime = exclusiveTime(node)
+		return true
+	})
+	analysis.TotalTime = p.Root.TotalTime
+
+	// Critical path: descend from the root into the most expensive child.
+	cost := func(n *Node) float64 {
+		if analysis.HasRuntimeStats {
+			return float64(n.TotalTime)
+		}
+		return n.EstRows
+	}
+	for node := p.Root; node != nil; {
+		node.OnCriticalPath = true
+		analysis.CriticalPath = append(analysis.CriticalPath, node.ID)
+		var next *Node
+		for _, child := range node.Children {
+			if next == nil || cost(child) > cost(next) {
+				next = child
+			}
+		}
+		node = next
+	}
+
+	if analysis.HasRuntimeStats {
+		var nodes []*Node
+		p.walkAll(func(node *Node, _ int) bool {
+			if node.ExclusiveTime > 0 {
+				nodes = append(nodes, node)
+			}
+			return true
+		})
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].ExclusiveTime > nodes[j].ExclusiveTime
+		})
+		if len(nodes) > topN {
+			nodes = nodes[:topN]
+		}
+		for _, node := range nodes {
+			hot := HotOperator{
+				ID:            node.ID,
+				ExclusiveTime: node.ExclusiveTime,
+				Loops:         operatorLoops(node),
+			}
+			if analysis.TotalTime > 0 {
+				hot.Ratio = float64(node.ExclusiveTime) / float64(analysis.TotalTime)
+			}
+			analysis.HotOperators = append(analysis.HotOperators, hot)
+		}
+	}
+
+	p.GroupMPPFragments()
+	p.setAnalysis(analysis)
+	return analysis
+}
+
+func (p *Plan) setAnalysis(analysis *Analysis) {
+	if p != nil {
+		p.Analysis = analysis
+	}
+}
+
+// operatorTime returns the cumulative execution time of the operator, or 0 if unknown.
+func operatorTime(node *Node) time.Duration {
+	stats := node.RuntimeStats
+	if stats == nil {
+		return 0
+	}
+	if stats.Time > 0 {
+		return stats.Time
+	}
+	for _, task := range []*TaskStats{stats.TiKVTask, stats.TiFlashTask} {
+		if task == nil {
+			continue
+		}
+		if task.ProcMax > 0 {
+			return task.ProcMax
+		}
+		if task.Time > 0 {
+			return task.Time
+		}
+	}
+	return 0
+}
+
+func operatorLoops(node *Node) int64 {
+	stats := node.RuntimeStats
+	if stats == nil {
+		return 0
+	}
+	if stats.Loops > 0 {
+		return stats.Loops
+	}
+	for _, task := range []*TaskStats{stats.TiKVTask, stats.TiFlashTask} {
+		if task != nil && task.Loops > 0 {
+			return task.Loops
+		}
+		if task != nil && task.Iters > 0 {
+			return task.Iters
+		}
+	}
+	return 0
+}
+
+// Operators on the inner side of these joins are executed for each batch of the outer rows.
+var loopJoinTypes = map[string]bool{
+	"IndexJoin":      true,
+	"IndexHashJoin":  true,
+	"IndexMergeJoin": true,
+	"Apply":          true,
+}
+
+// innerWorkers returns the number of workers executing the inner side of a loop join, e.g.
+// `inner:{total:3.5s, concurrency:5, ...}` of index joins or `Concurrency:5` of Apply.
+func innerWorkers(node *Node) int64 {
+	stats := node.RuntimeStats
+	if stats == nil {
+		return 1
+	}
+	if n := stats.Lookup("inner", "concurrency").Int(); n > 1 {
+		return n
+	}
+	if stats.Concurrency > 1 {
+		return stats.Concurrency
+	}
+	return 1
+}
+
+// normalizeLoopJoinInner divides the accumulated time of the root operators on the inner side of loop joins by
+// the number of inner workers. Coprocessor operators are not affected, as their time is the slowest task.
+func normalizeLoopJoinInner(node *Node, workers int64) {
+	if workers > 1 && taskClass(node.Task) == "root" {
+		node.TotalTime /= time.Duration(workers)
+	}
+	for _, child := range node.Children {
+		childWorkers := workers
+		if loopJoinTypes[node.Type] && child.Label() == "Probe" {
+			childWorkers *= innerWorkers(node)
+		}
+		normalizeLoopJoinInner(child, childWorkers)
+	}
+}
+
+func exclusiveTime(node *Node) time.Duration {
+	if len(node.Children) == 0 {
+		return node.TotalTime
+	}
+	var childrenTime time.Duration
+	if runsChildrenConcurrently(node) {
+		for _, child := range node.Children {
+			if child.TotalTime > childrenTime {
+				childrenTime = child.TotalTime
+			}
+		}
+	} else {
+		for _, child := range node.Children {
+			childrenTime += child.TotalTime
+		}
+	}
+	if childrenTime >= node.TotalTime {
+		return 0
+	}
+	return node.TotalTime - childrenTime
+}
+
+// taskClass returns the task without the store type, e.g. `cop[tikv]` => `cop`.
+func taskClass(task string) string {
+	if idx := strings.IndexByte(task, '['); idx >= 0 {
+		return task[:idx]
+	}
+	return task
+}
+
+func runsChildrenConcurrently(node *Node) bool {
+	for _, child := range node.Children {
+		if taskClass(child.Task) != taskClass(node.Task) {
+			return true
+		}
+	}
+	stats := node.RuntimeStats
+	if stats == nil {
+		return false
+	}
+	if stats.Concurrency > 1 {
+		return true
+	}
+	// Worker groups like `partial_worker:{concurrency:5, ...}` or `table_task: {num: 1, concurrency: 5}`.
+	for i := range stats.Items {
+		if stats.Items[i].Kind == StatsKindGroup && stats.Items[i].Lookup("concurrency").Int() > 1 {
+			return true
+		}
+	}
+	return false
+}
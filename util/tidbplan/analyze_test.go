@@ -0,0 +1,114 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	analysis := plan.Analyze(3)
+
+	require.True(t, analysis.HasRuntimeStats)
+	require.Equal(t, 13400*time.Millisecond, analysis.TotalTime)
+	require.Equal(t, []string{
+		"Sort_6", "Projection_8", "HashAgg_9", "TableReader_10", "HashAgg_11", "Selection_13", "TableFullScan_12",
+	}, analysis.CriticalPath)
+	require.Same(t, analysis, plan.Analysis)
+
+	require.Len(t, analysis.HotOperators, 3)
+	require.Equal(t, "TableReader_10", analysis.HotOperators[0].ID)
+	require.Equal(t, 13400*time.Millisecond-893*time.Millisecond, analysis.HotOperators[0].ExclusiveTime)
+	require.Equal(t, int64(4), analysis.HotOperators[0].Loops)
+	require.Equal(t, "TableFullScan_12", analysis.HotOperators[1].ID)
+	require.Equal(t, 760*time.Millisecond, analysis.HotOperators[1].ExclusiveTime)
+	require.Equal(t, "Selection_13", analysis.HotOperators[2].ID)
+	require.Equal(t, 111*time.Millisecond, analysis.HotOperators[2].ExclusiveTime)
+
+	// Sequential child: all time belongs to the child.
+	require.Equal(t, time.Duration(0), plan.Root.Children[0].ExclusiveTime)
+	require.True(t, plan.Root.Children[0].OnCriticalPath)
+}
+
+func TestAnalyzeConcurrentChildren(t *testing.T) {
+	plan := mustParseTestData(t, "hash_join.txt")
+	plan.Analyze(0)
+
+	join := plan.Root.Children[0]
+	// The probe side runs with 5 workers, so only the slowest child is subtracted.
+	require.Equal(t, 2050*time.Microsecond-1900*time.Microsecond, join.ExclusiveTime)
+	require.True(t, join.Children[1].OnCriticalPath)
+	require.False(t, join.Children[0].OnCriticalPath)
+}
+
+func TestAnalyzeLoopJoin(t *testing.T) {
+	plan, err := Parse("\tid\ttask\testRows\tactRows\texecution info\n" +
+		"\tIndexJoin_10\troot\t10\t10\ttime:1s, loops:3, inner:{total:3.5s, concurrency:5, task:10, construct:10ms, fetch:3.4s, build:1ms}, probe:20ms\n" +
+		"\t├─TableReader_20(Build)\troot\t10\t10\ttime:100ms, loops:2\n" +
+		"\t│ └─TableFullScan_19\tcop[tikv]\t10\t10\ttikv_task:{time:80ms, loops:2}\n" +
+		"\t└─IndexReader_9(Probe)\troot\t10\t10\ttime:3s, loops:20\n" +
+		"\t  └─IndexRangeScan_8\tcop[tikv]\t10\t10\ttikv_task:{proc max:5ms, loops:10}\n")
+	require.NoError(t, err)
+	analysis := plan.Analyze(5)
+
+	// The inner side is executed by 5 workers, so its accumulated time is divided by 5.
+	reader := plan.Root.Children[1]
+	require.Equal(t, 600*time.Millisecond, reader.TotalTime)
+	require.Equal(t, 595*time.Millisecond, reader.ExclusiveTime)
+	require.Equal(t, 5*time.Millisecond, reader.Children[0].TotalTime)
+	require.Equal(t, 400*time.Millisecond, plan.Root.ExclusiveTime)
+	for _, op := range analysis.HotOperators {
+		require.LessOrEqual(t, op.Ratio, 1.0)
+	}
+	require.Equal(t, []string{"IndexJoin_10", "IndexReader_9(Probe)", "IndexRangeScan_8"}, analysis.CriticalPath)
+
+	// A sequential Apply re-executes the inner side in its own goroutine. The inner time is accumulated over
+	// all loops, so it is subtracted as is.
+	plan, err = Parse("\tid\ttask\testRows\tactRows\texecution info\n" +
+		"\tApply_12\troot\t10\t10\ttime:2s, loops:2, Concurrency:OFF\n" +
+		"\t├─TableReader_14(Build)\troot\t10\t10\ttime:200ms, loops:2\n" +
+		"\t│ └─TableFullScan_13\tcop[tikv]\t10\t10\ttikv_task:{time:150ms, loops:2}\n" +
+		"\t└─TableReader_17(Probe)\troot\t10\t10\ttime:1.5s, loops:1000\n" +
+		"\t  └─TableFullScan_16\tcop[tikv]\t10\t10\ttikv_task:{proc max:2ms, loops:1000}\n")
+	require.NoError(t, err)
+	plan.Analyze(5)
+	require.Equal(t, 1500*time.Millisecond, plan.Root.Children[1].TotalTime)
+	require.Equal(t, 300*time.Millisecond, plan.Root.ExclusiveTime)
+}
+
+func TestAnalyzeWithoutRuntimeStats(t *testing.T) {
+	plan, err := Parse("\tid\ttask\testRows\toperator info\n" +
+		"\tHashJoin_8\troot\t12.5\tinner join\n" +
+		"\t├─TableReader_11(Build)\troot\t10\tdata:TableFullScan_10\n" +
+		"\t│ └─TableFullScan_10\tcop[tikv]\t10\ttable:t2\n" +
+		"\t└─TableReader_13(Probe)\troot\t10000\tdata:TableFullScan_12\n" +
+		"\t  └─TableFullScan_12\tcop[tikv]\t10000\ttable:t1\n")
+	require.NoError(t, err)
+	analysis := plan.Analyze(5)
+	require.False(t, analysis.HasRuntimeStats)
+	require.Equal(t, []string{"HashJoin_8", "TableReader_13(Probe)", "TableFullScan_12"}, analysis.CriticalPath)
+	require.Empty(t, analysis.HotOperators)
+}
+
+func TestAnalyzeCTE(t *testing.T) {
+	plan, err := Parse("\tid\ttask\testRows\tactRows\texecution info\n" +
+		"\tProjection_10\troot\t10\t10\ttime:1s, loops:2\n" +
+		"\t└─CTEFullScan_12\troot\t10\t10\ttime:900ms, loops:2\n")
+	require.NoError(t, err)
+	cte, err := Parse("\tid\ttask\testRows\tactRows\texecution info\n" +
+		"\tCTE_0\troot\t10\t10\ttime:800ms, loops:2\n" +
+		"\t└─TableReader_20(Seed Part)\troot\t10\t10\ttime:50ms, loops:2\n")
+	require.NoError(t, err)
+	plan.CTEs = append(plan.CTEs, cte.Root)
+	analysis := plan.Analyze(5)
+
+	require.Equal(t, []string{"Projection_10", "CTEFullScan_12"}, analysis.CriticalPath)
+	require.Equal(t, 750*time.Millisecond, plan.CTEs[0].ExclusiveTime)
+	require.Equal(t, "CTEFullScan_12", analysis.HotOperators[0].ID)
+	require.Equal(t, "CTE_0", analysis.HotOperators[1].ID)
+	require.Len(t, analysis.HotOperators, 4)
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// planDiscardedEncoded is written by TiDB instead of the encoded plan when the plan is too long.
+const planDiscardedEncoded = "[discard]"
+
+// The task types in the encoded plan.
+const (
+	encodedTaskRoot = "0"
+	encodedTaskCop  = "1"
+	encodedTaskMpp  = "2"
+)
+
+// storeTypeNames is indexed by the store type in the encoded plan.
+var storeTypeNames = []string{"tikv", "tiflash", "tidb"}
+
+// operatorTypeNames is indexed by the operator type ID in the encoded plan. The IDs are kept stable by TiDB for
+// compatibility.
+var operatorTypeNames = []string{
+	"", // IDs start from 1
+	"Selection",
+	"Set",
+	"Projection",
+	"Aggregation",
+	"StreamAgg",
+	"HashAgg",
+	"Show",
+	"Join",
+	"Union",
+	"TableScan",
+	"MemTableScan",
+	"UnionScan",
+	"IndexScan",
+	"Sort",
+	"TopN",
+	"Limit",
+	"HashJoin",
+	"MergeJoin",
+	"IndexJoin",
+	"IndexMergeJoin",
+	"IndexHashJoin",
+	"Apply",
+	"MaxOneRow",
+	"Exists",
+	"TableDual",
+	"SelectLock",
+	"Insert",
+	"Update",
+	"Delete",
+	"IndexLookUp",
+	"TableReader",
+	"IndexReader",
+	"Window",
+	"TiKVSingleGather",
+	"IndexMerge",
+	"Point_Get",
+	"ShowDDLJobs",
+	"Batch_Point_Get",
+	"ClusterMemTableReader",
+	"DataSource",
+	"LoadData",
+	"TableSample",
+	"TableFullScan",
+	"TableRangeScan",
+	"TableRowIDScan",
+	"IndexFullScan",
+	"IndexRangeScan",
+	"ExchangeReceiver",
+	"ExchangeSender",
+	"CTEFullScan",
+	"CTE",
+	"CTETable",
+}
+
+// IsEncoded returns whether the plan is encoded by TiDB rather than the plain text, i.e. a single line of
+// base64 text, optionally wrapped by `tidb_decode_plan('...')` or `tidb_decode_binary_plan('...')`.
+func IsEncoded(plan string) bool {
+	plan = strings.TrimSpace(plan)
+	if plan == "" || strings.ContainsAny(plan, "\t\n") {
+		return false
+	}
+	if _, _, ok := unwrapDecodeFunc(plan); ok {
+		return true
+	}
+	_, err := base64.StdEncoding.DecodeString(plan)
+	return err == nil || plan == planDiscardedEncoded
+}
+
+// unwrapDecodeFunc strips the `tidb_decode_plan('...')` wrapper used in the slow log.
+func unwrapDecodeFunc(plan string) (funcName string, encoded string, ok bool) {
+	for _, name := range []string{"tidb_decode_plan", "tidb_decode_binary_plan"} {
+		prefix := name + "('"
+		if strings.HasPrefix(plan, prefix) && strings.HasSuffix(plan, "')") {
+			return name, plan[len(prefix) : len(plan)-2], true
+		}
+	}
+	return "", plan, false
+}
+
+// ParseEncoded decodes the plan encoded by TiDB in either the text format or the binary format, and parses it
+// into a plan tree, without the need of calling `tidb_decode_plan()` in TiDB.
+func ParseEncoded(plan string) (*Plan, error) {
+	funcName, encoded, _ := unwrapDecodeFunc(strings.TrimSpace(plan))
+	if funcName == "tidb_decode_binary_plan" {
+		return DecodeBinaryPlan(encoded)
+	}
+	text, err := DecodePlan(encoded)
+	if err != nil {
+		if funcName == "" {
+			// Without the wrapper we cannot tell the format, so try the binary format as well.
+			if p, binaryErr := DecodeBinaryPlan(encoded); binaryErr == nil {
+				return p, nil
+			}
+		}
+		return nil, err
+	}
+	return Parse(text)
+}
+
+func decompress(encoded string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidPlan.Wrap(err, "plan is not base64 encoded")
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, ErrInvalidPlan.Wrap(err, "plan is not snappy compressed")
+	}
+	return data, nil
+}
+
+// DecodePlan decodes the plan encoded by TiDB in the text format into the plain text, the same as
+// `tidb_decode_plan()` in TiDB.
+func DecodePlan(encoded string) (string, error) {
+	_, encoded, _ = unwrapDecodeFunc(strings.TrimSpace(encoded))
+	if encoded == "" {
+		return "", ErrInvalidPlan.New("plan is empty")
+	}
+	if encoded == planDiscardedEncoded {
+		return "", ErrInvalidPlan.New("plan is discarded by TiDB because it is too long")
+	}
+	data, err := decompress(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	var depths []int
+	var rows [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		values := strings.Split(line, "\t")
+		if len(values) < 2 {
+			continue
+		}
+		depth, err := strconv.Atoi(values[0])
+		if err != nil {
+			return "", ErrInvalidPlan.New("invalid depth in encoded plan: %s", values[0])
+		}
+		// A node is either a root, or a child of the previous node or one of its ancestors.
+		if depth < 0 || (len(depths) == 0 && depth != 0) || (len(depths) > 0 && depth > depths[len(depths)-1]+1) {
+			return "", ErrInvalidPlan.New("invalid depth in encoded plan: %s", values[0])
+		}
+		fields := make([]string, 0, len(values)-1)
+		for i, v := range values[1:] {
+			switch i {
+			case 0:
+				id, err := decodeOperatorID(v)
+				if err != nil {
+					return "", err
+				}
+				fields = append(fields, id)
+			case 1:
+				task, err := decodeTaskType(v)
+				if err != nil {
+					return "", err
+				}
+				fields = append(fields, task)
+			default:
+				fields = append(fields, v)
+			}
+		}
+		depths = append(depths, depth)
+		rows = append(rows, fields)
+	}
+	if len(rows) == 0 {
+		return "", ErrInvalidPlan.New("plan is empty")
+	}
+
+	prefixes := treePrefixes(depths)
+	lines := make([]string, 0, len(rows))
+	for i, fields := range rows {
+		fields[0] = prefixes[i] + fields[0]
+		lines = append(lines, "\t"+strings.Join(fields, "\t"))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// decodeOperatorID decodes the operator ID like `31_10` into `TableReader_10`.
+func decodeOperatorID(v string) (string, error) {
+	ids := strings.Split(v, "_")
+	if len(ids) != 1 && len(ids) != 2 {
+		return "", ErrInvalidPlan.New("invalid operator ID in encoded plan: %s", v)
+	}
+	typeID, err := strconv.Atoi(ids[0])
+	if err != nil {
+		return "", ErrInvalidPlan.New("invalid operator ID in encoded plan: %s", v)
+	}
+	name := "UnknownPlanID" + ids[0]
+	if typeID > 0 && typeID < len(operatorTypeNames) {
+		name = operatorTypeNames[typeID]
+	}
+	if len(ids) == 1 {
+		return name, nil
+	}
+	return name + "_" + ids[1], nil
+}
+
+// decodeTaskType decodes the task type like `1_0` into `cop[tikv]`.
+func decodeTaskType(v string) (string, error) {
+	segs := strings.Split(v, "_")
+	if segs[0] == encodedTaskRoot {
+		return "root", nil
+	}
+	taskName := "cop"
+	if segs[0] == encodedTaskMpp {
+		taskName = "mpp"
+	} else if segs[0] != encodedTaskCop {
+		return "", ErrInvalidPlan.New("invalid task type in encoded plan: %s", v)
+	}
+	if len(segs) < 2 {
+		// The normalized plan does not contain the store type.
+		return taskName, nil
+	}
+	storeType, err := strconv.Atoi(segs[1])
+	if err != nil {
+		return "", ErrInvalidPlan.New("invalid task type in encoded plan: %s", v)
+	}
+	storeName := "unspecified"
+	if storeType >= 0 && storeType < len(storeTypeNames) {
+		storeName = storeTypeNames[storeType]
+	}
+	return taskName + "[" + storeName + "]", nil
+}
+
+// treePrefixes builds the indentation prefixes like `│ └─` of the operators in pre-order, according to
+// their depths.
+func treePrefixes(depths []int) []string {
+	// hasNextSibling reports whether another operator at the same depth follows under the same parent.
+	hasNextSibling := func(i int) bool {
+		for j := i + 1; j < len(depths); j++ {
+			if depths[j] < depths[i] {
+				return false
+			}
+			if depths[j] == depths[i] {
+				return true
+			}
+		}
+		return false
+	}
+
+	prefixes := make([]string, len(depths))
+	// continued[d] is whether the ancestor at depth d has more siblings to draw below.
+	var continued []bool
+	for i, depth := range depths {
+		if depth == 0 {
+			continued = continued[:0]
+			continue
+		}
+		if len(continued) > depth {
+			continued = continued[:depth]
+		}
+		for len(continued) < depth {
+			continued = append(continued, false)
+		}
+		var b strings.Builder
+		for d := 1; d < depth; d++ {
+			if continued[d] {
+				b.WriteString("│ ")
+			} else {
+				b.WriteString("  ")
+			}
+		}
+		next := hasNextSibling(i)
+		if next {
+			b.WriteString("├─")
+		} else {
+			b.WriteString("└─")
+		}
+		continued = append(continued[:depth], next)
+		prefixes[i] = b.String()
+	}
+	return prefixes
+}
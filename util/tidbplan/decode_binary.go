@@ -0,0 +1,398 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The binary plan is a snappy compressed and base64 encoded `tipb.ExplainData` protobuf message. The messages are
+// decoded by field numbers, so that the dashboard does not depend on the whole tipb package.
+//
+//	message ExplainData {
+//	    ExplainOperator main = 1;
+//	    repeated ExplainOperator ctes = 2;
+//	    bool with_runtime_stats = 3;
+//	    bool discarded_due_to_too_long = 4;
+//	}
+//
+//	message ExplainOperator {
+//	    string name = 1;
+//	    repeated ExplainOperator children = 2;
+//	    TaskType task_type = 3;
+//	    StoreType store_type = 4;
+//	    string operator_info = 5;
+//	    double estimated_rows = 6;
+//	    double cost = 7;
+//	    repeated string root_basic_exec_info = 8;
+//	    repeated string root_group_exec_info = 9;
+//	    string cop_exec_info = 10;
+//	    double actual_rows = 11;
+//	    oneof access_object {
+//	        ScanAccessObject scan_object = 12;
+//	        DynamicPartitionAccessObjects dynamic_partition_objects = 13;
+//	        OtherAccessObject other_object = 14;
+//	    }
+//	    int64 memory_bytes = 15;
+//	    int64 disk_bytes = 16;
+//	    repeated OperatorLabel labels = 17;
+//	}
+const (
+	fieldExplainDataMain             = 1
+	fieldExplainDataCTEs             = 2
+	fieldExplainDataWithRuntimeStats = 3
+	fieldExplainDataDiscarded        = 4
+
+	fieldOperatorName              = 1
+	fieldOperatorChildren          = 2
+	fieldOperatorTaskType          = 3
+	fieldOperatorStoreType         = 4
+	fieldOperatorInfo              = 5
+	fieldOperatorEstRows           = 6
+	fieldOperatorCost              = 7
+	fieldOperatorRootBasicExecInfo = 8
+	fieldOperatorRootGroupExecInfo = 9
+	fieldOperatorCopExecInfo       = 10
+	fieldOperatorActRows           = 11
+	fieldOperatorScanObject        = 12
+	fieldOperatorPartitionObjects  = 13
+	fieldOperatorOtherObject       = 14
+	fieldOperatorMemoryBytes       = 15
+	fieldOperatorDiskBytes         = 16
+	fieldOperatorLabels            = 17
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// binaryTaskTypes is indexed by `tipb.TaskType`.
+var binaryTaskTypes = []string{"unknown", "root", "cop", "batchCop", "mpp"}
+
+// binaryStoreTypes is indexed by `tipb.StoreType`.
+var binaryStoreTypes = []string{"tidb", "tikv", "tiflash"}
+
+// binaryLabels is indexed by `tipb.OperatorLabel`.
+var binaryLabels = []string{"", "Build", "Probe", "Seed Part", "Recursive Part"}
+
+type protoField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func (f protoField) float64() float64 {
+	return math.Float64frombits(f.varint)
+}
+
+// readProtoFields iterates the fields of a protobuf message. Fixed64 values are also stored in varint.
+func readProtoFields(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return ErrInvalidPlan.New("malformed binary plan")
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return ErrInvalidPlan.New("malformed binary plan")
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return ErrInvalidPlan.New("malformed binary plan")
+			}
+			f.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return ErrInvalidPlan.New("malformed binary plan")
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case wireFixed32:
+			if len(b) < 4 {
+				return ErrInvalidPlan.New("malformed binary plan")
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return ErrInvalidPlan.New("unsupported wire type %d in binary plan", f.wire)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVarints reads a repeated varint field, which may be either packed or not.
+func readVarints(f protoField) []uint64 {
+	if f.wire == wireVarint {
+		return []uint64{f.varint}
+	}
+	var values []uint64
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			break
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func enumName(names []string, v uint64) string {
+	if v < uint64(len(names)) {
+		return names[v]
+	}
+	return fmt.Sprintf("unknown(%d)", v)
+}
+
+// DecodeBinaryPlan decodes the binary plan encoded by TiDB, the same as `tidb_decode_binary_plan()` in TiDB.
+// The CTE definitions are decoded into Plan.CTEs.
+func DecodeBinaryPlan(encoded string) (*Plan, error) {
+	_, encoded, _ = unwrapDecodeFunc(strings.TrimSpace(encoded))
+	if encoded == "" {
+		return nil, ErrInvalidPlan.New("plan is empty")
+	}
+	data, err := decompress(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var main []byte
+	var ctes [][]byte
+	withRuntimeStats := false
+	discarded := false
+	err = readProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case fieldExplainDataMain:
+			main = f.bytes
+		case fieldExplainDataCTEs:
+			ctes = append(ctes, f.bytes)
+		case fieldExplainDataWithRuntimeStats:
+			withRuntimeStats = f.varint != 0
+		case fieldExplainDataDiscarded:
+			discarded = f.varint != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if discarded {
+		return nil, ErrInvalidPlan.New("plan is discarded by TiDB because it is too long")
+	}
+	if main == nil {
+		return nil, ErrInvalidPlan.New("plan is empty")
+	}
+
+	plan := &Plan{}
+	if plan.Root, err = decodeBinaryOperator(main, withRuntimeStats); err != nil {
+		return nil, err
+	}
+	for _, cte := range ctes {
+		node, err := decodeBinaryOperator(cte, withRuntimeStats)
+		if err != nil {
+			return nil, err
+		}
+		plan.CTEs = append(plan.CTEs, node)
+	}
+	return plan, nil
+}
+
+func decodeBinaryOperator(b []byte, withRuntimeStats bool) (*Node, error) {
+	node := &Node{}
+	var taskType, storeType uint64
+	var label string
+	var execInfo []string
+	var copExecInfo []string
+	var actRows float64
+	var memoryBytes, diskBytes int64
+	hasMemory, hasDisk := false, false
+
+	err := readProtoFields(b, func(f protoField) error {
+		switch f.num {
+		case fieldOperatorName:
+			node.ID = string(f.bytes)
+		case fieldOperatorChildren:
+			child, err := decodeBinaryOperator(f.bytes, withRuntimeStats)
+			if err != nil {
+				return err
+			}
+			node.Children = append(node.Children, child)
+		case fieldOperatorTaskType:
+			taskType = f.varint
+		case fieldOperatorStoreType:
+			storeType = f.varint
+		case fieldOperatorInfo:
+			node.OperatorInfo = string(f.bytes)
+		case fieldOperatorEstRows:
+			node.EstRows = f.float64()
+		case fieldOperatorCost:
+			cost := f.float64()
+			node.EstCost = &cost
+		case fieldOperatorRootBasicExecInfo, fieldOperatorRootGroupExecInfo:
+			execInfo = append(execInfo, string(f.bytes))
+		case fieldOperatorCopExecInfo:
+			copExecInfo = append(copExecInfo, string(f.bytes))
+		case fieldOperatorActRows:
+			actRows = f.float64()
+		case fieldOperatorScanObject:
+			node.AccessObject = decodeScanAccessObject(f.bytes)
+		case fieldOperatorPartitionObjects:
+			node.AccessObject = decodePartitionAccessObjects(f.bytes)
+		case fieldOperatorOtherObject:
+			node.AccessObject = decodeOtherAccessObject(f.bytes)
+		case fieldOperatorMemoryBytes:
+			memoryBytes, hasMemory = int64(f.varint), true
+		case fieldOperatorDiskBytes:
+			diskBytes, hasDisk = int64(f.varint), true
+		case fieldOperatorLabels:
+			for _, v := range readVarints(f) {
+				if l := enumName(binaryLabels, v); l != "" {
+					label = l
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if node.ID == "" {
+		return nil, ErrInvalidPlan.New("operator name is missing in binary plan")
+	}
+
+	if label != "" {
+		node.ID += "(" + label + ")"
+	}
+	node.Type = OperatorType(node.ID)
+	node.Task = enumName(binaryTaskTypes, taskType)
+	if node.Task != "root" {
+		node.Task += "[" + enumName(binaryStoreTypes, storeType) + "]"
+	}
+	if withRuntimeStats {
+		node.ActRows = &actRows
+		node.ExecutionInfo = strings.Join(append(execInfo, copExecInfo...), ", ")
+		node.RuntimeStats = ParseExecutionInfo(node.ExecutionInfo)
+		node.Memory, node.Disk = "N/A", "N/A"
+		// Negative values mean the memory or disk is not tracked.
+		if hasMemory && memoryBytes >= 0 {
+			node.MemoryBytes = &memoryBytes
+			node.Memory = FormatBytes(memoryBytes)
+		}
+		if hasDisk && diskBytes >= 0 {
+			node.DiskBytes = &diskBytes
+			node.Disk = FormatBytes(diskBytes)
+		}
+	}
+	return node, nil
+}
+
+// decodeScanAccessObject decodes `tipb.ScanAccessObject`:
+//
+//	message ScanAccessObject {
+//	    string database = 1;
+//	    string table = 2;
+//	    repeated IndexAccess indexes = 3; // message IndexAccess { string name = 1; repeated string cols = 2; }
+//	    repeated string partitions = 4;
+//	}
+func decodeScanAccessObject(b []byte) string {
+	var table string
+	var indexes, partitions []string
+	_ = readProtoFields(b, func(f protoField) error {
+		switch f.num {
+		case 2:
+			table = string(f.bytes)
+		case 3:
+			var name string
+			var cols []string
+			_ = readProtoFields(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					name = string(f.bytes)
+				case 2:
+					cols = append(cols, string(f.bytes))
+				}
+				return nil
+			})
+			indexes = append(indexes, fmt.Sprintf("%s(%s)", name, strings.Join(cols, ", ")))
+		case 4:
+			partitions = append(partitions, string(f.bytes))
+		}
+		return nil
+	})
+
+	var parts []string
+	if table != "" {
+		parts = append(parts, "table:"+table)
+	}
+	if len(partitions) > 0 {
+		parts = append(parts, "partition:"+strings.Join(partitions, ","))
+	}
+	if len(indexes) > 0 {
+		parts = append(parts, "index:"+strings.Join(indexes, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// decodePartitionAccessObjects decodes `tipb.DynamicPartitionAccessObjects`, a list of
+// `{ string database = 1; string table = 2; repeated string partitions = 3; bool all_partitions = 4; }`.
+func decodePartitionAccessObjects(b []byte) string {
+	var objects []string
+	_ = readProtoFields(b, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		var table string
+		var partitions []string
+		allPartitions := false
+		_ = readProtoFields(f.bytes, func(f protoField) error {
+			switch f.num {
+			case 2:
+				table = string(f.bytes)
+			case 3:
+				partitions = append(partitions, string(f.bytes))
+			case 4:
+				allPartitions = f.varint != 0
+			}
+			return nil
+		})
+		obj := "table:" + table
+		if allPartitions {
+			obj += ", partition:all"
+		} else if len(partitions) > 0 {
+			obj += ", partition:" + strings.Join(partitions, ",")
+		}
+		objects = append(objects, obj)
+		return nil
+	})
+	return strings.Join(objects, "; ")
+}
+
+// decodeOtherAccessObject decodes `tipb.OtherAccessObject`, whose only used field is `string other_object = 1`.
+func decodeOtherAccessObject(b []byte) string {
+	var obj string
+	_ = readProtoFields(b, func(f protoField) error {
+		if f.num == 1 && f.wire == wireBytes {
+			obj = string(f.bytes)
+		}
+		return nil
+	})
+	return obj
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeForTest(data []byte) string {
+	return base64.StdEncoding.EncodeToString(snappy.Encode(nil, data))
+}
+
+func TestDecodePlan(t *testing.T) {
+	encoded := encodeForTest([]byte("0\t17_9\t0\t12.5\tinner join\t10\ttime:2ms, loops:2\t25 KB\tN/A\n" +
+		"1\t31_16\t0\t10\tdata:Selection_15\t10\ttime:1ms, loops:2\t1 KB\tN/A\n" +
+		"2\t1_15\t1_0\t10\teq(test.t.a, 1)\t10\ttikv_task:{time:0s, loops:1}\tN/A\tN/A\n" +
+		"3\t43_14\t1_0\t10000\ttable:t2, keep order:false\t10000\ttikv_task:{time:0s, loops:1}\tN/A\tN/A\n" +
+		"1\t31_13\t0\t10000\tdata:TableFullScan_12\t10000\ttime:1.9ms, loops:10\t10 KB\tN/A\n" +
+		"2\t43_12\t2_1\t10000\ttable:t1, keep order:false\t10000\ttiflash_task:{time:1ms, loops:1}\tN/A\tN/A"))
+
+	text, err := DecodePlan(encoded)
+	require.NoError(t, err)
+	require.Equal(t, "\tHashJoin_9\troot\t12.5\tinner join\t10\ttime:2ms, loops:2\t25 KB\tN/A\n"+
+		"\t├─TableReader_16\troot\t10\tdata:Selection_15\t10\ttime:1ms, loops:2\t1 KB\tN/A\n"+
+		"\t│ └─Selection_15\tcop[tikv]\t10\teq(test.t.a, 1)\t10\ttikv_task:{time:0s, loops:1}\tN/A\tN/A\n"+
+		"\t│   └─TableFullScan_14\tcop[tikv]\t10000\ttable:t2, keep order:false\t10000\ttikv_task:{time:0s, loops:1}\tN/A\tN/A\n"+
+		"\t└─TableReader_13\troot\t10000\tdata:TableFullScan_12\t10000\ttime:1.9ms, loops:10\t10 KB\tN/A\n"+
+		"\t  └─TableFullScan_12\tmpp[tiflash]\t10000\ttable:t1, keep order:false\t10000\ttiflash_task:{time:1ms, loops:1}\tN/A\tN/A", text)
+
+	// Parse decodes the plan transparently, with or without the wrapper in the slow log.
+	for _, input := range []string{encoded, "tidb_decode_plan('" + encoded + "')"} {
+		plan, err := Parse(input)
+		require.NoError(t, err)
+		require.Equal(t, "HashJoin_9", plan.Root.ID)
+		require.Len(t, plan.Root.Children, 2)
+		require.Equal(t, "TableFullScan_14", plan.Root.Children[0].Children[0].Children[0].ID)
+		require.Equal(t, "mpp[tiflash]", plan.Root.Children[1].Children[0].Task)
+		require.Equal(t, int64(25*1024), *plan.Root.MemoryBytes)
+	}
+}
+
+func TestDecodePlanInvalid(t *testing.T) {
+	_, err := DecodePlan("[discard]")
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+	_, err = DecodePlan("not base64!")
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+	_, err = DecodePlan(base64.StdEncoding.EncodeToString([]byte("not snappy")))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+	_, err = DecodePlan(encodeForTest([]byte("x\t31_1\t0")))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+
+	for _, data := range []string{
+		"-1\t10_2\t1_0\t10",
+		"0\t10_2\t0\t10\n-1\t10_3\t1_0\t10",
+		"1\t10_2\t0\t10",
+		"0\t10_2\t0\t10\n2\t10_3\t1_0\t10",
+	} {
+		_, err = DecodePlan(encodeForTest([]byte(data)))
+		require.True(t, errorx.IsOfType(err, ErrInvalidPlan), data)
+	}
+
+	require.False(t, IsEncoded("\tProjection_3\troot\t10000\ttest.t.a"))
+	require.True(t, IsEncoded("tidb_decode_binary_plan('abc')"))
+}
+
+type protoWriter []byte
+
+func (w *protoWriter) uvarint(v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	*w = append(*w, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func (w *protoWriter) key(num, wire int) {
+	w.uvarint(uint64(num<<3 | wire))
+}
+
+func (w *protoWriter) varint(num int, v uint64) *protoWriter {
+	w.key(num, wireVarint)
+	w.uvarint(v)
+	return w
+}
+
+func (w *protoWriter) double(num int, v float64) *protoWriter {
+	w.key(num, wireFixed64)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+	*w = append(*w, buf...)
+	return w
+}
+
+func (w *protoWriter) bytes(num int, b []byte) *protoWriter {
+	w.key(num, wireBytes)
+	w.uvarint(uint64(len(b)))
+	*w = append(*w, b...)
+	return w
+}
+
+func (w *protoWriter) string(num int, s string) *protoWriter {
+	return w.bytes(num, []byte(s))
+}
+
+func TestDecodeBinaryPlan(t *testing.T) {
+	index := new(protoWriter).string(1, "idx").string(2, "a").string(2, "b")
+	scanObject := new(protoWriter).string(1, "test").string(2, "t").bytes(3, *index)
+	scan := new(protoWriter).
+		string(fieldOperatorName, "IndexRangeScan_8").
+		varint(fieldOperatorTaskType, 2).
+		varint(fieldOperatorStoreType, 1).
+		string(fieldOperatorInfo, "range:[1,1], keep order:false").
+		double(fieldOperatorEstRows, 10).
+		double(fieldOperatorCost, 150.5).
+		string(fieldOperatorCopExecInfo, "tikv_task:{time:1ms, loops:1}").
+		double(fieldOperatorActRows, 3).
+		bytes(fieldOperatorScanObject, *scanObject).
+		varint(fieldOperatorMemoryBytes, math.MaxUint64). // -1
+		varint(fieldOperatorLabels, 1)
+	reader := new(protoWriter).
+		string(fieldOperatorName, "IndexReader_9").
+		bytes(fieldOperatorChildren, *scan).
+		varint(fieldOperatorTaskType, 1).
+		string(fieldOperatorInfo, "index:IndexRangeScan_8").
+		double(fieldOperatorEstRows, 10).
+		double(fieldOperatorCost, 300).
+		string(fieldOperatorRootBasicExecInfo, "time:2ms, loops:2").
+		string(fieldOperatorRootGroupExecInfo, "cop_task: {num: 1, max: 1.5ms}").
+		double(fieldOperatorActRows, 3).
+		varint(fieldOperatorMemoryBytes, 2048)
+	cte := new(protoWriter).string(fieldOperatorName, "CTE_0").varint(fieldOperatorTaskType, 1)
+	data := new(protoWriter).
+		bytes(fieldExplainDataMain, *reader).
+		bytes(fieldExplainDataCTEs, *cte).
+		varint(fieldExplainDataWithRuntimeStats, 1)
+	encoded := encodeForTest(*data)
+
+	for _, input := range []string{encoded, "tidb_decode_binary_plan('" + encoded + "')"} {
+		plan, err := Parse(input)
+		require.NoError(t, err)
+		root := plan.Root
+		require.Equal(t, "IndexReader_9", root.ID)
+		require.Equal(t, "root", root.Task)
+		require.Equal(t, 300.0, *root.EstCost)
+		require.Equal(t, 3.0, *root.ActRows)
+		require.Equal(t, "time:2ms, loops:2, cop_task: {num: 1, max: 1.5ms}", root.ExecutionInfo)
+		require.Equal(t, int64(1), root.RuntimeStats.CopTask.Num)
+		require.Equal(t, "2 KB", root.Memory)
+		require.Equal(t, "N/A", root.Disk)
+
+		scan := root.Children[0]
+		require.Equal(t, "IndexRangeScan_8(Build)", scan.ID)
+		require.Equal(t, "IndexRangeScan", scan.Type)
+		require.Equal(t, "cop[tikv]", scan.Task)
+		require.Equal(t, "table:t, index:idx(a, b)", scan.AccessObject)
+		require.Equal(t, "N/A", scan.Memory)
+		require.Nil(t, scan.MemoryBytes)
+		require.NotNil(t, scan.RuntimeStats.TiKVTask)
+
+		require.Len(t, plan.CTEs, 1)
+		require.Equal(t, "CTE_0", plan.CTEs[0].ID)
+	}
+
+	discarded := new(protoWriter).varint(fieldExplainDataDiscarded, 1)
+	_, err := DecodeBinaryPlan(encodeForTest(*discarded))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+}
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "0 Bytes", FormatBytes(0))
+	require.Equal(t, "1023 Bytes", FormatBytes(1023))
+	require.Equal(t, "1.5 KB", FormatBytes(1536))
+	require.Equal(t, "2 MB", FormatBytes(2*1024*1024))
+}
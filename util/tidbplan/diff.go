@@ -0,0 +1,332 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type DiffStatus string
+
+const (
+	DiffStatusMatched DiffStatus = "matched"
+	DiffStatusAdded   DiffStatus = "added"   // Only in the new plan
+	DiffStatusRemoved DiffStatus = "removed" // Only in the old plan
+)
+
+type ChangeKind string
+
+const (
+	// ChangeOperator means the operator type is changed, e.g. HashJoin => IndexJoin.
+	ChangeOperator ChangeKind = "operator"
+	// ChangeAccessPath means the table is accessed in another way, e.g. TableFullScan => IndexRangeScan,
+	// or through another index.
+	ChangeAccessPath ChangeKind = "access_path"
+	// ChangeTask means the operator is placed on another engine, e.g. root => cop[tikv] => mpp[tiflash].
+	ChangeTask ChangeKind = "task"
+	// ChangeJoinOrder means the children of the join are swapped, or the tables are joined in another order.
+	ChangeJoinOrder ChangeKind = "join_order"
+	ChangeAdded     ChangeKind = "added"
+	ChangeRemoved   ChangeKind = "removed"
+)
+
+// ValueDelta is a numeric value in the old plan and the new plan.
+type ValueDelta struct {
+	Old  float64 `json:"old"`
+	New  float64 `json:"new"`
+	Diff float64 `json:"diff"` // New - Old
+}
+
+type TimeDelta struct {
+	Old  time.Duration `json:"old"`
+	New  time.Duration `json:"new"`
+	Diff time.Duration `json:"diff"` // New - Old
+}
+
+// NodeDiff is an operator aligned across the old plan and the new plan.
+type NodeDiff struct {
+	Status          DiffStatus   `json:"status"`
+	Changes         []ChangeKind `json:"changes"`
+	OldID           string       `json:"old_id,omitempty"`
+	NewID           string       `json:"new_id,omitempty"`
+	OldType         string       `json:"old_type,omitempty"`
+	NewType         string       `json:"new_type,omitempty"`
+	OldTask         string       `json:"old_task,omitempty"`
+	NewTask         string       `json:"new_task,omitempty"`
+	OldAccessObject string       `json:"old_access_object,omitempty"`
+	NewAccessObject string       `json:"new_access_object,omitempty"`
+	// Only available for matched operators, and ActRows and TotalTime also require both plans to be executed.
+	EstRows   *ValueDelta `json:"est_rows,omitempty"`
+	ActRows   *ValueDelta `json:"act_rows,omitempty"`
+	TotalTime *TimeDelta  `json:"total_time,omitempty"`
+	Children  []*NodeDiff `json:"children,omitempty"`
+}
+
+// PlanDiff is the difference between two plans of the same SQL.
+type PlanDiff struct {
+	Root *NodeDiff `json:"root"`
+	// The tables in the order they are accessed, only available when the plan contains joins.
+	OldJoinOrder     []string `json:"old_join_order"`
+	NewJoinOrder     []string `json:"new_join_order"`
+	JoinOrderChanged bool     `json:"join_order_changed"`
+	// Changes is the distinct kinds of changes across all operators.
+	Changes []ChangeKind `json:"changes"`
+}
+
+// Diff aligns the operators of the two plans and reports the differences. The operators are aligned top-down:
+// the roots are always aligned, and the children are aligned by their similarity, e.g. the accessed table and
+// the operator type. Both plans will be analyzed if they are not analyzed yet, to compare the time.
+func Diff(oldPlan, newPlan *Plan) *PlanDiff {
+	for _, p := range []*Plan{oldPlan, newPlan} {
+		if p.Analysis == nil {
+			p.Analyze(DefaultTopN)
+		}
+	}
+	d := &PlanDiff{
+		Root:         diffNode(oldPlan.Root, newPlan.Root),
+		OldJoinOrder: joinOrder(oldPlan.Root),
+		NewJoinOrder: joinOrder(newPlan.Root),
+		Changes:      make([]ChangeKind, 0),
+	}
+	if len(d.OldJoinOrder) > 0 && len(d.NewJoinOrder) > 0 {
+		d.JoinOrderChanged = strings.Join(d.OldJoinOrder, ",") != strings.Join(d.NewJoinOrder, ",")
+	}
+
+	seen := map[ChangeKind]bool{}
+	var collect func(n *NodeDiff)
+	collect = func(n *NodeDiff) {
+		for _, c := range n.Changes {
+			if !seen[c] {
+				seen[c] = true
+				d.Changes = append(d.Changes, c)
+			}
+		}
+		for _, child := range n.Children {
+			collect(child)
+		}
+	}
+	collect(d.Root)
+	if d.JoinOrderChanged && !seen[ChangeJoinOrder] {
+		d.Changes = append(d.Changes, ChangeJoinOrder)
+	}
+	return d
+}
+
+func diffNode(oldNode, newNode *Node) *NodeDiff {
+	nd := &NodeDiff{
+		Status:          DiffStatusMatched,
+		Changes:         make([]ChangeKind, 0),
+		OldID:           oldNode.ID,
+		NewID:           newNode.ID,
+		OldType:         oldNode.Type,
+		NewType:         newNode.Type,
+		OldTask:         oldNode.Task,
+		NewTask:         newNode.Task,
+		OldAccessObject: oldNode.AccessObject,
+		NewAccessObject: newNode.AccessObject,
+		EstRows:         &ValueDelta{Old: oldNode.EstRows, New: newNode.EstRows, Diff: newNode.EstRows - oldNode.EstRows},
+	}
+	if isAccess(oldNode) && isAccess(newNode) {
+		if oldNode.Type != newNode.Type || oldNode.AccessObject != newNode.AccessObject {
+			nd.Changes = append(nd.Changes, ChangeAccessPath)
+		}
+	} else if oldNode.Type != newNode.Type {
+		nd.Changes = append(nd.Changes, ChangeOperator)
+	}
+	if oldNode.Task != newNode.Task {
+		nd.Changes = append(nd.Changes, ChangeTask)
+	}
+	if oldNode.ActRows != nil && newNode.ActRows != nil {
+		nd.ActRows = &ValueDelta{Old: *oldNode.ActRows, New: *newNode.ActRows, Diff: *newNode.ActRows - *oldNode.ActRows}
+	}
+	if oldNode.TotalTime > 0 && newNode.TotalTime > 0 {
+		nd.TotalTime = &TimeDelta{Old: oldNode.TotalTime, New: newNode.TotalTime, Diff: newNode.TotalTime - oldNode.TotalTime}
+	}
+
+	pairs := alignChildren(oldNode.Children, newNode.Children)
+	if isJoin(oldNode) && isJoin(newNode) && childrenSwapped(pairs) {
+		nd.Changes = append(nd.Changes, ChangeJoinOrder)
+	}
+	for _, pair := range pairs {
+		switch {
+		case pair.old >= 0 && pair.new >= 0:
+			nd.Children = append(nd.Children, diffNode(oldNode.Children[pair.old], newNode.Children[pair.new]))
+		case pair.new >= 0:
+			nd.Children = append(nd.Children, unmatchedNode(newNode.Children[pair.new], DiffStatusAdded))
+		default:
+			nd.Children = append(nd.Children, unmatchedNode(oldNode.Children[pair.old], DiffStatusRemoved))
+		}
+	}
+	return nd
+}
+
+func unmatchedNode(node *Node, status DiffStatus) *NodeDiff {
+	nd := &NodeDiff{Status: status}
+	if status == DiffStatusAdded {
+		nd.Changes = []ChangeKind{ChangeAdded}
+		nd.NewID, nd.NewType, nd.NewTask, nd.NewAccessObject = node.ID, node.Type, node.Task, node.AccessObject
+	} else {
+		nd.Changes = []ChangeKind{ChangeRemoved}
+		nd.OldID, nd.OldType, nd.OldTask, nd.OldAccessObject = node.ID, node.Type, node.Task, node.AccessObject
+	}
+	for _, child := range node.Children {
+		nd.Children = append(nd.Children, unmatchedNode(child, status))
+	}
+	return nd
+}
+
+// childPair is a pair of child indexes in the old node and the new node, -1 means absent.
+type childPair struct {
+	old int
+	new int
+}
+
+// alignChildren pairs the most similar children first, then pairs the remaining children by their positions.
+// The result is ordered by the children of the new node, followed by the removed children of the old node.
+func alignChildren(oldChildren, newChildren []*Node) []childPair {
+	type candidate struct {
+		childPair
+		score int
+	}
+	var candidates []candidate
+	for i, o := range oldChildren {
+		for j, n := range newChildren {
+			if score := similarity(o, n); score > 0 {
+				candidates = append(candidates, candidate{childPair{i, j}, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	oldMatch := make([]int, len(oldChildren))
+	newMatch := make([]int, len(newChildren))
+	for i := range oldMatch {
+		oldMatch[i] = -1
+	}
+	for i := range newMatch {
+		newMatch[i] = -1
+	}
+	for _, c := range candidates {
+		if oldMatch[c.old] < 0 && newMatch[c.new] < 0 {
+			oldMatch[c.old] = c.new
+			newMatch[c.new] = c.old
+		}
+	}
+	i := 0
+	for j := range newMatch {
+		if newMatch[j] >= 0 {
+			continue
+		}
+		for i < len(oldMatch) && oldMatch[i] >= 0 {
+			i++
+		}
+		if i < len(oldMatch) {
+			oldMatch[i] = j
+			newMatch[j] = i
+		}
+	}
+
+	pairs := make([]childPair, 0, len(oldChildren)+len(newChildren))
+	for j, i := range newMatch {
+		pairs = append(pairs, childPair{old: i, new: j})
+	}
+	for i, j := range oldMatch {
+		if j < 0 {
+			pairs = append(pairs, childPair{old: i, new: -1})
+		}
+	}
+	return pairs
+}
+
+func childrenSwapped(pairs []childPair) bool {
+	last := -1
+	for _, pair := range pairs {
+		if pair.old < 0 || pair.new < 0 {
+			continue
+		}
+		if pair.old < last {
+			return true
+		}
+		last = pair.old
+	}
+	return false
+}
+
+// similarity scores how likely the two operators are the same logical operator in two plans.
+func similarity(a, b *Node) int {
+	score := 0
+	if ta := subtreeTables(a); ta != "" && ta == subtreeTables(b) {
+		score += 4
+	}
+	if a.Type == b.Type {
+		score += 3
+	} else if isAccess(a) && isAccess(b) || isJoin(a) && isJoin(b) {
+		score++
+	}
+	if a.Label() != "" && a.Label() == b.Label() {
+		score++
+	}
+	return score
+}
+
+// isAccess returns whether the operator reads a table, either directly or through a reader.
+func isAccess(node *Node) bool {
+	return strings.Contains(node.Type, "Scan") || strings.HasSuffix(node.Type, "Get") ||
+		strings.HasSuffix(node.Type, "Reader") || node.Type == "IndexLookUp" || node.Type == "IndexMerge"
+}
+
+// AccessTable extracts the table name from the access object, e.g. `table:t, index:idx(a)` => `t`.
+func AccessTable(accessObject string) string {
+	for _, part := range strings.Split(accessObject, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "table:") {
+			return strings.TrimPrefix(part, "table:")
+		}
+	}
+	return ""
+}
+
+// subtreeTables returns the distinct tables accessed by the operator and its descendants in order.
+func subtreeTables(node *Node) string {
+	return strings.Join(dedupe(accessedTables(node)), ",")
+}
+
+func accessedTables(node *Node) []string {
+	var tables []string
+	node.Walk(func(n *Node, _ int) bool {
+		if t := AccessTable(n.AccessObject); t != "" {
+			tables = append(tables, t)
+		}
+		return true
+	})
+	return tables
+}
+
+func dedupe(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// joinOrder returns the tables in the order they are accessed, or nil if the plan contains no join.
+func joinOrder(root *Node) []string {
+	hasJoin := false
+	root.Walk(func(n *Node, _ int) bool {
+		hasJoin = hasJoin || isJoin(n)
+		return !hasJoin
+	})
+	if !hasJoin {
+		return nil
+	}
+	return dedupe(accessedTables(root))
+}
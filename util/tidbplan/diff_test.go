@@ -0,0 +1,71 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	oldPlan, err := Parse("\tid\ttask\testRows\tactRows\taccess object\texecution info\n" +
+		"\tHashJoin_8\troot\t12.5\t10\t\ttime:100ms, loops:2\n" +
+		"\t├─TableReader_11(Build)\troot\t10\t10\t\ttime:10ms, loops:2\n" +
+		"\t│ └─TableFullScan_10\tcop[tikv]\t10\t10\ttable:t2\ttikv_task:{time:8ms, loops:1}\n" +
+		"\t└─TableReader_13(Probe)\troot\t10000\t10000\t\ttime:90ms, loops:10\n" +
+		"\t  └─TableFullScan_12\tcop[tikv]\t10000\t10000\ttable:t1\ttikv_task:{time:80ms, loops:10}\n")
+	require.NoError(t, err)
+	newPlan, err := Parse("\tid\ttask\testRows\tactRows\taccess object\texecution info\n" +
+		"\tIndexJoin_9\troot\t12.5\t10\t\ttime:5ms, loops:2\n" +
+		"\t├─TableReader_20(Build)\troot\t10000\t10000\t\ttime:3ms, loops:10\n" +
+		"\t│ └─TableFullScan_19\tmpp[tiflash]\t10000\t10000\ttable:t1\ttiflash_task:{time:2ms, loops:1}\n" +
+		"\t└─IndexLookUp_8(Probe)\troot\t1\t10\t\ttime:1ms, loops:2\n" +
+		"\t  ├─IndexRangeScan_6(Build)\tcop[tikv]\t1\t10\ttable:t2, index:idx(a)\ttikv_task:{time:0s, loops:1}\n" +
+		"\t  └─TableRowIDScan_7(Probe)\tcop[tikv]\t1\t10\ttable:t2\ttikv_task:{time:0s, loops:1}\n")
+	require.NoError(t, err)
+
+	d := Diff(oldPlan, newPlan)
+	require.True(t, d.JoinOrderChanged)
+	require.Equal(t, []string{"t2", "t1"}, d.OldJoinOrder)
+	require.Equal(t, []string{"t1", "t2"}, d.NewJoinOrder)
+	require.ElementsMatch(t, []ChangeKind{ChangeOperator, ChangeJoinOrder, ChangeTask, ChangeAccessPath, ChangeAdded}, d.Changes)
+
+	root := d.Root
+	require.Equal(t, []ChangeKind{ChangeOperator, ChangeJoinOrder}, root.Changes)
+	require.Equal(t, -95*time.Millisecond, root.TotalTime.Diff)
+	require.Len(t, root.Children, 2)
+
+	t1Reader := root.Children[0]
+	require.Equal(t, "TableReader_13(Probe)", t1Reader.OldID)
+	require.Equal(t, "TableReader_20(Build)", t1Reader.NewID)
+	require.Empty(t, t1Reader.Changes)
+	require.Equal(t, []ChangeKind{ChangeTask}, t1Reader.Children[0].Changes)
+
+	t2Reader := root.Children[1]
+	require.Equal(t, "TableReader_11(Build)", t2Reader.OldID)
+	require.Equal(t, "IndexLookUp_8(Probe)", t2Reader.NewID)
+	require.Equal(t, []ChangeKind{ChangeAccessPath}, t2Reader.Changes)
+	require.Equal(t, 0.0, t2Reader.ActRows.Diff)
+	require.Len(t, t2Reader.Children, 2)
+	require.Equal(t, "TableFullScan_10", t2Reader.Children[0].OldID)
+	require.Equal(t, "IndexRangeScan_6(Build)", t2Reader.Children[0].NewID)
+	require.Equal(t, []ChangeKind{ChangeAccessPath}, t2Reader.Children[0].Changes)
+	require.Equal(t, DiffStatusAdded, t2Reader.Children[1].Status)
+	require.Equal(t, "TableRowIDScan_7(Probe)", t2Reader.Children[1].NewID)
+}
+
+func TestDiffIdentical(t *testing.T) {
+	d := Diff(mustParseTestData(t, "tpch_q1.txt"), mustParseTestData(t, "tpch_q1.txt"))
+	require.False(t, d.JoinOrderChanged)
+	require.Nil(t, d.OldJoinOrder)
+	require.Empty(t, d.Changes)
+	require.Equal(t, time.Duration(0), d.Root.TotalTime.Diff)
+}
+
+func TestAccessTable(t *testing.T) {
+	require.Equal(t, "t", AccessTable("table:t, index:idx(a)"))
+	require.Equal(t, "lineitem", AccessTable("table:lineitem"))
+	require.Equal(t, "", AccessTable(""))
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	dotMinPenWidth = 1.0
+	dotMaxPenWidth = 8.0
+)
+
+// DOT describes the plan as a graph in the DOT language. Each operator is a node, filled with a darker color
+// when it takes a larger part of the total time. The edges point from the children to the parents as the data
+// flows, and their widths scale with the number of rows. Operators in the same MPP fragment are grouped into a
+// cluster. The CTEs are drawn as separate trees. The plan will be analyzed if it is not analyzed yet.
+func (p *Plan) DOT() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("digraph \"plan\" {\n")
+	buf.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fontsize=10];\n")
+	buf.WriteString("  edge [dir=back, fontname=\"Helvetica\", fontsize=9, color=\"#7f8c8d\"];\n")
+	if p == nil || p.Root == nil {
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+	if p.Analysis == nil {
+		p.Analyze(DefaultTopN)
+	}
+
+	maxRows := 0.0
+	p.walkAll(func(node *Node, _ int) bool {
+		maxRows = math.Max(maxRows, nodeRows(node))
+		return true
+	})
+
+	ids := map[*Node]string{}
+	p.walkAll(func(node *Node, _ int) bool {
+		ids[node] = fmt.Sprintf("n%d", len(ids))
+		attrs := []string{
+			fmt.Sprintf("label=\"%s\"", dotEscape(dotLabel(node))),
+			fmt.Sprintf("fillcolor=\"%s\"", heatColor(node, p.Analysis.TotalTime)),
+		}
+		if node.OnCriticalPath {
+			attrs = append(attrs, "penwidth=2", "color=\"#c0392b\"")
+		}
+		fmt.Fprintf(&buf, "  %s [%s];\n", ids[node], strings.Join(attrs, ", "))
+		return true
+	})
+
+	// Operators in the same MPP fragment are drawn in a cluster.
+	for _, f := range p.MPPFragments {
+		members := p.fragmentNodeIDs(f.ID, ids)
+		if len(members) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "  subgraph cluster_f%d {\n", f.ID)
+		fmt.Fprintf(&buf, "    label=\"%s\"; style=dashed; color=\"#2980b9\"; fontname=\"Helvetica\"; fontsize=10;\n",
+			dotEscape(f.Label()))
+		fmt.Fprintf(&buf, "    %s;\n", strings.Join(members, "; "))
+		buf.WriteString("  }\n")
+	}
+
+	p.walkAll(func(node *Node, _ int) bool {
+		for _, child := range node.Children {
+			rows := nodeRows(child)
+			attrs := []string{
+				fmt.Sprintf("label=\"%s\"", formatRows(rows)),
+				fmt.Sprintf("penwidth=%.2f", edgeWidth(rows, maxRows)),
+			}
+			if child.OnCriticalPath {
+				attrs = append(attrs, "color=\"#c0392b\"")
+			}
+			fmt.Fprintf(&buf, "  %s -> %s [%s];\n", ids[node], ids[child], strings.Join(attrs, ", "))
+		}
+		return true
+	})
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// nodeRows returns the actual rows, or the estimated rows if the plan is not executed.
+func nodeRows(node *Node) float64 {
+	if node.ActRows != nil {
+		return *node.ActRows
+	}
+	return node.EstRows
+}
+
+func formatRows(rows float64) string {
+	if rows == math.Trunc(rows) {
+		return fmt.Sprintf("%.0f rows", rows)
+	}
+	return fmt.Sprintf("%.2f rows", rows)
+}
+
+func dotLabel(node *Node) string {
+	lines := []string{node.ID, node.Task}
+	if node.ActRows != nil {
+		lines = append(lines, fmt.Sprintf("est: %.2f, act: %.0f", node.EstRows, *node.ActRows))
+	} else {
+		lines = append(lines, fmt.Sprintf("est: %.2f", node.EstRows))
+	}
+	if node.TotalTime > 0 {
+		lines = append(lines, fmt.Sprintf("time: %s, self: %s", node.TotalTime, node.ExclusiveTime))
+	}
+	if node.AccessObject != "" {
+		lines = append(lines, node.AccessObject)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+// heatColor interpolates from white to red according to the ratio of the exclusive time.
+func heatColor(node *Node, total time.Duration) string {
+	ratio := 0.0
+	if total > 0 {
+		ratio = math.Min(float64(node.ExclusiveTime)/float64(total), 1)
+	}
+	gb := int(math.Round(255 - 180*ratio))
+	return fmt.Sprintf("#ff%02x%02x", gb, gb)
+}
+
+func edgeWidth(rows, maxRows float64) float64 {
+	if maxRows <= 0 {
+		return dotMinPenWidth
+	}
+	return dotMinPenWidth + (dotMaxPenWidth-dotMinPenWidth)*math.Log10(1+rows)/math.Log10(1+maxRows)
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDOT(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	dot := string(plan.DOT())
+
+	require.NotNil(t, plan.Analysis)
+	require.True(t, strings.HasPrefix(dot, "digraph \"plan\" {\n"))
+	require.Equal(t, plan.Root.Len(), strings.Count(dot, "label=\"")-strings.Count(dot, "->"))
+	require.Equal(t, plan.Root.Len()-1, strings.Count(dot, "->"))
+	require.Contains(t, dot, "n0 -> n1")
+	require.Contains(t, dot, `label="TableFullScan_12\ncop[tikv]`)
+
+	// TableReader_10 takes most of the time.
+	require.Regexp(t, `n3 \[label="TableReader_10[^\]]*fillcolor="#ff5[0-9a-f]5[0-9a-f]"`, dot)
+	// The widest edge carries the most rows.
+	require.Contains(t, dot, "penwidth=8.00")
+}
+
+func TestDOTEscape(t *testing.T) {
+	require.Equal(t, `a\\b\"c\nd`, dotEscape("a\\b\"c\nd"))
+	require.Equal(t, dotMinPenWidth, edgeWidth(0, 0))
+}
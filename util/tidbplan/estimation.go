@@ -0,0 +1,151 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// DefaultQErrorThreshold is the default q-error above which an operator is considered misestimated.
+const DefaultQErrorThreshold = 10.0
+
+// PropagatedError is a join above a misestimated operator, which consumes the misestimated rows.
+type PropagatedError struct {
+	ID     string   `json:"id"`
+	QError *float64 `json:"q_error"` // Nil when the join is not executed
+}
+
+// MisestimatedOperator is an operator whose q-error is above the threshold.
+type MisestimatedOperator struct {
+	ID           string  `json:"id"`
+	AccessObject string  `json:"access_object"`
+	EstRows      float64 `json:"est_rows"` // Scaled by the loops for the inner side of index joins and applies
+	ActRows      float64 `json:"act_rows"`
+	QError       float64 `json:"q_error"`
+	// Underestimated is true when the actual rows are more than the estimated rows.
+	Underestimated bool `json:"underestimated"`
+	// Origin is true when no descendant of the operator is misestimated, i.e. the error starts from here.
+	Origin bool `json:"origin"`
+	// PropagatedTo lists the joins above the operator, from the nearest to the root.
+	PropagatedTo []PropagatedError `json:"propagated_to"`
+}
+
+// EstimationReport is the cardinality estimation quality of an executed plan.
+type EstimationReport struct {
+	Threshold float64                `json:"threshold"`
+	MaxQError float64                `json:"max_q_error"`
+	Operators []MisestimatedOperator `json:"operators"` // Sorted by q-error in descending order
+}
+
+// QError returns the q-error of the estimation, i.e. max(est/act, act/est). Both values are clamped to at
+// least 1 row so that empty results are comparable.
+func QError(estRows, actRows float64) float64 {
+	est := math.Max(estRows, 1)
+	act := math.Max(actRows, 1)
+	return math.Max(est/act, act/est)
+}
+
+func isJoin(node *Node) bool {
+	return strings.Contains(node.Type, "Join") || node.Type == "Apply"
+}
+
+// isLoopJoin returns whether the probe side of the join is executed once for each outer row,
+// in which case the estimated rows of the probe side are per loop.
+func isLoopJoin(node *Node) bool {
+	return strings.HasPrefix(node.Type, "Index") && strings.HasSuffix(node.Type, "Join") || node.Type == "Apply"
+}
+
+// CheckEstimation computes the q-error of each executed operator, and reports the operators whose q-error is
+// above the threshold, including the operators of the CTEs. The result is filled into the nodes and the plan.
+func (p *Plan) CheckEstimation(threshold float64) *EstimationReport {
+	if threshold <= 1 {
+		threshold = DefaultQErrorThreshold
+	}
+	report := &EstimationReport{
+		Threshold: threshold,
+		Operators: make([]MisestimatedOperator, 0),
+	}
+	if p == nil || p.Root == nil {
+		return report
+	}
+
+	var ancestors []*Node
+	var visit func(node *Node, scale float64) bool
+	// visit returns whether the node or any of its descendants is misestimated.
+	visit = func(node *Node, scale float64) bool {
+		estRows := node.EstRows * scale
+		node.QError = nil
+		node.Misestimated = false
+		if node.ActRows != nil {
+			q := QError(estRows, *node.ActRows)
+			node.QError = &q
+			node.Misestimated = q > threshold
+		}
+
+		ancestors = append(ancestors, node)
+		childMisestimated := false
+		var outerRows *float64
+		for _, child := range node.Children {
+			childScale := scale
+			if isLoopJoin(node) {
+				if child.Label() == "Build" {
+					outerRows = child.ActRows
+				} else if child.Label() == "Probe" && outerRows != nil && *outerRows > 0 {
+					childScale = scale * *outerRows
+				}
+			}
+			if visit(child, childScale) {
+				childMisestimated = true
+			}
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+
+		if node.Misestimated {
+			op := MisestimatedOperator{
+				ID:             node.ID,
+				AccessObject:   node.AccessObject,
+				EstRows:        estRows,
+				ActRows:        *node.ActRows,
+				QError:         *node.QError,
+				Underestimated: *node.ActRows > estRows,
+				Origin:         !childMisestimated,
+				PropagatedTo:   make([]PropagatedError, 0),
+			}
+			for i := len(ancestors) - 1; i >= 0; i-- {
+				if isJoin(ancestors[i]) {
+					// The q-error of ancestors is not computed yet, it will be filled below.
+					op.PropagatedTo = append(op.PropagatedTo, PropagatedError{ID: ancestors[i].ID})
+				}
+			}
+			report.Operators = append(report.Operators, op)
+		}
+		return node.Misestimated || childMisestimated
+	}
+	visit(p.Root, 1)
+	for _, cte := range p.CTEs {
+		visit(cte, 1)
+	}
+
+	qErrorByID := map[string]*float64{}
+	p.walkAll(func(node *Node, _ int) bool {
+		qErrorByID[node.ID] = node.QError
+		return true
+	})
+	for i := range report.Operators {
+		op := &report.Operators[i]
+		for j := range op.PropagatedTo {
+			op.PropagatedTo[j].QError = qErrorByID[op.PropagatedTo[j].ID]
+		}
+		if op.QError > report.MaxQError {
+			report.MaxQError = op.QError
+		}
+	}
+	sort.SliceStable(report.Operators, func(i, j int) bool {
+		return report.Operators[i].QError > report.Operators[j].QError
+	})
+
+	p.Estimation = report
+	return report
+}
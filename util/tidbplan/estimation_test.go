@@ -0,0 +1,90 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQError(t *testing.T) {
+	require.Equal(t, 1.0, QError(10, 10))
+	require.Equal(t, 4.0, QError(10, 40))
+	require.Equal(t, 4.0, QError(40, 10))
+	require.Equal(t, 100.0, QError(100, 0))
+	require.Equal(t, 1.0, QError(0.5, 0))
+}
+
+func TestCheckEstimation(t *testing.T) {
+	plan := mustParseTestData(t, "hash_join.txt")
+	report := plan.CheckEstimation(0)
+
+	require.Equal(t, DefaultQErrorThreshold, report.Threshold)
+	require.Len(t, report.Operators, 4)
+	require.Equal(t, "TableFullScan_14", report.Operators[0].ID)
+	require.Equal(t, 10000.0/3, report.Operators[0].QError)
+	require.Equal(t, report.Operators[0].QError, report.MaxQError)
+	require.True(t, report.Operators[0].Origin)
+	require.False(t, report.Operators[0].Underestimated)
+	require.Equal(t, "table:t2", report.Operators[0].AccessObject)
+	require.Len(t, report.Operators[0].PropagatedTo, 1)
+	require.Equal(t, "HashJoin_9", report.Operators[0].PropagatedTo[0].ID)
+	require.Equal(t, 12.5/3, *report.Operators[0].PropagatedTo[0].QError)
+
+	var lookup *MisestimatedOperator
+	for i := range report.Operators {
+		if report.Operators[i].ID == "IndexLookUp_13(Probe)" {
+			lookup = &report.Operators[i]
+		}
+	}
+	require.NotNil(t, lookup)
+	require.False(t, lookup.Origin)
+
+	selection := plan.Root.Children[0].Children[0].Children[0]
+	require.False(t, selection.Misestimated)
+	require.InDelta(t, 10.0/3, *selection.QError, 1e-9)
+	require.Same(t, report, plan.Estimation)
+}
+
+func TestCheckEstimationIndexJoin(t *testing.T) {
+	plan, err := Parse("\tid\testRows\tactRows\ttask\n" +
+		"\tIndexJoin_10\t100\t120\troot\n" +
+		"\t├─TableReader_20(Build)\t100\t100\troot\n" +
+		"\t│ └─TableFullScan_19\t100\t100\tcop[tikv]\n" +
+		"\t└─IndexLookUp_9(Probe)\t1\t120\troot\n" +
+		"\t  ├─IndexRangeScan_7(Build)\t1.2\t120\tcop[tikv]\n" +
+		"\t  └─TableRowIDScan_8(Probe)\t1.2\t5000\tcop[tikv]\n")
+	require.NoError(t, err)
+	report := plan.CheckEstimation(10)
+
+	// The probe side is estimated per outer row, so it is scaled by the 100 outer rows.
+	require.Len(t, report.Operators, 1)
+	require.Equal(t, "TableRowIDScan_8(Probe)", report.Operators[0].ID)
+	require.Equal(t, 120.0, report.Operators[0].EstRows)
+	require.True(t, report.Operators[0].Underestimated)
+	require.Equal(t, []PropagatedError{{ID: "IndexJoin_10", QError: plan.Root.QError}}, report.Operators[0].PropagatedTo)
+	require.InDelta(t, 1.2, *plan.Root.QError, 1e-9)
+}
+
+func TestCheckEstimationCTE(t *testing.T) {
+	plan, err := Parse("\tid\testRows\tactRows\ttask\n" +
+		"\tProjection_10\t10\t10\troot\n" +
+		"\t└─CTEFullScan_12\t10\t10\troot\n")
+	require.NoError(t, err)
+	cte, err := Parse("\tid\testRows\tactRows\ttask\n" +
+		"\tCTE_0\t10\t10\troot\n" +
+		"\t└─TableReader_20(Seed Part)\t1\t10\troot\n" +
+		"\t  └─TableFullScan_19\t1\t1000\tcop[tikv]\n")
+	require.NoError(t, err)
+	plan.CTEs = append(plan.CTEs, cte.Root)
+	report := plan.CheckEstimation(5)
+
+	require.Len(t, report.Operators, 2)
+	require.Equal(t, "TableFullScan_19", report.Operators[0].ID)
+	require.True(t, report.Operators[0].Origin)
+	require.Empty(t, report.Operators[0].PropagatedTo)
+	require.Equal(t, "TableReader_20(Seed Part)", report.Operators[1].ID)
+	require.False(t, report.Operators[1].Origin)
+	require.Equal(t, 1000.0, report.MaxQError)
+}
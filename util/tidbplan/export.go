@@ -0,0 +1,220 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ErrUnsupportedFormat means the plan cannot be exported in the format.
+var ErrUnsupportedFormat = ErrNS.NewType("unsupported_format")
+
+type ExportFormat string
+
+const (
+	// ExportFormatJSON is the JSON of Plan in the form of `[{"Plan": {...}}]`, which can be imported again.
+	ExportFormatJSON ExportFormat = "json"
+	// ExportFormatDOT is the graph in the DOT language of Graphviz.
+	ExportFormatDOT ExportFormat = "dot"
+	// ExportFormatMermaid is the Mermaid flowchart, which is rendered in GitHub issues and many wikis.
+	ExportFormatMermaid ExportFormat = "mermaid"
+	// ExportFormatText is the aligned tree like the output of EXPLAIN, with the hot operators annotated.
+	ExportFormatText ExportFormat = "text"
+	// ExportFormatMarkdown is the text tree in a code block, followed by a table of the hot operators.
+	ExportFormatMarkdown ExportFormat = "markdown"
+)
+
+// ContentType returns the MIME type of the exported content.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportFormatJSON:
+		return "application/json"
+	case ExportFormatDOT:
+		return "text/vnd.graphviz"
+	case ExportFormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Export converts the plan into the format. The plan will be analyzed if it is not analyzed yet.
+func (p *Plan) Export(format ExportFormat) ([]byte, error) {
+	if p != nil && p.Root != nil && p.Analysis == nil {
+		p.Analyze(DefaultTopN)
+	}
+	switch format {
+	case ExportFormatJSON:
+		return json.MarshalIndent([]*Plan{p}, "", "  ")
+	case ExportFormatDOT:
+		return p.DOT(), nil
+	case ExportFormatMermaid:
+		return p.Mermaid(), nil
+	case ExportFormatText:
+		return p.Text(), nil
+	case ExportFormatMarkdown:
+		return p.Markdown(), nil
+	default:
+		return nil, ErrUnsupportedFormat.New("unsupported export format %s", format)
+	}
+}
+
+// mermaidEscape replaces the characters which are special in the Mermaid labels by the entity codes.
+func mermaidEscape(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "\n", "<br/>")
+	return r.Replace(s)
+}
+
+// Mermaid describes the plan as a Mermaid flowchart. Like DOT, nodes are filled by the exclusive time, the
+// edges point from the children to the parents with the rows, MPP fragments are drawn as subgraphs, and the CTEs
+// are drawn as separate trees. The plan will be analyzed if it is not analyzed yet.
+func (p *Plan) Mermaid() []byte {
+	var buf bytes.Buffer
+	// Bottom to top, so that the data flows upwards and the root is at the top.
+	buf.WriteString("flowchart BT\n")
+	if p == nil || p.Root == nil {
+		return buf.Bytes()
+	}
+	if p.Analysis == nil {
+		p.Analyze(DefaultTopN)
+	}
+
+	ids := map[*Node]string{}
+	p.walkAll(func(node *Node, _ int) bool {
+		ids[node] = fmt.Sprintf("n%d", len(ids))
+		fmt.Fprintf(&buf, "  %s[\"%s\"]\n", ids[node], mermaidEscape(dotLabel(node)))
+		return true
+	})
+	for _, f := range p.MPPFragments {
+		members := p.fragmentNodeIDs(f.ID, ids)
+		if len(members) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "  subgraph f%d[\"%s\"]\n", f.ID, mermaidEscape(f.Label()))
+		for _, id := range members {
+			fmt.Fprintf(&buf, "    %s\n", id)
+		}
+		buf.WriteString("  end\n")
+	}
+	p.walkAll(func(node *Node, _ int) bool {
+		for _, child := range node.Children {
+			fmt.Fprintf(&buf, "  %s -->|\"%s\"| %s\n", ids[child], formatRows(nodeRows(child)), ids[node])
+		}
+		return true
+	})
+	p.walkAll(func(node *Node, _ int) bool {
+		style := fmt.Sprintf("fill:%s", heatColor(node, p.Analysis.TotalTime))
+		if node.OnCriticalPath {
+			style += ",stroke:#c0392b,stroke-width:2px"
+		}
+		fmt.Fprintf(&buf, "  style %s %s\n", ids[node], style)
+		return true
+	})
+	return buf.Bytes()
+}
+
+// hotRanks returns the rank of the hot operators by the operator IDs, starting from 1.
+func (p *Plan) hotRanks() map[string]int {
+	ranks := map[string]int{}
+	if p.Analysis == nil || !p.Analysis.HasRuntimeStats {
+		return ranks
+	}
+	for i, op := range p.Analysis.HotOperators {
+		ranks[op.ID] = i + 1
+	}
+	return ranks
+}
+
+// Text formats the plan as an aligned tree like the output of EXPLAIN. The actual rows, time, loops and memory
+// are only shown when the plan is executed, in which case the hot operators are annotated with their ranks and
+// ratios of the exclusive time. The numbers come from the decoded runtime stats instead of the raw execution
+// info, so that they are formatted consistently. The plan will be analyzed if it is not analyzed yet.
+func (p *Plan) Text() []byte {
+	var buf bytes.Buffer
+	if p == nil || p.Root == nil {
+		return buf.Bytes()
+	}
+	if p.Analysis == nil {
+		p.Analyze(DefaultTopN)
+	}
+	executed := p.Analysis.HasRuntimeStats
+	ranks := p.hotRanks()
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if executed {
+		fmt.Fprintln(w, "id\ttask\testRows\tactRows\ttime\tloops\tmemory\taccess object\thot")
+	} else {
+		fmt.Fprintln(w, "id\ttask\testRows\taccess object")
+	}
+	var write func(node *Node, prefix, childPrefix string)
+	write = func(node *Node, prefix, childPrefix string) {
+		fields := []string{prefix + node.ID, node.Task, fmt.Sprintf("%.2f", node.EstRows)}
+		if executed {
+			actRows := ""
+			if node.ActRows != nil {
+				actRows = fmt.Sprintf("%.0f", *node.ActRows)
+			}
+			loops := ""
+			if n := operatorLoops(node); n > 0 {
+				loops = strconv.FormatInt(n, 10)
+			}
+			memory := ""
+			if node.MemoryBytes != nil {
+				memory = FormatBytes(*node.MemoryBytes)
+			}
+			hot := ""
+			if rank, ok := ranks[node.ID]; ok {
+				hot = fmt.Sprintf("#%d %.1f%%", rank, p.Analysis.HotOperators[rank-1].Ratio*100)
+			}
+			fields = append(fields, actRows, node.TotalTime.String(), loops, memory, node.AccessObject, hot)
+		} else {
+			fields = append(fields, node.AccessObject)
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+		for i, child := range node.Children {
+			if i == len(node.Children)-1 {
+				write(child, childPrefix+"└─", childPrefix+"  ")
+			} else {
+				write(child, childPrefix+"├─", childPrefix+"│ ")
+			}
+		}
+	}
+	write(p.Root, "", "")
+	for _, cte := range p.CTEs {
+		write(cte, "", "")
+	}
+	_ = w.Flush()
+
+	// Trim the padding of the empty trailing columns.
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	buf.Reset()
+	for _, line := range lines {
+		buf.WriteString(strings.TrimRight(line, " "))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// Markdown formats the plan as the text tree in a code block, so that the alignment is kept when rendered.
+// The hot operators are listed in a table when the plan is executed.
+func (p *Plan) Markdown() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("```\n")
+	buf.Write(p.Text())
+	buf.WriteString("```\n")
+	if p == nil || p.Analysis == nil || !p.Analysis.HasRuntimeStats || len(p.Analysis.HotOperators) == 0 {
+		return buf.Bytes()
+	}
+	fmt.Fprintf(&buf, "\nTotal time: %s\n\n", p.Analysis.TotalTime)
+	buf.WriteString("| # | Hot operator | Exclusive time | Ratio | Loops |\n")
+	buf.WriteString("| - | - | - | - | - |\n")
+	for i, op := range p.Analysis.HotOperators {
+		fmt.Fprintf(&buf, "| %d | `%s` | %s | %.1f%% | %d |\n", i+1, op.ID, op.ExclusiveTime, op.Ratio*100, op.Loops)
+	}
+	return buf.Bytes()
+}
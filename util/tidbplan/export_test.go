@@ -0,0 +1,88 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJSON(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	data, err := plan.Export(ExportFormatJSON)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "[\n  {\n    \"Plan\": {"))
+
+	imported, err := ParseJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, plan.Root.Len(), imported.Root.Len())
+	require.Equal(t, plan.Root.ID, imported.Root.ID)
+	require.Contains(t, string(data), `"Plans": [`)
+
+	_, err = plan.Export("svg")
+	require.Error(t, err)
+	require.Equal(t, "text/vnd.graphviz", ExportFormatDOT.ContentType())
+}
+
+func TestExportMermaid(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	data, err := plan.Export(ExportFormatMermaid)
+	require.NoError(t, err)
+	mermaid := string(data)
+
+	require.True(t, strings.HasPrefix(mermaid, "flowchart BT\n"))
+	require.Contains(t, mermaid, `  n0["Sort_6<br/>root<br/>est: 2.94, act: 4<br/>`)
+	require.Contains(t, mermaid, `  n1 -->|"4 rows"| n0`)
+	require.Equal(t, plan.Root.Len()-1, strings.Count(mermaid, "-->"))
+	require.Regexp(t, `style n3 fill:#ff5[0-9a-f]5[0-9a-f],stroke:#c0392b`, mermaid)
+
+	require.Equal(t, "a#quot;b#lt;c#gt;<br/>d", mermaidEscape("a\"b<c>\nd"))
+}
+
+func TestExportText(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	data, err := plan.Export(ExportFormatText)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	require.Len(t, lines, plan.Root.Len()+1)
+	require.Regexp(t, `^id +task +estRows +actRows +time +loops +memory +access object +hot$`, lines[0])
+	require.Regexp(t, `^Sort_6 +root +2\.94 +4 +13\.4s +2 +45\.4 KB$`, lines[1])
+	require.Regexp(t, `^    └─TableReader_10 +root +2\.94 +2620 +13\.4s +4 +6\.34 KB +#1 `, lines[4])
+	require.Regexp(t, `^          └─TableFullScan_12 +cop\[tikv\] +300005811\.00 +300005811 +760ms +\d+ +#2 `, lines[7])
+	// Columns are aligned.
+	col := strings.Index(lines[0], "task")
+	for _, line := range lines[1:] {
+		require.Equal(t, ' ', []rune(line)[col-1])
+		require.NotEqual(t, ' ', []rune(line)[col])
+	}
+
+	plan, err = Parse("\tid\ttask\testRows\taccess object\toperator info\n" +
+		"\tHashJoin_8\troot\t12.50\t\tinner join\n" +
+		"\t├─TableReader_11(Build)\troot\t10.00\t\tdata:TableFullScan_10\n" +
+		"\t│ └─TableFullScan_10\tcop[tikv]\t10.00\ttable:t2\tkeep order:false\n" +
+		"\t└─TableReader_13(Probe)\troot\t10000.00\t\tdata:TableFullScan_12\n" +
+		"\t  └─TableFullScan_12\tcop[tikv]\t10000.00\ttable:t1\tkeep order:false\n")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"id                       task       estRows   access object\n"+
+		"HashJoin_8               root       12.50\n"+
+		"├─TableReader_11(Build)  root       10.00\n"+
+		"│ └─TableFullScan_10     cop[tikv]  10.00     table:t2\n"+
+		"└─TableReader_13(Probe)  root       10000.00\n"+
+		"  └─TableFullScan_12     cop[tikv]  10000.00  table:t1\n", string(plan.Text()))
+}
+
+func TestExportMarkdown(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	data, err := plan.Export(ExportFormatMarkdown)
+	require.NoError(t, err)
+	markdown := string(data)
+
+	require.True(t, strings.HasPrefix(markdown, "```\nid "))
+	require.Contains(t, markdown, "```\n\nTotal time: 13.4s\n\n| # | Hot operator |")
+	require.Contains(t, markdown, "| 1 | `TableReader_10` |")
+	require.Equal(t, "```\n```\n", string((&Plan{}).Markdown()))
+}
@@ -0,0 +1,267 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// InputFormat is the format of a plan pasted by users.
+type InputFormat string
+
+const (
+	// InputFormatText is the tab separated text, as in the statements summary and slow log, or
+	// the output of `mysql --batch`.
+	InputFormatText InputFormat = "text"
+	// InputFormatEncoded is the plan encoded by TiDB, in either the text format or the binary format.
+	InputFormatEncoded InputFormat = "encoded"
+	// InputFormatTable is the box table printed by the MySQL client.
+	InputFormatTable InputFormat = "table"
+	// InputFormatJSON is either the JSON of Plan, or the output of `EXPLAIN FORMAT = 'tidb_json'`.
+	InputFormatJSON InputFormat = "json"
+)
+
+// DetectFormat guesses the format of the plan pasted by users.
+func DetectFormat(input string) InputFormat {
+	input = strings.TrimSpace(input)
+	switch {
+	case strings.HasPrefix(input, "{") || strings.HasPrefix(input, "["):
+		return InputFormatJSON
+	case strings.HasPrefix(input, "+-") || strings.HasPrefix(input, "|"):
+		return InputFormatTable
+	case IsEncoded(input):
+		return InputFormatEncoded
+	default:
+		return InputFormatText
+	}
+}
+
+// ParseAny parses the plan in any of the supported input formats, see InputFormat.
+func ParseAny(input string) (*Plan, InputFormat, error) {
+	format := DetectFormat(input)
+	var plan *Plan
+	var err error
+	switch format {
+	case InputFormatJSON:
+		plan, err = ParseJSON([]byte(input))
+	case InputFormatTable:
+		plan, err = ParseTable(input)
+	default:
+		plan, err = Parse(input)
+	}
+	return plan, format, err
+}
+
+// ParseTable parses the box table printed by the MySQL client, e.g.
+//
+//	+-------------------+----------+-----------+---------------+------------------+
+//	| id                | estRows  | task      | access object | operator info    |
+//	+-------------------+----------+-----------+---------------+------------------+
+//	| TableReader_7     | 10.00    | root      |               | data:Selection_6 |
+//	| └─Selection_6     | 10.00    | cop[tikv] |               | eq(test.t.a, 1)  |
+//	...
+func ParseTable(input string) (*Plan, error) {
+	var border string
+	var header []string
+	var rows [][]string
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+		switch {
+		case strings.HasPrefix(line, "+-"):
+			if border == "" {
+				border = line
+			}
+		case strings.HasPrefix(line, "|"):
+			cells := splitTableRow(line, border)
+			if header == nil {
+				header = cells
+				for i := range header {
+					header[i] = strings.TrimSpace(header[i])
+				}
+			} else {
+				rows = append(rows, cells)
+			}
+		}
+		// Other lines, e.g. `3 rows in set (0.00 sec)`, are ignored.
+	}
+	if header == nil {
+		return nil, ErrInvalidPlan.New("table header is missing")
+	}
+	return ParseRows(header, rows)
+}
+
+// splitTableRow splits the row by the column boundaries in the border line, so that `|` in the cells is kept.
+// The padding space before each cell is removed, while the indentation of the operator ID is kept.
+func splitTableRow(line, border string) []string {
+	var cells []string
+	if border != "" && utf8.RuneCountInString(line) == utf8.RuneCountInString(border) {
+		runes := []rune(line)
+		start := -1
+		for i, r := range []rune(border) {
+			if r != '+' {
+				continue
+			}
+			if start >= 0 {
+				cells = append(cells, string(runes[start+1:i]))
+			}
+			start = i
+		}
+	} else {
+		// The border is absent or the row is not aligned, e.g. contains wide characters.
+		parts := strings.Split(strings.Trim(line, "|"), "|")
+		cells = append(cells, parts...)
+	}
+	for i, cell := range cells {
+		cells[i] = strings.TrimPrefix(cell, " ")
+	}
+	return cells
+}
+
+// jsonNumber accepts both JSON numbers and numeric strings, as `EXPLAIN FORMAT = 'tidb_json'` outputs the
+// row counts in strings.
+type jsonNumber struct {
+	value float64
+	valid bool
+}
+
+func (n *jsonNumber) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		n.value, n.valid = v, true
+	}
+	return nil
+}
+
+// tidbJSONOperator is an operator in the output of `EXPLAIN FORMAT = 'tidb_json'`.
+type tidbJSONOperator struct {
+	ID            string              `json:"id"`
+	EstRows       jsonNumber          `json:"estRows"`
+	EstCost       jsonNumber          `json:"estCost"`
+	ActRows       jsonNumber          `json:"actRows"`
+	TaskType      string              `json:"taskType"`
+	AccessObject  string              `json:"accessObject"`
+	ExecutionInfo string              `json:"executeInfo"`
+	OperatorInfo  string              `json:"operatorInfo"`
+	MemoryInfo    string              `json:"memoryInfo"`
+	DiskInfo      string              `json:"diskInfo"`
+	SubOperators  []*tidbJSONOperator `json:"subOperators"`
+}
+
+func (o *tidbJSONOperator) toNode() *Node {
+	row := []string{o.ID, o.TaskType, o.AccessObject, o.OperatorInfo, o.ExecutionInfo, o.MemoryInfo, o.DiskInfo}
+	node, _, _ := parseRow(row, []column{
+		columnID, columnTask, columnAccessObject, columnOperatorInfo, columnExecutionInfo, columnMemory, columnDisk,
+	})
+	node.EstRows = o.EstRows.value
+	if o.EstCost.valid {
+		node.EstCost = &o.EstCost.value
+	}
+	if o.ActRows.valid {
+		node.ActRows = &o.ActRows.value
+	}
+	for _, sub := range o.SubOperators {
+		if sub != nil && sub.ID != "" {
+			node.Children = append(node.Children, sub.toNode())
+		}
+	}
+	return node
+}
+
+// dropNilNodes removes the null operators in the JSON, which are not valid operators.
+func dropNilNodes(nodes []*Node) []*Node {
+	if nodes == nil {
+		return nil
+	}
+	kept := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node != nil {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// parseOptionalBytes parses the memory or disk column, returning nil if it is N/A or malformed.
+func parseOptionalBytes(s string) *int64 {
+	if v, ok := ParseBytes(s); ok {
+		return &v
+	}
+	return nil
+}
+
+// ParseJSON parses either the JSON of Plan, in the form of `{"Plan": {...}}` or `[{"Plan": {...}}]`, or the
+// output of `EXPLAIN FORMAT = 'tidb_json'`, whose extra top level operators are the CTE definitions.
+func ParseJSON(data []byte) (*Plan, error) {
+	data = bytes.TrimSpace(data)
+	var items []json.RawMessage
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, ErrInvalidPlan.Wrap(err, "invalid JSON")
+		}
+	} else {
+		items = []json.RawMessage{data}
+	}
+	if len(items) == 0 {
+		return nil, ErrInvalidPlan.New("plan is empty")
+	}
+
+	var probe struct {
+		Plan *Node  `json:"Plan"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(items[0], &probe); err != nil {
+		return nil, ErrInvalidPlan.Wrap(err, "invalid JSON")
+	}
+	if probe.Plan != nil {
+		var plan Plan
+		if err := json.Unmarshal(items[0], &plan); err != nil {
+			return nil, ErrInvalidPlan.Wrap(err, "invalid JSON")
+		}
+		if plan.Root.ID == "" {
+			return nil, ErrInvalidPlan.New("operator ID is missing")
+		}
+		// Only keep the original columns, derived fields are computed again.
+		derive := func(node *Node, _ int) bool {
+			// Children are visited after the parent, so that `"Plans": [null]` never reaches them.
+			node.Children = dropNilNodes(node.Children)
+			node.Type = OperatorType(node.ID)
+			node.RuntimeStats = ParseExecutionInfo(node.ExecutionInfo)
+			node.MemoryBytes, node.DiskBytes = parseOptionalBytes(node.Memory), parseOptionalBytes(node.Disk)
+			node.TotalTime, node.ExclusiveTime, node.OnCriticalPath = 0, 0, false
+			node.QError, node.Misestimated = nil, false
+			return true
+		}
+		plan.Root.Walk(derive)
+		plan.CTEs = dropNilNodes(plan.CTEs)
+		for _, cte := range plan.CTEs {
+			cte.Walk(derive)
+		}
+		plan.Analysis = nil
+		plan.Estimation = nil
+		return &plan, nil
+	}
+	if probe.ID == "" {
+		return nil, ErrInvalidPlan.New("unrecognized JSON plan")
+	}
+
+	plan := &Plan{}
+	for i, item := range items {
+		var op tidbJSONOperator
+		if err := json.Unmarshal(item, &op); err != nil {
+			return nil, ErrInvalidPlan.Wrap(err, "invalid JSON")
+		}
+		if op.ID == "" {
+			return nil, ErrInvalidPlan.New("operator ID is missing")
+		}
+		if i == 0 {
+			plan.Root = op.toNode()
+		} else {
+			plan.CTEs = append(plan.CTEs, op.toNode())
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTable(t *testing.T) {
+	input := `mysql> explain select * from t where a = 1;
++-------------------------+----------+-----------+---------------+--------------------------------+
+| id                      | estRows  | task      | access object | operator info                  |
++-------------------------+----------+-----------+---------------+--------------------------------+
+| TableReader_7           | 10.00    | root      |               | data:Selection_6               |
+| └─Selection_6           | 10.00    | cop[tikv] |               | eq(test.t.a, 1)                |
+|   └─TableFullScan_5     | 10000.00 | cop[tikv] | table:t       | keep order:false, stats:pseudo |
++-------------------------+----------+-----------+---------------+--------------------------------+
+3 rows in set (0.00 sec)
+`
+	require.Equal(t, InputFormatTable, DetectFormat("+---+\n| id |"))
+	_, err := ParseTable("no table here")
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+
+	plan, format, err := ParseAny(input[len("mysql> explain select * from t where a = 1;\n"):])
+	require.NoError(t, err)
+	require.Equal(t, InputFormatTable, format)
+	require.Equal(t, "TableReader_7", plan.Root.ID)
+	scan := plan.Root.Children[0].Children[0]
+	require.Equal(t, "TableFullScan_5", scan.ID)
+	require.Equal(t, 10000.0, scan.EstRows)
+	require.Equal(t, "table:t", scan.AccessObject)
+	require.Equal(t, "keep order:false, stats:pseudo", scan.OperatorInfo)
+}
+
+func TestParseTableUnaligned(t *testing.T) {
+	plan, err := ParseTable("| id | estRows | task |\n| Projection_3 | 1 | root |\n| └─TableDual_4 | 1 | root |\n")
+	require.NoError(t, err)
+	require.Equal(t, "TableDual_4", plan.Root.Children[0].ID)
+}
+
+func TestParseTiDBJSON(t *testing.T) {
+	input := `[
+  {
+    "id": "HashJoin_8",
+    "estRows": "12.50",
+    "actRows": "10",
+    "taskType": "root",
+    "executeInfo": "time:2ms, loops:2",
+    "operatorInfo": "inner join",
+    "memoryInfo": "25 KB",
+    "diskInfo": "0 Bytes",
+    "subOperators": [
+      {"id": "TableReader_11(Build)", "estRows": "10.00", "actRows": "10", "taskType": "root"},
+      {"id": "TableReader_13(Probe)", "estRows": "10000.00", "actRows": "10000", "taskType": "root",
+        "subOperators": [{"id": "TableFullScan_12", "estRows": "10000.00", "taskType": "cop[tikv]", "accessObject": "table:t1"}]}
+    ]
+  },
+  {"id": "CTE_0", "estRows": "1.00", "taskType": "root"}
+]`
+	plan, format, err := ParseAny(input)
+	require.NoError(t, err)
+	require.Equal(t, InputFormatJSON, format)
+	require.Equal(t, "HashJoin", plan.Root.Type)
+	require.Equal(t, 12.5, plan.Root.EstRows)
+	require.Equal(t, 10.0, *plan.Root.ActRows)
+	require.Equal(t, int64(2), plan.Root.RuntimeStats.Loops)
+	require.Equal(t, int64(25*1024), *plan.Root.MemoryBytes)
+	require.Equal(t, "Probe", plan.Root.Children[1].Label())
+	require.Equal(t, "table:t1", plan.Root.Children[1].Children[0].AccessObject)
+	require.Nil(t, plan.Root.Children[1].Children[0].ActRows)
+	require.Len(t, plan.CTEs, 1)
+}
+
+func TestParsePlanJSON(t *testing.T) {
+	original := mustParseTestData(t, "tpch_q1.txt")
+	original.Analyze(DefaultTopN)
+	data, err := json.Marshal([]*Plan{original})
+	require.NoError(t, err)
+
+	plan, err := ParseJSON(data)
+	require.NoError(t, err)
+	require.Nil(t, plan.Analysis)
+	require.Equal(t, original.Root.Len(), plan.Root.Len())
+	require.Equal(t, original.Root.RuntimeStats, plan.Root.RuntimeStats)
+	require.Equal(t, "Sort", plan.Root.Type)
+
+	// Typed fields are derived from the columns instead of trusting the input.
+	plan, err = ParseJSON([]byte(`{"Plan": {"Node ID": "Sort_6", "memory": "45.4 KB", "disk": "N/A",
+		"memory bytes": 1, "disk bytes": 2}}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(46490), *plan.Root.MemoryBytes)
+	require.Nil(t, plan.Root.DiskBytes)
+
+	// Null operators are dropped instead of failing the analysis.
+	plan, err = ParseJSON([]byte(`{"Plan": {"Node ID": "Sort_6", "Plans": [null, {"Node ID": "TableReader_7",
+		"Plans": [null]}]}, "CTEs": [null]}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, plan.Root.Len())
+	require.Empty(t, plan.CTEs)
+	require.NotPanics(t, func() { plan.Analyze(DefaultTopN) })
+
+	_, err = ParseJSON([]byte(`{"foo": 1}`))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+	_, err = ParseJSON([]byte(`[`))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+}
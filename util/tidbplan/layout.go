@@ -0,0 +1,297 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"fmt"
+	"math"
+)
+
+// Default sizes of the layout, in pixels.
+const (
+	DefaultLayoutNodeWidth     = 200.0
+	DefaultLayoutNodeHeight    = 64.0
+	DefaultLayoutSiblingGap    = 24.0
+	DefaultLayoutLevelGap      = 48.0
+	DefaultLayoutCollapseChain = 3
+)
+
+// Chains of these operators carry little information, and are collapsed in the layout.
+var chainOperatorTypes = map[string]bool{
+	"Projection": true,
+	"Selection":  true,
+}
+
+type LayoutOptions struct {
+	NodeWidth  float64 `json:"node_width"`  // Default to 200
+	NodeHeight float64 `json:"node_height"` // Default to 64
+	SiblingGap float64 `json:"sibling_gap"` // Min horizontal gap between nodes, default to 24
+	LevelGap   float64 `json:"level_gap"`   // Vertical gap between levels, default to 48
+	// CollapseChain is the min length of the chains of Projection and Selection to be collapsed into a single
+	// node. Default to 3, and chains are never collapsed when it is negative.
+	CollapseChain int `json:"collapse_chain"`
+	// Collapsed are the IDs of the operators whose children are collapsed into a placeholder node.
+	Collapsed []string `json:"collapsed"`
+}
+
+func (o *LayoutOptions) normalize() {
+	if o.NodeWidth <= 0 {
+		o.NodeWidth = DefaultLayoutNodeWidth
+	}
+	if o.NodeHeight <= 0 {
+		o.NodeHeight = DefaultLayoutNodeHeight
+	}
+	if o.SiblingGap <= 0 {
+		o.SiblingGap = DefaultLayoutSiblingGap
+	}
+	if o.LevelGap <= 0 {
+		o.LevelGap = DefaultLayoutLevelGap
+	}
+	if o.CollapseChain == 0 {
+		o.CollapseChain = DefaultLayoutCollapseChain
+	}
+}
+
+type LayoutNodeKind string
+
+const (
+	LayoutNodeOperator LayoutNodeKind = "operator"
+	// LayoutNodeChain is a chain of operators collapsed into a node.
+	LayoutNodeChain LayoutNodeKind = "chain"
+	// LayoutNodeCollapsed is the placeholder of the collapsed children of an operator.
+	LayoutNodeCollapsed LayoutNodeKind = "collapsed"
+)
+
+type LayoutPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// LayoutNode is a box in the layout. X and Y are the coordinates of the top left corner.
+type LayoutNode struct {
+	ID   string         `json:"id"`
+	Kind LayoutNodeKind `json:"kind"`
+	// OperatorIDs are the operators represented by the node: the operator itself, the operators in the chain
+	// from top to bottom, or the hidden operators in pre-order.
+	OperatorIDs []string `json:"operator_ids"`
+	// MPPFragment is the ID of the MPP fragment of the first operator, or 0 if it is not in MPP tasks.
+	MPPFragment int     `json:"mpp_fragment,omitempty"`
+	Depth       int     `json:"depth"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+}
+
+// LayoutEdge connects the parent to the child. Points route from the bottom of the parent to the top of the
+// child with orthogonal segments.
+type LayoutEdge struct {
+	Parent       string        `json:"parent"`
+	Child        string        `json:"child"`
+	Points       []LayoutPoint `json:"points"`
+	Rows         float64       `json:"rows"` // Rows flowing from the child to the parent
+	CriticalPath bool          `json:"critical_path"`
+}
+
+// Layout places the plan tree in a tidy drawing. The root of the plan is at the top, and the CTEs are placed
+// at the right of the plan.
+type Layout struct {
+	Width  float64      `json:"width"`
+	Height float64      `json:"height"`
+	Nodes  []LayoutNode `json:"nodes"`
+	Edges  []LayoutEdge `json:"edges"`
+}
+
+// layoutTree is a node in the layout, with the subtree laid out relative to it.
+type layoutTree struct {
+	node     *LayoutNode
+	rows     float64
+	critical bool
+	children []*layoutTree
+	offset   float64 // The horizontal offset of the center relative to the center of the parent
+	contour  contour
+}
+
+// contour is the horizontal extent of a subtree at each level, relative to the center of the subtree root.
+type contour struct {
+	left  []float64
+	right []float64
+}
+
+type layoutBuilder struct {
+	opts      LayoutOptions
+	collapsed map[string]bool
+	nextID    int
+}
+
+func (b *layoutBuilder) newTree(kind LayoutNodeKind, operators []*Node, rows float64, critical bool) *layoutTree {
+	ids := make([]string, 0, len(operators))
+	for _, op := range operators {
+		ids = append(ids, op.ID)
+	}
+	t := &layoutTree{
+		node: &LayoutNode{
+			ID:          fmt.Sprintf("n%d", b.nextID),
+			Kind:        kind,
+			OperatorIDs: ids,
+			MPPFragment: operators[0].MPPFragment,
+			Width:       b.opts.NodeWidth,
+			Height:      b.opts.NodeHeight,
+		},
+		rows:     rows,
+		critical: critical,
+	}
+	b.nextID++
+	return t
+}
+
+// chainFrom returns the chain of operators starting from the node, where each operator except the last one
+// has the next one as the only child.
+func chainFrom(node *Node) []*Node {
+	chain := []*Node{node}
+	for chainOperatorTypes[node.Type] && len(node.Children) == 1 && chainOperatorTypes[node.Children[0].Type] {
+		node = node.Children[0]
+		chain = append(chain, node)
+	}
+	return chain
+}
+
+func (b *layoutBuilder) build(node *Node) *layoutTree {
+	var t *layoutTree
+	last := node
+	if chain := chainFrom(node); b.opts.CollapseChain > 0 && len(chain) >= b.opts.CollapseChain {
+		t = b.newTree(LayoutNodeChain, chain, nodeRows(node), node.OnCriticalPath)
+		last = chain[len(chain)-1]
+	} else {
+		t = b.newTree(LayoutNodeOperator, []*Node{node}, nodeRows(node), node.OnCriticalPath)
+	}
+	if len(last.Children) == 0 {
+		return t
+	}
+	if b.collapsed[last.ID] {
+		hidden := make([]*Node, 0)
+		rows := 0.0
+		critical := false
+		for _, child := range last.Children {
+			rows += nodeRows(child)
+			critical = critical || child.OnCriticalPath
+			child.Walk(func(n *Node, _ int) bool {
+				hidden = append(hidden, n)
+				return true
+			})
+		}
+		t.children = []*layoutTree{b.newTree(LayoutNodeCollapsed, hidden, rows, critical)}
+		return t
+	}
+	for _, child := range last.Children {
+		t.children = append(t.children, b.build(child))
+	}
+	return t
+}
+
+// place lays out the subtrees of the children side by side as close as possible without overlapping at any
+// level, following Reingold and Tilford. It returns the merged contour of the children, relative to the
+// center between the first and the last child, and sets the offsets of the children relative to that center.
+func (b *layoutBuilder) place(children []*layoutTree) contour {
+	var merged contour
+	offsets := make([]float64, len(children))
+	for i, child := range children {
+		b.layoutSubtree(child)
+		if i > 0 {
+			shift := math.Inf(-1)
+			for level := 0; level < len(merged.right) && level < len(child.contour.left); level++ {
+				shift = math.Max(shift, merged.right[level]-child.contour.left[level]+b.opts.SiblingGap)
+			}
+			offsets[i] = shift
+		}
+		for level := range child.contour.left {
+			l, r := child.contour.left[level]+offsets[i], child.contour.right[level]+offsets[i]
+			if level < len(merged.left) {
+				merged.right[level] = r
+			} else {
+				merged.left = append(merged.left, l)
+				merged.right = append(merged.right, r)
+			}
+		}
+	}
+	center := (offsets[0] + offsets[len(offsets)-1]) / 2
+	for i, child := range children {
+		child.offset = offsets[i] - center
+	}
+	for level := range merged.left {
+		merged.left[level] -= center
+		merged.right[level] -= center
+	}
+	return merged
+}
+
+func (b *layoutBuilder) layoutSubtree(t *layoutTree) {
+	half := t.node.Width / 2
+	t.contour = contour{left: []float64{-half}, right: []float64{half}}
+	if len(t.children) == 0 {
+		return
+	}
+	merged := b.place(t.children)
+	t.contour.left = append(t.contour.left, merged.left...)
+	t.contour.right = append(t.contour.right, merged.right...)
+}
+
+// collect computes the absolute positions and appends the nodes and the edges to the layout.
+func (b *layoutBuilder) collect(l *Layout, t *layoutTree, centerX float64, depth int) {
+	n := t.node
+	n.Depth = depth
+	n.X = centerX - n.Width/2
+	n.Y = float64(depth) * (b.opts.NodeHeight + b.opts.LevelGap)
+	l.Nodes = append(l.Nodes, *n)
+	l.Width = math.Max(l.Width, n.X+n.Width)
+	l.Height = math.Max(l.Height, n.Y+n.Height)
+
+	for _, child := range t.children {
+		childX := centerX + child.offset
+		b.collect(l, child, childX, depth+1)
+		top := n.Y + n.Height
+		bottom := top + b.opts.LevelGap
+		points := []LayoutPoint{{X: centerX, Y: top}}
+		if childX != centerX {
+			middle := top + b.opts.LevelGap/2
+			points = append(points, LayoutPoint{X: centerX, Y: middle}, LayoutPoint{X: childX, Y: middle})
+		}
+		points = append(points, LayoutPoint{X: childX, Y: bottom})
+		l.Edges = append(l.Edges, LayoutEdge{
+			Parent:       n.ID,
+			Child:        child.node.ID,
+			Points:       points,
+			Rows:         child.rows,
+			CriticalPath: child.critical,
+		})
+	}
+}
+
+// Layout computes a tidy tree layout of the plan, so that clients only need to draw the boxes and the edges.
+// Nodes at the same level are aligned, subtrees never overlap, and parents are centered above their children.
+func (p *Plan) Layout(opts LayoutOptions) *Layout {
+	opts.normalize()
+	b := &layoutBuilder{opts: opts, collapsed: make(map[string]bool, len(opts.Collapsed))}
+	for _, id := range opts.Collapsed {
+		b.collapsed[id] = true
+	}
+	l := &Layout{Nodes: make([]LayoutNode, 0), Edges: make([]LayoutEdge, 0)}
+	if p == nil || p.Root == nil {
+		return l
+	}
+
+	// The plan and the CTEs are laid out as the subtrees of a virtual root.
+	roots := make([]*layoutTree, 0, 1+len(p.CTEs))
+	for _, root := range append([]*Node{p.Root}, p.CTEs...) {
+		roots = append(roots, b.build(root))
+	}
+	merged := b.place(roots)
+	minX := 0.0
+	for _, left := range merged.left {
+		minX = math.Min(minX, left)
+	}
+	for _, root := range roots {
+		b.collect(l, root, root.offset-minX, 0)
+	}
+	return l
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func layoutTestNode(id string, children ...*Node) *Node {
+	return &Node{ID: id, Type: id[:len(id)-2], EstRows: 10, Children: children}
+}
+
+// checkLayout checks that nodes at the same level do not overlap, and that parents are centered above their
+// children.
+func checkLayout(t *testing.T, l *Layout, opts LayoutOptions) {
+	opts.normalize()
+	levels := map[int][]LayoutNode{}
+	nodes := map[string]LayoutNode{}
+	for _, n := range l.Nodes {
+		require.GreaterOrEqual(t, n.X, 0.0)
+		require.LessOrEqual(t, n.X+n.Width, l.Width)
+		require.Equal(t, float64(n.Depth)*(opts.NodeHeight+opts.LevelGap), n.Y)
+		levels[n.Depth] = append(levels[n.Depth], n)
+		nodes[n.ID] = n
+	}
+	for _, level := range levels {
+		sort.Slice(level, func(i, j int) bool { return level[i].X < level[j].X })
+		for i := 1; i < len(level); i++ {
+			require.GreaterOrEqual(t, level[i].X-(level[i-1].X+level[i-1].Width), opts.SiblingGap-1e-9)
+		}
+	}
+
+	children := map[string][]LayoutNode{}
+	for _, e := range l.Edges {
+		parent, child := nodes[e.Parent], nodes[e.Child]
+		require.Equal(t, parent.Depth+1, child.Depth)
+		first, last := e.Points[0], e.Points[len(e.Points)-1]
+		require.Equal(t, LayoutPoint{X: parent.X + parent.Width/2, Y: parent.Y + parent.Height}, first)
+		require.Equal(t, LayoutPoint{X: child.X + child.Width/2, Y: child.Y}, last)
+		children[e.Parent] = append(children[e.Parent], child)
+	}
+	for id, cs := range children {
+		center := (cs[0].X + cs[len(cs)-1].X + cs[len(cs)-1].Width) / 2
+		require.InDelta(t, nodes[id].X+nodes[id].Width/2, center, 1e-9)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	plan := &Plan{Root: layoutTestNode("HashJoin_1",
+		layoutTestNode("TableReader_2", layoutTestNode("TableFullScan_3")),
+		layoutTestNode("HashJoin_4",
+			layoutTestNode("TableReader_5", layoutTestNode("TableFullScan_6")),
+			layoutTestNode("TableReader_7", layoutTestNode("TableFullScan_8"))),
+	)}
+	opts := LayoutOptions{NodeWidth: 100, NodeHeight: 40, SiblingGap: 10, LevelGap: 20}
+	l := plan.Layout(opts)
+	checkLayout(t, l, opts)
+	require.Len(t, l.Nodes, 8)
+	require.Len(t, l.Edges, 7)
+
+	byOperator := map[string]LayoutNode{}
+	for _, n := range l.Nodes {
+		require.Equal(t, LayoutNodeOperator, n.Kind)
+		require.Len(t, n.OperatorIDs, 1)
+		byOperator[n.OperatorIDs[0]] = n
+	}
+	require.Equal(t, 0.0, byOperator["TableReader_2"].X)
+	require.Equal(t, 0.0, byOperator["TableFullScan_3"].X)
+	require.Equal(t, 110.0, byOperator["TableReader_5"].X)
+	require.Equal(t, 220.0, byOperator["TableReader_7"].X)
+	require.Equal(t, 165.0, byOperator["HashJoin_4"].X)
+	require.Equal(t, 82.5, byOperator["HashJoin_1"].X)
+	require.Equal(t, 320.0, l.Width)
+	require.Equal(t, 40.0*4+20*3, l.Height)
+
+	// Single child is placed right below the parent with a straight edge.
+	for _, e := range l.Edges {
+		if e.Parent == byOperator["TableReader_2"].ID {
+			require.Len(t, e.Points, 2)
+		}
+	}
+}
+
+func TestLayoutCollapse(t *testing.T) {
+	plan := &Plan{Root: layoutTestNode("Projection_1",
+		layoutTestNode("Selection_2",
+			layoutTestNode("Projection_3",
+				layoutTestNode("HashAgg_4",
+					layoutTestNode("Projection_5", layoutTestNode("Selection_6", layoutTestNode("TableFullScan_7"))),
+					layoutTestNode("TableFullScan_8"))))),
+	}
+
+	l := plan.Layout(LayoutOptions{})
+	checkLayout(t, l, LayoutOptions{})
+	require.Len(t, l.Nodes, 6)
+	require.Equal(t, LayoutNodeChain, l.Nodes[0].Kind)
+	require.Equal(t, []string{"Projection_1", "Selection_2", "Projection_3"}, l.Nodes[0].OperatorIDs)
+	require.Equal(t, []string{"HashAgg_4"}, l.Nodes[1].OperatorIDs)
+	// The chain of 2 operators is not collapsed.
+	require.Equal(t, []string{"Projection_5"}, l.Nodes[2].OperatorIDs)
+
+	l = plan.Layout(LayoutOptions{CollapseChain: -1})
+	require.Len(t, l.Nodes, 8)
+
+	l = plan.Layout(LayoutOptions{CollapseChain: 2, Collapsed: []string{"Projection_3", "Selection_6"}})
+	checkLayout(t, l, LayoutOptions{})
+	require.Len(t, l.Nodes, 2)
+	require.Equal(t, LayoutNodeCollapsed, l.Nodes[1].Kind)
+	require.Equal(t, []string{"HashAgg_4", "Projection_5", "Selection_6", "TableFullScan_7", "TableFullScan_8"}, l.Nodes[1].OperatorIDs)
+	require.Equal(t, 10.0, l.Edges[0].Rows)
+}
+
+func TestLayoutCTEs(t *testing.T) {
+	plan := &Plan{
+		Root: layoutTestNode("CTEFullScan_1"),
+		CTEs: []*Node{layoutTestNode("CTE_0_2", layoutTestNode("TableFullScan_3"))},
+	}
+	l := plan.Layout(LayoutOptions{})
+	checkLayout(t, l, LayoutOptions{})
+	require.Len(t, l.Nodes, 3)
+	require.Len(t, l.Edges, 1)
+	require.Equal(t, 0, l.Nodes[1].Depth)
+	require.Greater(t, l.Nodes[1].X, l.Nodes[0].X)
+
+	require.Empty(t, (&Plan{}).Layout(LayoutOptions{}).Nodes)
+}
+
+// buildLargePlan builds a plan like TPC-DS queries, with a long left-deep join tree whose inputs are filtered
+// scans or aggregated subqueries.
+func buildLargePlan(inputs int, seq *int) *Node {
+	newNode := func(typ string, children ...*Node) *Node {
+		*seq++
+		return &Node{ID: fmt.Sprintf("%s_%d", typ, *seq), Type: typ, Children: children}
+	}
+	var root *Node
+	for i := 0; i < inputs; i++ {
+		var input *Node
+		if i%10 == 9 {
+			input = newNode("HashAgg", buildLargePlan(4, seq))
+		} else {
+			input = newNode("Projection", newNode("Selection", newNode("Projection",
+				newNode("TableReader", newNode("Selection", newNode("TableFullScan"))))))
+		}
+		if root == nil {
+			root = input
+		} else {
+			root = newNode("HashJoin", root, input)
+		}
+	}
+	return newNode("Projection", root)
+}
+
+func TestLayoutLargePlan(t *testing.T) {
+	seq := 0
+	plan := &Plan{Root: buildLargePlan(80, &seq)}
+	require.Greater(t, plan.Root.Len(), 500)
+
+	for _, opts := range []LayoutOptions{{}, {CollapseChain: -1}} {
+		l := plan.Layout(opts)
+		checkLayout(t, l, opts)
+		require.Len(t, l.Edges, len(l.Nodes)-1)
+		operators := 0
+		for _, n := range l.Nodes {
+			operators += len(n.OperatorIDs)
+		}
+		require.Equal(t, plan.Root.Len(), operators)
+	}
+}
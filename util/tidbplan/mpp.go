@@ -0,0 +1,198 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	exchangeTypeRegex = regexp.MustCompile(`ExchangeType:\s*(\w+)`)
+	hashColsRegex     = regexp.MustCompile(`Hash Cols:\s*(\[.*\])`)
+)
+
+// ExchangeType is how an ExchangeSender sends the data to the ExchangeReceivers of the parent fragment.
+type ExchangeType string
+
+const (
+	// ExchangePassThrough sends all data to a single receiver, e.g. to TiDB from the top fragment.
+	ExchangePassThrough ExchangeType = "PassThrough"
+	// ExchangeBroadcast sends all data to every receiver, usually the build side of a join.
+	ExchangeBroadcast ExchangeType = "Broadcast"
+	// ExchangeHashPartition shuffles the data to the receivers by the hash of the columns.
+	ExchangeHashPartition ExchangeType = "HashPartition"
+)
+
+// MPPFragment is a part of the plan executed by the TiFlash MPP tasks. Each fragment starts from an
+// ExchangeSender, and ends at the ExchangeReceivers which receive the data from the child fragments.
+type MPPFragment struct {
+	ID             int          `json:"id"` // Starting from 1
+	ExchangeSender string       `json:"exchange_sender"`
+	ExchangeType   ExchangeType `json:"exchange_type"`
+	HashCols       string       `json:"hash_cols,omitempty"` // Only for HashPartition
+	// Parent is the fragment receiving the data, or 0 if the data is sent to TiDB.
+	Parent    int      `json:"parent"`
+	Children  []int    `json:"children"`
+	Operators []string `json:"operators"` // In pre-order, starting from the ExchangeSender
+
+	Stats *MPPFragmentStats `json:"stats,omitempty"` // Absent when the plan is not executed
+}
+
+// MPPFragmentStats is aggregated from the runtime stats of the operators in the fragment.
+type MPPFragmentStats struct {
+	// Task is the `tiflash_task` of the ExchangeSender, which covers the whole fragment, as the time of TiFlash
+	// operators includes their children.
+	Task *TaskStats `json:"tiflash_task,omitempty"`
+	// Time is the max time of the operators among the tasks.
+	Time time.Duration `json:"time"`
+	// Tasks and Threads are the max numbers among the operators.
+	Tasks   int64 `json:"tasks"`
+	Threads int64 `json:"threads"`
+
+	SentRows     float64 `json:"sent_rows"`     // Rows sent by the ExchangeSender
+	ReceivedRows float64 `json:"received_rows"` // Rows received from the child fragments
+	ScannedRows  float64 `json:"scanned_rows"`  // Rows read by the table scans in the fragment
+}
+
+// Label describes the fragment in a line, e.g. `Fragment 2: HashPartition [test.t.a], 4 tasks`.
+func (f *MPPFragment) Label() string {
+	label := fmt.Sprintf("Fragment %d: %s", f.ID, f.ExchangeType)
+	if f.HashCols != "" {
+		label += " " + f.HashCols
+	}
+	if f.Stats != nil && f.Stats.Tasks > 0 {
+		label += fmt.Sprintf(", %d tasks", f.Stats.Tasks)
+	}
+	if f.Stats != nil && f.Stats.Time > 0 {
+		label += fmt.Sprintf(", %s", f.Stats.Time)
+	}
+	return label
+}
+
+// fragmentNodeIDs returns the IDs assigned to the operators of the fragment in the plan tree or the CTEs, in
+// pre-order.
+func (p *Plan) fragmentNodeIDs(fragment int, ids map[*Node]string) []string {
+	members := make([]string, 0)
+	p.walkAll(func(node *Node, _ int) bool {
+		if node.MPPFragment == fragment {
+			members = append(members, ids[node])
+		}
+		return true
+	})
+	return members
+}
+
+func parseExchange(node *Node) (ExchangeType, string) {
+	var typ ExchangeType
+	if m := exchangeTypeRegex.FindStringSubmatch(node.OperatorInfo); m != nil {
+		typ = ExchangeType(m[1])
+	}
+	var hashCols string
+	if m := hashColsRegex.FindStringSubmatch(node.OperatorInfo); m != nil {
+		hashCols = m[1]
+	}
+	return typ, hashCols
+}
+
+func isTableScan(node *Node) bool {
+	return strings.HasPrefix(node.Type, "Table") && strings.HasSuffix(node.Type, "Scan")
+}
+
+// GroupMPPFragments splits the operators in MPP tasks into fragments by the ExchangeSenders. The fragment IDs
+// are filled into the operators, and the fragments are filled into the plan. It is called by Analyze.
+func (p *Plan) GroupMPPFragments() []*MPPFragment {
+	fragments := make([]*MPPFragment, 0)
+	if p == nil || p.Root == nil {
+		return fragments
+	}
+
+	var group func(node *Node, fragment *MPPFragment)
+	group = func(node *Node, fragment *MPPFragment) {
+		if node.Type == "ExchangeSender" {
+			typ, hashCols := parseExchange(node)
+			f := &MPPFragment{
+				ID:             len(fragments) + 1,
+				ExchangeSender: node.ID,
+				ExchangeType:   typ,
+				HashCols:       hashCols,
+				Children:       make([]int, 0),
+			}
+			if fragment != nil {
+				f.Parent = fragment.ID
+				fragment.Children = append(fragment.Children, f.ID)
+			}
+			fragments = append(fragments, f)
+			fragment = f
+		}
+		node.MPPFragment = 0
+		if fragment != nil {
+			node.MPPFragment = fragment.ID
+			fragment.Operators = append(fragment.Operators, node.ID)
+		}
+		for _, child := range node.Children {
+			// Operators pushed down from the MPP tasks, if any, are not in the fragment.
+			if fragment != nil && !strings.HasPrefix(child.Task, "mpp") {
+				group(child, nil)
+			} else {
+				group(child, fragment)
+			}
+		}
+	}
+	group(p.Root, nil)
+	for _, cte := range p.CTEs {
+		group(cte, nil)
+	}
+
+	nodes := map[int][]*Node{}
+	walk := func(node *Node, _ int) bool {
+		if node.MPPFragment > 0 {
+			nodes[node.MPPFragment] = append(nodes[node.MPPFragment], node)
+		}
+		return true
+	}
+	p.walkAll(walk)
+	for _, f := range fragments {
+		f.Stats = fragmentStats(nodes[f.ID])
+	}
+
+	p.MPPFragments = fragments
+	return fragments
+}
+
+// fragmentStats aggregates the runtime stats of the operators in the fragment, where the first operator is the
+// ExchangeSender. Returns nil if the plan is not executed.
+func fragmentStats(nodes []*Node) *MPPFragmentStats {
+	if len(nodes) == 0 || nodes[0].RuntimeStats == nil {
+		return nil
+	}
+	stats := &MPPFragmentStats{Task: nodes[0].RuntimeStats.TiFlashTask}
+	for i, node := range nodes {
+		if t := operatorTime(node); t > stats.Time {
+			stats.Time = t
+		}
+		if node.RuntimeStats != nil && node.RuntimeStats.TiFlashTask != nil {
+			task := node.RuntimeStats.TiFlashTask
+			if task.Tasks > stats.Tasks {
+				stats.Tasks = task.Tasks
+			}
+			if task.Threads > stats.Threads {
+				stats.Threads = task.Threads
+			}
+		}
+		if node.ActRows == nil {
+			continue
+		}
+		switch {
+		case i == 0:
+			stats.SentRows = *node.ActRows
+		case node.Type == "ExchangeReceiver":
+			stats.ReceivedRows += *node.ActRows
+		case isTableScan(node):
+			stats.ScannedRows += *node.ActRows
+		}
+	}
+	return stats
+}
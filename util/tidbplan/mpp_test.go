@@ -0,0 +1,129 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupMPPFragments(t *testing.T) {
+	plan := mustParseTestData(t, "mpp_join.txt")
+	plan.Analyze(DefaultTopN)
+
+	fragments := plan.MPPFragments
+	require.Len(t, fragments, 3)
+
+	require.Equal(t, 1, fragments[0].ID)
+	require.Equal(t, "ExchangeSender_23", fragments[0].ExchangeSender)
+	require.Equal(t, ExchangePassThrough, fragments[0].ExchangeType)
+	require.Empty(t, fragments[0].HashCols)
+	require.Equal(t, 0, fragments[0].Parent)
+	require.Equal(t, []int{2, 3}, fragments[0].Children)
+	require.Equal(t, []string{
+		"ExchangeSender_23", "HashAgg_9", "HashJoin_13", "ExchangeReceiver_17(Build)", "ExchangeReceiver_21(Probe)",
+	}, fragments[0].Operators)
+
+	require.Equal(t, ExchangeHashPartition, fragments[1].ExchangeType)
+	require.Equal(t, "[name: test.t1.a, collate: binary]", fragments[1].HashCols)
+	require.Equal(t, 1, fragments[1].Parent)
+	require.Empty(t, fragments[1].Children)
+	require.Equal(t, []string{"ExchangeSender_16", "Selection_15", "TableFullScan_14"}, fragments[1].Operators)
+	require.Equal(t, []string{"ExchangeSender_20", "Selection_19", "TableFullScan_18"}, fragments[2].Operators)
+
+	// Operators in TiDB are not in any fragment.
+	require.Equal(t, 0, plan.Root.MPPFragment)
+	require.Equal(t, 0, plan.Root.Children[0].MPPFragment)
+	require.Equal(t, 1, plan.Root.Children[0].Children[0].MPPFragment)
+
+	stats := fragments[0].Stats
+	require.NotNil(t, stats)
+	require.Equal(t, 21500*time.Microsecond, stats.Task.ProcMax)
+	require.Equal(t, 21500*time.Microsecond, stats.Time)
+	require.Equal(t, int64(2), stats.Tasks)
+	require.Equal(t, int64(4), stats.Threads)
+	require.Equal(t, 1.0, stats.SentRows)
+	require.Equal(t, 8.0, stats.ReceivedRows)
+	require.Equal(t, 0.0, stats.ScannedRows)
+
+	stats = fragments[2].Stats
+	require.Equal(t, 17600*time.Microsecond, stats.Time)
+	require.Equal(t, 5.0, stats.SentRows)
+	require.Equal(t, 6.0, stats.ScannedRows)
+
+	require.Equal(t, "Fragment 2: HashPartition [name: test.t1.a, collate: binary], 2 tasks, 12.1ms",
+		fragments[1].Label())
+}
+
+func TestGroupMPPFragmentsWithoutMPP(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	require.Empty(t, plan.GroupMPPFragments())
+	require.Empty(t, plan.MPPFragments)
+
+	plan, err := Parse("\tid\ttask\testRows\toperator info\n" +
+		"\tTableReader_12\troot\t10\tdata:ExchangeSender_11\n" +
+		"\t└─ExchangeSender_11\tmpp[tiflash]\t10\tExchangeType: PassThrough\n" +
+		"\t  └─TableFullScan_10\tmpp[tiflash]\t10\ttable:t\n")
+	require.NoError(t, err)
+	fragments := plan.GroupMPPFragments()
+	require.Len(t, fragments, 1)
+	require.Nil(t, fragments[0].Stats)
+	require.Equal(t, "Fragment 1: PassThrough", fragments[0].Label())
+}
+
+func TestMPPFragmentsExport(t *testing.T) {
+	plan := mustParseTestData(t, "mpp_join.txt")
+
+	dot := string(plan.DOT())
+	require.Contains(t, dot, "  subgraph cluster_f1 {\n")
+	require.Contains(t, dot, "    n2; n3; n4; n5; n9;\n")
+	require.Contains(t, dot, "  subgraph cluster_f3 {\n")
+	require.Contains(t, dot, "label=\"Fragment 1: PassThrough, 2 tasks, 21.5ms\"")
+
+	mermaid := string(plan.Mermaid())
+	require.Contains(t, mermaid, "  subgraph f2[\"Fragment 2: HashPartition [name: test.t1.a, collate: binary], 2 tasks, 12.1ms\"]\n"+
+		"    n6\n    n7\n    n8\n  end\n")
+	require.Equal(t, 3, strings.Count(mermaid, "  end\n"))
+
+	layout := plan.Layout(LayoutOptions{CollapseChain: -1})
+	require.Equal(t, 0, layout.Nodes[0].MPPFragment)
+	require.Equal(t, 1, layout.Nodes[2].MPPFragment)
+	require.Equal(t, 3, layout.Nodes[len(layout.Nodes)-1].MPPFragment)
+}
+
+func TestMPPFragmentsInCTEs(t *testing.T) {
+	plan := &Plan{
+		Root: &Node{ID: "CTEFullScan_20", Type: "CTEFullScan", Task: "root", EstRows: 10},
+		CTEs: []*Node{{
+			ID: "TableReader_12", Type: "TableReader", Task: "root", EstRows: 10,
+			Children: []*Node{{
+				ID: "ExchangeSender_11", Type: "ExchangeSender", Task: "mpp[tiflash]", EstRows: 10,
+				OperatorInfo: "ExchangeType: PassThrough",
+				Children: []*Node{
+					{ID: "TableFullScan_10", Type: "TableFullScan", Task: "mpp[tiflash]", EstRows: 10},
+				},
+			}},
+		}},
+	}
+	plan.Analyze(DefaultTopN)
+	require.Len(t, plan.MPPFragments, 1)
+	require.Equal(t, []string{"n2", "n3"}, plan.fragmentNodeIDs(1, map[*Node]string{
+		plan.Root:                            "n0",
+		plan.CTEs[0]:                         "n1",
+		plan.CTEs[0].Children[0]:             "n2",
+		plan.CTEs[0].Children[0].Children[0]: "n3",
+	}))
+
+	dot := string(plan.DOT())
+	require.Contains(t, dot, "  n3 [label=\"TableFullScan_10")
+	require.Contains(t, dot, "  subgraph cluster_f1 {\n")
+	require.Contains(t, dot, "    n2; n3;\n")
+	require.Contains(t, dot, "  n1 -> n2 [")
+
+	mermaid := string(plan.Mermaid())
+	require.Contains(t, mermaid, "  subgraph f1[\"Fragment 1: PassThrough\"]\n    n2\n    n3\n  end\n")
+	require.Contains(t, mermaid, "  n2 -->|\"10 rows\"| n1\n")
+}
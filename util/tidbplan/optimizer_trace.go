@@ -0,0 +1,244 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// The JSON format of the optimizer trace, see `util/tracing.OptimizeTracer` in TiDB. Plans are flattened
+// operators referencing the children by ID.
+type jsonOptimizeTracer struct {
+	Logical *struct {
+		Final []*jsonPlanTrace `json:"final"`
+		Steps []*struct {
+			Name   string           `json:"name"`
+			Before []*jsonPlanTrace `json:"before"`
+			Steps  []TraceAction    `json:"steps"`
+			Index  int              `json:"index"`
+		} `json:"steps"`
+	} `json:"logical"`
+	Physical *struct {
+		Costs      map[int]*jsonCostDetail `json:"costs"`
+		Candidates map[int]*struct {
+			jsonPlanTrace
+			Mapping string `json:"mapping"`
+		} `json:"candidates"`
+	} `json:"physical"`
+	Final      []*jsonPlanTrace `json:"final"`
+	IsFastPlan bool             `json:"isFastPlan"`
+}
+
+type jsonPlanTrace struct {
+	ID         int     `json:"id"`
+	Type       string  `json:"type"`
+	ChildrenID []int   `json:"children"`
+	Cost       float64 `json:"cost"`
+	Selected   bool    `json:"selected"`
+	Property   string  `json:"property"`
+	Info       string  `json:"info"`
+}
+
+type jsonCostDetail struct {
+	Params map[string]interface{} `json:"params"`
+	Desc   string                 `json:"desc"`
+	Cost   float64                `json:"cost"`
+}
+
+// TraceNode is an operator of a traced logical or physical plan.
+type TraceNode struct {
+	ID       int          `json:"id"`
+	Type     string       `json:"type"`
+	Info     string       `json:"info"`
+	Cost     float64      `json:"cost,omitempty"` // Only available in physical plans
+	Children []*TraceNode `json:"children,omitempty"`
+}
+
+// TraceAction is a change made by a logical rewrite rule.
+type TraceAction struct {
+	Action       string `json:"action"`
+	Reason       string `json:"reason"`
+	OperatorID   int    `json:"id"`
+	OperatorType string `json:"type"`
+}
+
+// LogicalStep is a logical rewrite rule applied to the plan.
+type LogicalStep struct {
+	Index   int           `json:"index"`
+	Rule    string        `json:"rule"`
+	Before  *TraceNode    `json:"before"`
+	After   *TraceNode    `json:"after"`
+	Actions []TraceAction `json:"actions"`
+}
+
+// PhysicalCandidate is a physical operator considered for a logical operator.
+type PhysicalCandidate struct {
+	ID       int     `json:"id"`
+	Type     string  `json:"type"`
+	Info     string  `json:"info"`
+	Property string  `json:"property"`
+	Cost     float64 `json:"cost"`
+	Selected bool    `json:"selected"`
+	// CostFormula and CostParams explain how the cost is computed, only available in newer TiDB versions.
+	CostFormula string                 `json:"cost_formula,omitempty"`
+	CostParams  map[string]interface{} `json:"cost_params,omitempty"`
+}
+
+// LogicalCandidates are the physical alternatives of a logical operator, sorted by cost. For a DataSource,
+// these are the table scans and index paths, which answer why an index is not chosen.
+type LogicalCandidates struct {
+	LogicalOperator string              `json:"logical_operator"`
+	Candidates      []PhysicalCandidate `json:"candidates"`
+}
+
+// OptimizerTrace is the step by step trace of the optimizer.
+type OptimizerTrace struct {
+	// IsFastPlan is true when the statement is a point get, for which the optimizer is bypassed.
+	IsFastPlan   bool                 `json:"is_fast_plan"`
+	LogicalSteps []LogicalStep        `json:"logical_steps"`
+	LogicalPlan  *TraceNode           `json:"logical_plan"` // After all rewrite rules
+	Physical     []*LogicalCandidates `json:"physical"`
+	FinalPlan    *TraceNode           `json:"final_plan"`
+}
+
+// buildTraceTree builds the tree of the flattened operators. The root is the operator not referenced as a
+// child by others.
+func buildTraceTree(ops []*jsonPlanTrace) *TraceNode {
+	nodes := make(map[int]*TraceNode, len(ops))
+	isChild := make(map[int]bool)
+	for _, op := range ops {
+		if op == nil {
+			continue
+		}
+		nodes[op.ID] = &TraceNode{ID: op.ID, Type: op.Type, Info: op.Info, Cost: op.Cost}
+		for _, id := range op.ChildrenID {
+			isChild[id] = true
+		}
+	}
+	var root *TraceNode
+	for _, op := range ops {
+		if op == nil {
+			continue
+		}
+		node := nodes[op.ID]
+		for _, id := range op.ChildrenID {
+			if child, ok := nodes[id]; ok {
+				node.Children = append(node.Children, child)
+			}
+		}
+		if root == nil && !isChild[op.ID] {
+			root = node
+		}
+	}
+	return root
+}
+
+// ParseOptimizerTrace parses the JSON of the optimizer trace.
+func ParseOptimizerTrace(data []byte) (*OptimizerTrace, error) {
+	var t jsonOptimizeTracer
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, ErrInvalidPlan.Wrap(err, "invalid optimizer trace")
+	}
+	trace := &OptimizerTrace{
+		IsFastPlan:   t.IsFastPlan,
+		LogicalSteps: make([]LogicalStep, 0),
+		Physical:     make([]*LogicalCandidates, 0),
+		FinalPlan:    buildTraceTree(t.Final),
+	}
+
+	if t.Logical != nil {
+		trace.LogicalPlan = buildTraceTree(t.Logical.Final)
+		for _, step := range t.Logical.Steps {
+			if step == nil {
+				continue
+			}
+			actions := step.Steps
+			if actions == nil {
+				actions = make([]TraceAction, 0)
+			}
+			trace.LogicalSteps = append(trace.LogicalSteps, LogicalStep{
+				Index:   step.Index,
+				Rule:    step.Name,
+				Before:  buildTraceTree(step.Before),
+				Actions: actions,
+			})
+			// The plan after a rule is the plan before the next rule.
+			if n := len(trace.LogicalSteps); n > 1 {
+				trace.LogicalSteps[n-2].After = trace.LogicalSteps[n-1].Before
+			}
+		}
+		if n := len(trace.LogicalSteps); n > 0 {
+			trace.LogicalSteps[n-1].After = trace.LogicalPlan
+		}
+	}
+
+	if t.Physical != nil {
+		groups := make(map[string]*LogicalCandidates)
+		for _, c := range t.Physical.Candidates {
+			if c == nil {
+				continue
+			}
+			group, ok := groups[c.Mapping]
+			if !ok {
+				group = &LogicalCandidates{LogicalOperator: c.Mapping}
+				groups[c.Mapping] = group
+				trace.Physical = append(trace.Physical, group)
+			}
+			candidate := PhysicalCandidate{
+				ID:       c.ID,
+				Type:     c.Type,
+				Info:     c.Info,
+				Property: c.Property,
+				Cost:     c.Cost,
+				Selected: c.Selected,
+			}
+			if detail := t.Physical.Costs[c.ID]; detail != nil {
+				candidate.CostFormula = detail.Desc
+				candidate.CostParams = detail.Params
+			}
+			group.Candidates = append(group.Candidates, candidate)
+		}
+		for _, group := range trace.Physical {
+			sort.Slice(group.Candidates, func(i, j int) bool {
+				a, b := group.Candidates[i], group.Candidates[j]
+				if a.Cost != b.Cost {
+					return a.Cost < b.Cost
+				}
+				return a.ID < b.ID
+			})
+		}
+		sort.Slice(trace.Physical, func(i, j int) bool {
+			return trace.Physical[i].LogicalOperator < trace.Physical[j].LogicalOperator
+		})
+	}
+	return trace, nil
+}
+
+// ParseOptimizerTraceZip parses the optimizer trace in the zip file dumped by `TRACE PLAN`.
+func ParseOptimizerTraceZip(data []byte) (*OptimizerTrace, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidPlan.Wrap(err, "invalid optimizer trace file")
+	}
+	for _, f := range r.File {
+		if path.Ext(f.Name) != ".json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, ErrInvalidPlan.Wrap(err, "invalid optimizer trace file")
+		}
+		content, err := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, ErrInvalidPlan.Wrap(err, "invalid optimizer trace file")
+		}
+		return ParseOptimizerTrace(content)
+	}
+	return nil, ErrInvalidPlan.New("optimizer trace is missing in the file")
+}
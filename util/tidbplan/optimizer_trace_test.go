@@ -0,0 +1,113 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+const testOptimizerTrace = `{
+  "logical": {
+    "final": [
+      {"id": 4, "type": "Projection", "children": [1], "info": "test.t.a"},
+      {"id": 1, "type": "DataSource", "children": null, "info": "table:t, cond:[eq(test.t.b, 1)]"}
+    ],
+    "steps": [
+      {
+        "name": "predicate_push_down",
+        "index": 0,
+        "before": [
+          {"id": 3, "type": "Projection", "children": [2], "info": "test.t.a"},
+          {"id": 2, "type": "Selection", "children": [1], "info": "eq(test.t.b, 1)"},
+          {"id": 1, "type": "DataSource", "children": null, "info": "table:t"}
+        ],
+        "steps": [
+          {"action": "Selection_2 is removed", "reason": "The conditions are pushed down to DataSource_1", "id": 2, "type": "Selection", "index": 0}
+        ]
+      },
+      {
+        "name": "column_prune",
+        "index": 1,
+        "before": [
+          {"id": 3, "type": "Projection", "children": [1], "info": "test.t.a"},
+          {"id": 1, "type": "DataSource", "children": null, "info": "table:t, cond:[eq(test.t.b, 1)]"}
+        ],
+        "steps": null
+      }
+    ]
+  },
+  "physical": {
+    "costs": {
+      "8": {"id": 8, "type": "IndexLookUp", "desc": "(index-scan-cost + table-scan-cost) / concurrency", "cost": 5000, "params": {"rows": 100}}
+    },
+    "candidates": {
+      "7": {"id": 7, "type": "TableFullScan", "cost": 3000, "selected": true, "property": "", "info": "table:t", "mapping": "DataSource_1"},
+      "8": {"id": 8, "type": "IndexLookUp", "cost": 5000, "selected": false, "property": "", "info": "index:idx_b(b)", "mapping": "DataSource_1"},
+      "9": {"id": 9, "type": "Projection", "cost": 3100, "selected": true, "info": "test.t.a", "mapping": "Projection_4"}
+    }
+  },
+  "final": [
+    {"id": 9, "type": "Projection", "children": [10], "cost": 3100, "info": "test.t.a"},
+    {"id": 10, "type": "TableReader", "children": [7], "cost": 3050, "info": "data:TableFullScan_7"},
+    {"id": 7, "type": "TableFullScan", "children": null, "cost": 3000, "info": "table:t"}
+  ],
+  "isFastPlan": false
+}`
+
+func TestParseOptimizerTrace(t *testing.T) {
+	trace, err := ParseOptimizerTrace([]byte(testOptimizerTrace))
+	require.NoError(t, err)
+	require.False(t, trace.IsFastPlan)
+
+	require.Len(t, trace.LogicalSteps, 2)
+	step := trace.LogicalSteps[0]
+	require.Equal(t, "predicate_push_down", step.Rule)
+	require.Equal(t, "Projection", step.Before.Type)
+	require.Equal(t, "Selection", step.Before.Children[0].Type)
+	require.Equal(t, "DataSource", step.After.Children[0].Type)
+	require.Len(t, step.Actions, 1)
+	require.Equal(t, "Selection", step.Actions[0].OperatorType)
+	require.Same(t, trace.LogicalSteps[1].Before, step.After)
+	require.Same(t, trace.LogicalPlan, trace.LogicalSteps[1].After)
+	require.NotNil(t, trace.LogicalSteps[1].Actions)
+	require.Equal(t, 4, trace.LogicalPlan.ID)
+
+	require.Len(t, trace.Physical, 2)
+	ds := trace.Physical[0]
+	require.Equal(t, "DataSource_1", ds.LogicalOperator)
+	require.Len(t, ds.Candidates, 2)
+	require.Equal(t, "TableFullScan", ds.Candidates[0].Type)
+	require.True(t, ds.Candidates[0].Selected)
+	require.Equal(t, "IndexLookUp", ds.Candidates[1].Type)
+	require.Equal(t, "(index-scan-cost + table-scan-cost) / concurrency", ds.Candidates[1].CostFormula)
+	require.Equal(t, 100.0, ds.Candidates[1].CostParams["rows"])
+	require.Equal(t, "Projection_4", trace.Physical[1].LogicalOperator)
+
+	require.Equal(t, "Projection", trace.FinalPlan.Type)
+	require.Equal(t, 3100.0, trace.FinalPlan.Cost)
+	require.Equal(t, "TableFullScan", trace.FinalPlan.Children[0].Children[0].Type)
+}
+
+func TestParseOptimizerTraceZip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("optimizer_trace/trace.json")
+	require.NoError(t, err)
+	_, err = f.Write([]byte(testOptimizerTrace))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	trace, err := ParseOptimizerTraceZip(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, trace.LogicalSteps, 2)
+
+	_, err = ParseOptimizerTraceZip([]byte("not zip"))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+	_, err = ParseOptimizerTrace([]byte("{"))
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+}
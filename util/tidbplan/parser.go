@@ -0,0 +1,249 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type column int
+
+const (
+	columnUnknown column = iota
+	columnID
+	columnTask
+	columnEstRows
+	columnEstCost
+	columnActRows
+	columnAccessObject
+	columnOperatorInfo
+	columnExecutionInfo
+	columnMemory
+	columnDisk
+)
+
+// columnByHeader maps the normalized (lower case, without spaces) header name to the column.
+var columnByHeader = map[string]column{
+	"id":            columnID,
+	"task":          columnTask,
+	"estrows":       columnEstRows,
+	"count":         columnEstRows, // Before TiDB 4.0
+	"estcost":       columnEstCost, // Only in EXPLAIN FORMAT='verbose'
+	"actrows":       columnActRows,
+	"accessobject":  columnAccessObject,
+	"operatorinfo":  columnOperatorInfo,
+	"executioninfo": columnExecutionInfo,
+	"memory":        columnMemory,
+	"disk":          columnDisk,
+}
+
+// defaultColumns is the column layout used by the plans in statements summary and slow log,
+// which is applied when the plan text does not contain a header line.
+var defaultColumns = []column{
+	columnID,
+	columnTask,
+	columnEstRows,
+	columnOperatorInfo,
+	columnActRows,
+	columnExecutionInfo,
+	columnMemory,
+	columnDisk,
+}
+
+var (
+	operatorSuffixRegex = regexp.MustCompile(`_\d+$`)
+	operatorLabelRegex  = regexp.MustCompile(`\((Build|Probe|Seed Part|Recursive Part)\)$`)
+)
+
+// Parse parses the tab separated plan text produced by TiDB, i.e. the `plan` column of the statements summary,
+// the `Plan` column of the slow query, into a plan tree. The indentation prefixes of the operator IDs
+// (for example `└─`) determine the tree structure. Plans encoded by TiDB are decoded first.
+func Parse(planText string) (*Plan, error) {
+	if IsEncoded(planText) {
+		return ParseEncoded(planText)
+	}
+	columns := defaultColumns
+	var b treeBuilder
+
+	for _, line := range strings.Split(planText, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) > 1 && strings.TrimSpace(fields[0]) == "" && strings.HasPrefix(line, "\t") {
+			// The plan in statements summary and slow log starts each line with a tab.
+			fields = fields[1:]
+		}
+		if isHeader(fields) {
+			columns = parseHeader(fields)
+			continue
+		}
+		if err := b.addRow(fields, columns); err != nil {
+			return nil, err
+		}
+	}
+	return b.plan()
+}
+
+// ParseRows parses the result set of an EXPLAIN statement into a plan tree.
+func ParseRows(columnNames []string, rows [][]string) (*Plan, error) {
+	columns := parseHeader(columnNames)
+	var b treeBuilder
+	for _, row := range rows {
+		if err := b.addRow(row, columns); err != nil {
+			return nil, err
+		}
+	}
+	return b.plan()
+}
+
+// treeBuilder assembles the plan tree from the rows in the display order.
+type treeBuilder struct {
+	root  *Node
+	stack []*Node
+}
+
+func (b *treeBuilder) addRow(fields []string, columns []column) error {
+	node, depth, err := parseRow(fields, columns)
+	if err != nil {
+		return err
+	}
+	if depth == 0 {
+		if b.root != nil {
+			return ErrInvalidPlan.New("plan contains multiple root operators: %s, %s", b.root.ID, node.ID)
+		}
+		b.root = node
+		b.stack = []*Node{node}
+		return nil
+	}
+	if b.root == nil {
+		return ErrInvalidPlan.New("operator %s has no parent", node.ID)
+	}
+	if depth > len(b.stack) {
+		// Tolerate unexpected indentations by attaching to the deepest known operator.
+		depth = len(b.stack)
+	}
+	parent := b.stack[depth-1]
+	parent.Children = append(parent.Children, node)
+	b.stack = append(b.stack[:depth], node)
+	return nil
+}
+
+func (b *treeBuilder) plan() (*Plan, error) {
+	if b.root == nil {
+		return nil, ErrInvalidPlan.New("plan is empty")
+	}
+	return &Plan{Root: b.root}, nil
+}
+
+func normalizeHeader(field string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(field), " ", ""))
+}
+
+func isHeader(fields []string) bool {
+	return len(fields) > 1 && normalizeHeader(fields[0]) == "id"
+}
+
+func parseHeader(fields []string) []column {
+	columns := make([]column, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, columnByHeader[normalizeHeader(field)])
+	}
+	return columns
+}
+
+func parseRow(fields []string, columns []column) (*Node, int, error) {
+	node := &Node{}
+	depth := 0
+	for i, field := range fields {
+		if i >= len(columns) {
+			break
+		}
+		value := strings.TrimSpace(field)
+		switch columns[i] {
+		case columnID:
+			var id string
+			depth, id = splitTreePrefix(field)
+			node.ID = id
+			node.Type = OperatorType(id)
+		case columnTask:
+			node.Task = value
+		case columnEstRows:
+			node.EstRows = parseRowCount(value)
+		case columnEstCost:
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				node.EstCost = &v
+			}
+		case columnActRows:
+			if value != "" && value != "N/A" {
+				actRows := parseRowCount(value)
+				node.ActRows = &actRows
+			}
+		case columnAccessObject:
+			node.AccessObject = value
+		case columnOperatorInfo:
+			node.OperatorInfo = value
+		case columnExecutionInfo:
+			node.ExecutionInfo = value
+			node.RuntimeStats = ParseExecutionInfo(value)
+		case columnMemory:
+			node.Memory = value
+			if v, ok := ParseBytes(value); ok {
+				node.MemoryBytes = &v
+			}
+		case columnDisk:
+			node.Disk = value
+			if v, ok := ParseBytes(value); ok {
+				node.DiskBytes = &v
+			}
+		case columnUnknown:
+		}
+	}
+	if node.ID == "" {
+		return nil, 0, ErrInvalidPlan.New("operator ID is missing in line: %s", strings.Join(fields, "\t"))
+	}
+	return node, depth, nil
+}
+
+// splitTreePrefix splits the operator ID like `  └─TableFullScan_5` into the tree depth and the ID.
+// Each level of the tree takes two characters in the prefix.
+func splitTreePrefix(field string) (int, string) {
+	field = strings.TrimRight(field, " ")
+	idx := strings.IndexFunc(field, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+	if idx < 0 {
+		return 0, strings.TrimSpace(field)
+	}
+	prefixLen := utf8.RuneCountInString(field[:idx])
+	return (prefixLen + 1) / 2, field[idx:]
+}
+
+func parseRowCount(value string) float64 {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// OperatorType extracts the operator type from the operator ID,
+// e.g. `IndexRangeScan_8(Build)` => `IndexRangeScan`.
+func OperatorType(id string) string {
+	id = strings.TrimSpace(operatorLabelRegex.ReplaceAllString(id, ""))
+	return operatorSuffixRegex.ReplaceAllString(id, "")
+}
+
+// Label returns the role label attached to the operator ID, e.g. `Build` or `Probe` for the children of joins.
+func (n *Node) Label() string {
+	m := operatorLabelRegex.FindStringSubmatch(n.ID)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
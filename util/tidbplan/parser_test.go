@@ -0,0 +1,125 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseTestData(t *testing.T, name string) *Plan {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	plan, err := Parse(string(content))
+	require.NoError(t, err)
+	return plan
+}
+
+func TestParseStatementPlan(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	root := plan.Root
+
+	require.Equal(t, "Sort_6", root.ID)
+	require.Equal(t, "Sort", root.Type)
+	require.Equal(t, "root", root.Task)
+	require.Equal(t, 2.94, root.EstRows)
+	require.NotNil(t, root.ActRows)
+	require.Equal(t, 4.0, *root.ActRows)
+	require.Equal(t, "time:13.4s, loops:2", root.ExecutionInfo)
+	require.Equal(t, "45.4 KB", root.Memory)
+	require.Equal(t, "0 Bytes", root.Disk)
+	require.Equal(t, 7, root.Len())
+
+	var ids []string
+	var depths []int
+	root.Walk(func(node *Node, depth int) bool {
+		ids = append(ids, node.ID)
+		depths = append(depths, depth)
+		return true
+	})
+	require.Equal(t, []string{
+		"Sort_6", "Projection_8", "HashAgg_9", "TableReader_10", "HashAgg_11", "Selection_13", "TableFullScan_12",
+	}, ids)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, depths)
+
+	scan := root.Children[0].Children[0].Children[0].Children[0].Children[0].Children[0]
+	require.Equal(t, "cop[tikv]", scan.Task)
+	require.Equal(t, 300005811.0, scan.EstRows)
+	require.Equal(t, "table:lineitem, keep order:false", scan.OperatorInfo)
+}
+
+func TestParseExplainAnalyze(t *testing.T) {
+	plan := mustParseTestData(t, "hash_join.txt")
+	join := plan.Root.Children[0]
+
+	require.Equal(t, "HashJoin", join.Type)
+	require.Len(t, join.Children, 2)
+
+	build, probe := join.Children[0], join.Children[1]
+	require.Equal(t, "TableReader_16(Build)", build.ID)
+	require.Equal(t, "TableReader", build.Type)
+	require.Equal(t, "Build", build.Label())
+	require.Equal(t, "Probe", probe.Label())
+	require.Len(t, build.Children, 1)
+	require.Len(t, probe.Children, 2)
+
+	scan := build.Children[0].Children[0]
+	require.Equal(t, "TableFullScan_14", scan.ID)
+	require.Equal(t, "table:t2", scan.AccessObject)
+	require.Equal(t, "keep order:false, stats:pseudo", scan.OperatorInfo)
+	require.Equal(t, 10000.0, scan.EstRows)
+	require.Equal(t, 3.0, *scan.ActRows)
+
+	require.Equal(t, "table:t1, index:idx_a(a)", probe.Children[0].AccessObject)
+}
+
+func TestParseWithoutHeader(t *testing.T) {
+	plan, err := Parse("\tProjection_3\troot\t10000\ttest.t.a\n\t└─TableReader_5\troot\t10000\tdata:TableFullScan_4\n\t  └─TableFullScan_4\tcop[tikv]\t10000\ttable:t, keep order:false\n")
+	require.NoError(t, err)
+	require.Equal(t, "Projection_3", plan.Root.ID)
+	require.Nil(t, plan.Root.ActRows)
+	require.Equal(t, "TableFullScan_4", plan.Root.Children[0].Children[0].ID)
+	require.Equal(t, "table:t, keep order:false", plan.Root.Children[0].Children[0].OperatorInfo)
+}
+
+func TestParseRows(t *testing.T) {
+	plan, err := ParseRows(
+		[]string{"id", "estRows", "estCost", "task", "access object", "operator info"},
+		[][]string{
+			{"TableReader_6", "10.00", "256.10", "root", "", "data:Selection_5"},
+			{"└─Selection_5", "10.00", "3034.00", "cop[tikv]", "", "eq(test.t.a, 1)"},
+			{"  └─TableFullScan_4", "10000.00", "2534.00", "cop[tikv]", "table:t", "keep order:false, stats:pseudo"},
+		})
+	require.NoError(t, err)
+	require.Equal(t, 3, plan.Root.Len())
+	require.Equal(t, 256.1, *plan.Root.EstCost)
+	require.Equal(t, "table:t", plan.Root.Children[0].Children[0].AccessObject)
+
+	_, err = ParseRows([]string{"id"}, nil)
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse("")
+	require.True(t, errorx.IsOfType(err, ErrInvalidPlan))
+
+	_, err = Parse("\tid\ttask\n")
+	require.Error(t, err)
+
+	_, err = Parse("\tProjection_3\troot\n\tProjection_4\troot\n")
+	require.Error(t, err)
+
+	_, err = Parse("\t└─Projection_3\troot\n")
+	require.Error(t, err)
+}
+
+func TestOperatorType(t *testing.T) {
+	require.Equal(t, "IndexRangeScan", OperatorType("IndexRangeScan_8(Build)"))
+	require.Equal(t, "ExchangeSender", OperatorType("ExchangeSender_21"))
+	require.Equal(t, "Point_Get", OperatorType("Point_Get_1"))
+	require.Equal(t, "CTEFullScan", OperatorType("CTEFullScan_17(Recursive Part)"))
+}
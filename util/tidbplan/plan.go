@@ -0,0 +1,97 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package tidbplan provides a structured model for TiDB execution plans, as well as parsers that
+// convert the plan text produced by TiDB into the model.
+package tidbplan
+
+import (
+	"time"
+
+	"github.com/joomcode/errorx"
+)
+
+var (
+	ErrNS = errorx.NewNamespace("tidb_plan")
+	// ErrInvalidPlan means the plan text cannot be recognized as a TiDB execution plan.
+	ErrInvalidPlan = ErrNS.NewType("invalid_plan")
+)
+
+// Plan is the top level of a structured execution plan.
+// The JSON layout follows the `[{"Plan": {...}}]` form described in the TiVP README.
+type Plan struct {
+	Root *Node `json:"Plan"`
+	// CTEs are the definitions of the common table expressions, only decoded from the binary plan.
+	CTEs []*Node `json:"CTEs,omitempty"`
+
+	// Filled by Analyze and CheckEstimation.
+	Analysis     *Analysis         `json:"analysis,omitempty"`
+	Estimation   *EstimationReport `json:"estimation,omitempty"`
+	MPPFragments []*MPPFragment    `json:"mpp_fragments,omitempty"` // Empty when the plan has no MPP tasks
+}
+
+// Node is a single operator in the execution plan tree.
+type Node struct {
+	ID            string   `json:"Node ID"`   // e.g. TableFullScan_12
+	Type          string   `json:"Node Type"` // e.g. TableFullScan
+	Task          string   `json:"task"`      // e.g. root, cop[tikv], mpp[tiflash]
+	EstRows       float64  `json:"Plan Rows"`
+	EstCost       *float64 `json:"Total Cost,omitempty"`  // Only available in the verbose format
+	ActRows       *float64 `json:"Actual Rows,omitempty"` // Not available when the plan is not executed
+	AccessObject  string   `json:"access object"`
+	OperatorInfo  string   `json:"operator info"`
+	ExecutionInfo string   `json:"execution info"`
+	Memory        string   `json:"memory"`
+	Disk          string   `json:"disk"`
+	Children      []*Node  `json:"Plans,omitempty"`
+
+	// Decoded from the columns above, absent when the plan is not executed.
+	RuntimeStats *RuntimeStats `json:"runtime stats,omitempty"`
+	MemoryBytes  *int64        `json:"memory bytes,omitempty"`
+	DiskBytes    *int64        `json:"disk bytes,omitempty"`
+
+	// Filled by Plan.Analyze.
+	TotalTime      time.Duration `json:"total time,omitempty"`
+	ExclusiveTime  time.Duration `json:"exclusive time,omitempty"`
+	OnCriticalPath bool          `json:"critical path,omitempty"`
+	MPPFragment    int           `json:"mpp fragment,omitempty"` // ID of the MPPFragment, or 0 if not in MPP tasks
+
+	// Filled by Plan.CheckEstimation.
+	QError       *float64 `json:"q-error,omitempty"`
+	Misestimated bool     `json:"misestimated,omitempty"`
+}
+
+// Walk visits the node and all of its descendants in depth-first pre-order.
+// The visit stops descending into children of a node when fn returns false.
+func (n *Node) Walk(fn func(node *Node, depth int) bool) {
+	n.walk(fn, 0)
+}
+
+func (n *Node) walk(fn func(node *Node, depth int) bool, depth int) {
+	if n == nil {
+		return
+	}
+	if !fn(n, depth) {
+		return
+	}
+	for _, child := range n.Children {
+		child.walk(fn, depth+1)
+	}
+}
+
+// walkAll walks the plan tree and then the trees of the CTEs.
+func (p *Plan) walkAll(fn func(node *Node, depth int) bool) {
+	p.Root.Walk(fn)
+	for _, cte := range p.CTEs {
+		cte.Walk(fn)
+	}
+}
+
+// Len returns the number of operators in the tree rooted at this node.
+func (n *Node) Len() int {
+	count := 0
+	n.Walk(func(*Node, int) bool {
+		count++
+		return true
+	})
+	return count
+}
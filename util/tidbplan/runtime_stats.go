@@ -0,0 +1,388 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsKind is the kind of a value in the execution info.
+type StatsKind string
+
+const (
+	StatsKindDuration StatsKind = "duration" // Value is in nanoseconds
+	StatsKindCount    StatsKind = "count"
+	StatsKindBytes    StatsKind = "bytes"
+	StatsKindRatio    StatsKind = "ratio" // Value is a fraction, e.g. 0.55 for 55%
+	StatsKindText     StatsKind = "text"
+	StatsKindGroup    StatsKind = "group" // A nested `{...}` group, see Items
+)
+
+// StatsItem is a single decoded key/value in the execution info. The value is normalized according to its kind.
+// Keys not recognized by the typed fields of RuntimeStats, for example keys introduced by newer TiDB versions,
+// are still available in this form.
+type StatsItem struct {
+	Key   string      `json:"key"`
+	Kind  StatsKind   `json:"kind"`
+	Value float64     `json:"value"`
+	Raw   string      `json:"raw,omitempty"`
+	Items []StatsItem `json:"items,omitempty"`
+}
+
+// Duration returns the value of a duration item.
+func (i *StatsItem) Duration() time.Duration {
+	if i == nil || i.Kind != StatsKindDuration {
+		return 0
+	}
+	return time.Duration(i.Value)
+}
+
+// Int returns the value of a count or bytes item.
+func (i *StatsItem) Int() int64 {
+	if i == nil || (i.Kind != StatsKindCount && i.Kind != StatsKindBytes) {
+		return 0
+	}
+	return int64(i.Value)
+}
+
+// Float returns the value of a numeric item.
+func (i *StatsItem) Float() float64 {
+	if i == nil {
+		return 0
+	}
+	return i.Value
+}
+
+// Lookup finds the item by a key path, e.g. `Lookup("rocksdb", "block", "cache_hit_count")`.
+// Keys are compared in a case-insensitive way. Returns nil if the item is not found.
+func (i *StatsItem) Lookup(path ...string) *StatsItem {
+	return lookupItem(i.Items, path)
+}
+
+func lookupItem(items []StatsItem, path []string) *StatsItem {
+	if len(path) == 0 {
+		return nil
+	}
+	for idx := range items {
+		if !strings.EqualFold(items[idx].Key, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			return &items[idx]
+		}
+		return lookupItem(items[idx].Items, path[1:])
+	}
+	return nil
+}
+
+// RuntimeStats is the decoded execution info of an operator.
+type RuntimeStats struct {
+	Time        time.Duration   `json:"time,omitempty"`
+	Loops       int64           `json:"loops,omitempty"`
+	Concurrency int64           `json:"concurrency,omitempty"` // 0 means the concurrency is OFF or unknown
+	CopTask     *CopTaskStats   `json:"cop_task,omitempty"`
+	TiKVTask    *TaskStats      `json:"tikv_task,omitempty"`
+	TiFlashTask *TaskStats      `json:"tiflash_task,omitempty"`
+	ScanDetail  *ScanDetail     `json:"scan_detail,omitempty"`
+	CommitTxn   *CommitTxnStats `json:"commit_txn,omitempty"`
+
+	// Items contains all decoded key/values, including those recognized by the typed fields above.
+	Items []StatsItem `json:"items"`
+}
+
+// Lookup finds the item by a key path, see StatsItem.Lookup.
+func (s *RuntimeStats) Lookup(path ...string) *StatsItem {
+	if s == nil {
+		return nil
+	}
+	return lookupItem(s.Items, path)
+}
+
+// CopTaskStats is the `cop_task: {...}` part of a reader operator, describing coprocessor requests sent from TiDB.
+type CopTaskStats struct {
+	Num               int64         `json:"num"`
+	Max               time.Duration `json:"max"`
+	Min               time.Duration `json:"min"`
+	Avg               time.Duration `json:"avg"`
+	P95               time.Duration `json:"p95"`
+	MaxProcKeys       int64         `json:"max_proc_keys"`
+	P95ProcKeys       int64         `json:"p95_proc_keys"`
+	ProcKeys          int64         `json:"proc_keys"`
+	TotProc           time.Duration `json:"tot_proc"`
+	TotWait           time.Duration `json:"tot_wait"`
+	RPCNum            int64         `json:"rpc_num"`
+	RPCTime           time.Duration `json:"rpc_time"`
+	CoprCacheHitRatio float64       `json:"copr_cache_hit_ratio"`
+}
+
+// TaskStats is the `tikv_task:{...}` or `tiflash_task:{...}` part of a coprocessor operator.
+type TaskStats struct {
+	ProcMax time.Duration `json:"proc_max"`
+	Min     time.Duration `json:"min"`
+	Avg     time.Duration `json:"avg"`
+	P80     time.Duration `json:"p80"`
+	P95     time.Duration `json:"p95"`
+	Iters   int64         `json:"iters"`
+	Tasks   int64         `json:"tasks"`
+	Threads int64         `json:"threads,omitempty"`
+	// Newer versions output `tikv_task:{time:..., loops:...}` when there is only one task.
+	Time  time.Duration `json:"time,omitempty"`
+	Loops int64         `json:"loops,omitempty"`
+}
+
+// ScanDetail is the `scan_detail: {...}` part, describing the keys scanned in TiKV.
+type ScanDetail struct {
+	TotalProcessKeys          int64 `json:"total_process_keys"`
+	TotalProcessKeysSize      int64 `json:"total_process_keys_size"`
+	TotalKeys                 int64 `json:"total_keys"`
+	RocksDBDeleteSkippedCount int64 `json:"rocksdb_delete_skipped_count"`
+	RocksDBKeySkippedCount    int64 `json:"rocksdb_key_skipped_count"`
+	RocksDBBlockCacheHitCount int64 `json:"rocksdb_block_cache_hit_count"`
+	RocksDBBlockReadCount     int64 `json:"rocksdb_block_read_count"`
+	RocksDBBlockReadByte      int64 `json:"rocksdb_block_read_byte"`
+}
+
+// CommitTxnStats is the `commit_txn: {...}` part of write statements.
+type CommitTxnStats struct {
+	Prewrite    time.Duration `json:"prewrite"`
+	GetCommitTS time.Duration `json:"get_commit_ts"`
+	Commit      time.Duration `json:"commit"`
+	RegionNum   int64         `json:"region_num"`
+	WriteKeys   int64         `json:"write_keys"`
+	WriteByte   int64         `json:"write_byte"`
+}
+
+// ParseExecutionInfo decodes the execution info column, e.g.
+// `time:13.4s, loops:4, cop_task: {num: 655, max: 2.83s, ...}`. The decoding is best-effort:
+// unknown keys are kept in Items and malformed parts never cause a failure.
+func ParseExecutionInfo(info string) *RuntimeStats {
+	info = strings.TrimSpace(info)
+	if info == "" || info == "N/A" {
+		return nil
+	}
+	p := &statsParser{input: []rune(info)}
+	items := p.parseItems(false)
+
+	stats := &RuntimeStats{Items: items}
+	stats.Time = stats.Lookup("time").Duration()
+	stats.Loops = stats.Lookup("loops").Int()
+	stats.Concurrency = stats.Lookup("Concurrency").Int()
+
+	if item := stats.Lookup("cop_task"); item != nil {
+		stats.CopTask = &CopTaskStats{
+			Num:               item.Lookup("num").Int(),
+			Max:               item.Lookup("max").Duration(),
+			Min:               item.Lookup("min").Duration(),
+			Avg:               item.Lookup("avg").Duration(),
+			P95:               item.Lookup("p95").Duration(),
+			MaxProcKeys:       item.Lookup("max_proc_keys").Int(),
+			P95ProcKeys:       item.Lookup("p95_proc_keys").Int(),
+			ProcKeys:          item.Lookup("proc_keys").Int(),
+			TotProc:           item.Lookup("tot_proc").Duration(),
+			TotWait:           item.Lookup("tot_wait").Duration(),
+			RPCNum:            item.Lookup("rpc_num").Int(),
+			RPCTime:           item.Lookup("rpc_time").Duration(),
+			CoprCacheHitRatio: item.Lookup("copr_cache_hit_ratio").Float(),
+		}
+	}
+	stats.TiKVTask = decodeTaskStats(stats.Lookup("tikv_task"))
+	stats.TiFlashTask = decodeTaskStats(stats.Lookup("tiflash_task"))
+	if item := stats.Lookup("scan_detail"); item != nil {
+		stats.ScanDetail = &ScanDetail{
+			TotalProcessKeys:          item.Lookup("total_process_keys").Int(),
+			TotalProcessKeysSize:      item.Lookup("total_process_keys_size").Int(),
+			TotalKeys:                 item.Lookup("total_keys").Int(),
+			RocksDBDeleteSkippedCount: item.Lookup("rocksdb", "delete_skipped_count").Int(),
+			RocksDBKeySkippedCount:    item.Lookup("rocksdb", "key_skipped_count").Int(),
+			RocksDBBlockCacheHitCount: item.Lookup("rocksdb", "block", "cache_hit_count").Int(),
+			RocksDBBlockReadCount:     item.Lookup("rocksdb", "block", "read_count").Int(),
+			RocksDBBlockReadByte:      item.Lookup("rocksdb", "block", "read_byte").Int(),
+		}
+	}
+	if item := stats.Lookup("commit_txn"); item != nil {
+		stats.CommitTxn = &CommitTxnStats{
+			Prewrite:    item.Lookup("prewrite").Duration(),
+			GetCommitTS: item.Lookup("get_commit_ts").Duration(),
+			Commit:      item.Lookup("commit").Duration(),
+			RegionNum:   item.Lookup("region_num").Int(),
+			WriteKeys:   item.Lookup("write_keys").Int(),
+			WriteByte:   item.Lookup("write_byte").Int(),
+		}
+	}
+	return stats
+}
+
+func decodeTaskStats(item *StatsItem) *TaskStats {
+	if item == nil {
+		return nil
+	}
+	return &TaskStats{
+		ProcMax: item.Lookup("proc max").Duration(),
+		Min:     item.Lookup("min").Duration(),
+		Avg:     item.Lookup("avg").Duration(),
+		P80:     item.Lookup("p80").Duration(),
+		P95:     item.Lookup("p95").Duration(),
+		Iters:   item.Lookup("iters").Int(),
+		Tasks:   item.Lookup("tasks").Int(),
+		Threads: item.Lookup("threads").Int(),
+		Time:    item.Lookup("time").Duration(),
+		Loops:   item.Lookup("loops").Int(),
+	}
+}
+
+// statsParser is a tolerant recursive descent parser for the `k: v, k: {k: v, ...}` format.
+type statsParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *statsParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *statsParser) skip(chars string) {
+	for !p.eof() && strings.ContainsRune(chars, p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *statsParser) parseItems(nested bool) []StatsItem {
+	items := make([]StatsItem, 0)
+	for {
+		p.skip(" ,\t")
+		if p.eof() {
+			return items
+		}
+		if p.input[p.pos] == '}' {
+			p.pos++
+			if nested {
+				return items
+			}
+			// Unbalanced closing brace at top level, ignore it.
+			continue
+		}
+		key := strings.TrimSpace(p.readUntil(":{,}"))
+		if p.eof() || p.input[p.pos] == ',' || p.input[p.pos] == '}' {
+			if key != "" {
+				items = append(items, StatsItem{Key: key, Kind: StatsKindText})
+			}
+			continue
+		}
+		if p.input[p.pos] == ':' {
+			p.pos++
+			p.skip(" \t")
+		}
+		if !p.eof() && p.input[p.pos] == '{' {
+			p.pos++
+			items = append(items, StatsItem{Key: key, Kind: StatsKindGroup, Items: p.parseItems(true)})
+			continue
+		}
+		items = append(items, newStatsItem(key, strings.TrimSpace(p.readValue())))
+	}
+}
+
+// readUntil reads until any of the stop chars.
+func (p *statsParser) readUntil(stops string) string {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(stops, p.input[p.pos]) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+// readValue reads until `,` or `}` which is not enclosed by brackets or parentheses.
+func (p *statsParser) readValue() string {
+	start := p.pos
+	depth := 0
+	for ; !p.eof(); p.pos++ {
+		switch p.input[p.pos] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',', '}':
+			if depth == 0 {
+				return string(p.input[start:p.pos])
+			}
+		}
+	}
+	return string(p.input[start:p.pos])
+}
+
+var bytesRegex = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)\s*(Bytes|B|KB|MB|GB|TB|PB)$`)
+
+var bytesUnits = map[string]float64{
+	"Bytes": 1,
+	"B":     1,
+	"KB":    1 << 10,
+	"MB":    1 << 20,
+	"GB":    1 << 30,
+	"TB":    1 << 40,
+	"PB":    1 << 50,
+}
+
+// ParseBytes parses the memory size format used by TiDB, e.g. `45.4 KB`, `0 Bytes`.
+func ParseBytes(s string) (int64, bool) {
+	m := bytesRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(math.Round(v * bytesUnits[m[2]])), true
+}
+
+// FormatBytes formats the memory size in the same way as TiDB, e.g. `45.4 KB`, `0 Bytes`.
+func FormatBytes(n int64) string {
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + " Bytes"
+	}
+	v := float64(n)
+	units := []string{"Bytes", "KB", "MB", "GB", "TB"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	s := strings.TrimRight(strings.TrimRight(strconv.FormatFloat(v, 'f', 2, 64), "0"), ".")
+	return s + " " + units[i]
+}
+
+func newStatsItem(key, raw string) StatsItem {
+	item := StatsItem{Key: key, Raw: raw}
+	if strings.HasSuffix(raw, "%") {
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64); err == nil {
+			item.Kind = StatsKindRatio
+			item.Value = v / 100
+			return item
+		}
+	}
+	if v, err := strconv.ParseFloat(raw, 64); err == nil {
+		item.Kind = StatsKindCount
+		if strings.HasSuffix(strings.ToLower(key), "ratio") {
+			item.Kind = StatsKindRatio
+		}
+		item.Value = v
+		return item
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		item.Kind = StatsKindDuration
+		item.Value = float64(d)
+		return item
+	}
+	if v, ok := ParseBytes(raw); ok {
+		item.Kind = StatsKindBytes
+		item.Value = float64(v)
+		return item
+	}
+	item.Kind = StatsKindText
+	return item
+}
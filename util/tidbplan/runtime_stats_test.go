@@ -0,0 +1,96 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbplan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecutionInfoBasic(t *testing.T) {
+	stats := ParseExecutionInfo("time:13.4s, loops:5, Concurrency:OFF")
+	require.Equal(t, time.Duration(13.4*float64(time.Second)), stats.Time)
+	require.Equal(t, int64(5), stats.Loops)
+	require.Equal(t, int64(0), stats.Concurrency)
+	require.Equal(t, StatsKindText, stats.Lookup("concurrency").Kind)
+	require.Equal(t, "OFF", stats.Lookup("concurrency").Raw)
+
+	require.Nil(t, ParseExecutionInfo(""))
+	require.Nil(t, ParseExecutionInfo("N/A"))
+}
+
+func TestParseExecutionInfoCopTask(t *testing.T) {
+	stats := ParseExecutionInfo("time:13.4s, loops:4, cop_task: {num: 655, max: 2.83s, min: 574.8µs, avg: 595ms, p95: 1.65s, max_proc_keys: 465701, p95_proc_keys: 458343, tot_proc: 5m50.1s, tot_wait: 24.2s, rpc_num: 655, rpc_time: 6m29.7s, copr_cache_hit_ratio: 0.55} ")
+	require.NotNil(t, stats.CopTask)
+	require.Equal(t, int64(655), stats.CopTask.Num)
+	require.Equal(t, 2830*time.Millisecond, stats.CopTask.Max)
+	require.Equal(t, 574800*time.Nanosecond, stats.CopTask.Min)
+	require.Equal(t, int64(465701), stats.CopTask.MaxProcKeys)
+	require.Equal(t, 5*time.Minute+50100*time.Millisecond, stats.CopTask.TotProc)
+	require.Equal(t, 0.55, stats.CopTask.CoprCacheHitRatio)
+	require.Equal(t, StatsKindRatio, stats.Lookup("cop_task", "copr_cache_hit_ratio").Kind)
+}
+
+func TestParseExecutionInfoTaskStats(t *testing.T) {
+	stats := ParseExecutionInfo("tikv_task:{proc max:893ms, min:270ms, p80:576ms, p95:676ms, iters:293267, tasks:655}")
+	require.NotNil(t, stats.TiKVTask)
+	require.Equal(t, 893*time.Millisecond, stats.TiKVTask.ProcMax)
+	require.Equal(t, 576*time.Millisecond, stats.TiKVTask.P80)
+	require.Equal(t, int64(293267), stats.TiKVTask.Iters)
+	require.Equal(t, int64(655), stats.TiKVTask.Tasks)
+	require.Nil(t, stats.TiFlashTask)
+
+	stats = ParseExecutionInfo("tiflash_task:{proc max:1.2s, min:1.1s, avg: 1.15s, p80:1.2s, iters:32, tasks:2, threads:16}")
+	require.NotNil(t, stats.TiFlashTask)
+	require.Equal(t, int64(16), stats.TiFlashTask.Threads)
+	require.Equal(t, 1150*time.Millisecond, stats.TiFlashTask.Avg)
+}
+
+func TestParseExecutionInfoNested(t *testing.T) {
+	stats := ParseExecutionInfo("tikv_task:{time:0s, loops:1}, scan_detail: {total_process_keys: 3, total_process_keys_size: 111, total_keys: 4, rocksdb: {delete_skipped_count: 0, key_skipped_count: 3, block: {cache_hit_count: 1, read_count: 2, read_byte: 1.5 KB}}}")
+	require.NotNil(t, stats.ScanDetail)
+	require.Equal(t, int64(3), stats.ScanDetail.TotalProcessKeys)
+	require.Equal(t, int64(4), stats.ScanDetail.TotalKeys)
+	require.Equal(t, int64(3), stats.ScanDetail.RocksDBKeySkippedCount)
+	require.Equal(t, int64(1), stats.ScanDetail.RocksDBBlockCacheHitCount)
+	require.Equal(t, int64(1536), stats.ScanDetail.RocksDBBlockReadByte)
+	require.Equal(t, int64(1), stats.TiKVTask.Loops)
+
+	stats = ParseExecutionInfo("time:5.1ms, loops:1, prepare: 12.3µs, check_insert: {total_time: 3.1ms, mem_insert_time: 10µs, prefetch: 3.09ms, rpc:{BatchGet:{num_rpc:1, total_time:3ms}}}, commit_txn: {prewrite:1.2ms, get_commit_ts:100µs, commit:800µs, slowest_prewrite_rpc: {total: 0.001s, region_id: 2, store: 127.0.0.1:20160, tikv_wall_time: 500µs}, region_num:1, write_keys:2, write_byte:60}")
+	require.NotNil(t, stats.CommitTxn)
+	require.Equal(t, 1200*time.Microsecond, stats.CommitTxn.Prewrite)
+	require.Equal(t, int64(2), stats.CommitTxn.WriteKeys)
+	require.Equal(t, "127.0.0.1:20160", stats.Lookup("commit_txn", "slowest_prewrite_rpc", "store").Raw)
+	require.Equal(t, 3*time.Millisecond, stats.Lookup("check_insert", "rpc", "BatchGet", "total_time").Duration())
+}
+
+func TestParseExecutionInfoUnknown(t *testing.T) {
+	stats := ParseExecutionInfo("time:1ms, loops:1, some_future_key: {foo: bar, baz: 12%}, backoff{regionMiss: 2ms}, flag, unbalanced: {a: 1")
+	require.Equal(t, time.Millisecond, stats.Time)
+	require.Equal(t, "bar", stats.Lookup("some_future_key", "foo").Raw)
+	require.Equal(t, 0.12, stats.Lookup("some_future_key", "baz").Value)
+	require.Equal(t, 2*time.Millisecond, stats.Lookup("backoff", "regionMiss").Duration())
+	require.NotNil(t, stats.Lookup("flag"))
+	require.Equal(t, int64(1), stats.Lookup("unbalanced", "a").Int())
+}
+
+func TestParseBytes(t *testing.T) {
+	v, ok := ParseBytes("45.4 KB")
+	require.True(t, ok)
+	require.Equal(t, int64(46490), v)
+	v, ok = ParseBytes("0 Bytes")
+	require.True(t, ok)
+	require.Equal(t, int64(0), v)
+	_, ok = ParseBytes("N/A")
+	require.False(t, ok)
+}
+
+func TestParsePlanRuntimeStats(t *testing.T) {
+	plan := mustParseTestData(t, "tpch_q1.txt")
+	require.Equal(t, int64(46490), *plan.Root.MemoryBytes)
+	require.Nil(t, plan.Root.Children[0].DiskBytes)
+	reader := plan.Root.Children[0].Children[0].Children[0]
+	require.Equal(t, int64(655), reader.RuntimeStats.CopTask.RPCNum)
+}
@@ -0,0 +1,226 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbstats
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Flags of the memory comparable datum encoding used by the index bounds and the TopN values.
+const (
+	flagNil          byte = 0
+	flagBytes        byte = 1
+	flagCompactBytes byte = 2
+	flagInt          byte = 3
+	flagUint         byte = 4
+	flagFloat        byte = 5
+	flagDecimal      byte = 6
+	flagDuration     byte = 7
+	flagVarint       byte = 8
+	flagUvarint      byte = 9
+	flagMax          byte = 250
+
+	signMask     uint64 = 0x8000000000000000
+	encGroupSize        = 8
+	encMarker           = byte(0xFF)
+
+	digitsPerWord = 9
+	wordSize      = 4
+)
+
+var dig2bytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// DecodeKey decodes the datums encoded by TiDB in the memory comparable format, and formats them for display.
+// Multiple datums, e.g. the bounds of a multi-column index, are formatted as `(a, b)`. Datums that cannot be
+// decoded, e.g. JSON, are formatted in hex together with the remaining bytes.
+//
+// Date and time values are encoded as unsigned integers, which are indistinguishable from BIGINT UNSIGNED
+// without the column type, so that they are formatted as integers.
+func DecodeKey(b []byte) string {
+	var values []string
+	for len(b) > 0 {
+		value, rest, ok := decodeDatum(b)
+		if !ok {
+			values = append(values, "0x"+hex.EncodeToString(b))
+			break
+		}
+		values = append(values, value)
+		b = rest
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+func decodeDatum(b []byte) (value string, rest []byte, ok bool) {
+	flag, b := b[0], b[1:]
+	switch flag {
+	case flagNil:
+		return "NULL", b, true
+	case flagMax:
+		return "MaxValue", b, true
+	case flagInt, flagDuration:
+		if len(b) < 8 {
+			return "", nil, false
+		}
+		v := int64(binary.BigEndian.Uint64(b) ^ signMask)
+		if flag == flagDuration {
+			return time.Duration(v).String(), b[8:], true
+		}
+		return strconv.FormatInt(v, 10), b[8:], true
+	case flagUint:
+		if len(b) < 8 {
+			return "", nil, false
+		}
+		return strconv.FormatUint(binary.BigEndian.Uint64(b), 10), b[8:], true
+	case flagFloat:
+		if len(b) < 8 {
+			return "", nil, false
+		}
+		u := binary.BigEndian.Uint64(b)
+		if u&signMask > 0 {
+			u &^= signMask
+		} else {
+			u = ^u
+		}
+		return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64), b[8:], true
+	case flagVarint:
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return "", nil, false
+		}
+		return strconv.FormatInt(v, 10), b[n:], true
+	case flagUvarint:
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return "", nil, false
+		}
+		return strconv.FormatUint(v, 10), b[n:], true
+	case flagBytes:
+		data, rest, ok := decodeBytes(b)
+		if !ok {
+			return "", nil, false
+		}
+		return formatBytes(data), rest, true
+	case flagCompactBytes:
+		n, size := binary.Varint(b)
+		if size <= 0 || n < 0 || int64(len(b)-size) < n {
+			return "", nil, false
+		}
+		b = b[size:]
+		return formatBytes(b[:n]), b[n:], true
+	case flagDecimal:
+		return decodeDecimal(b)
+	default:
+		return "", nil, false
+	}
+}
+
+// decodeBytes decodes the bytes encoded in groups of 8 bytes, each followed by a marker of the padding size.
+func decodeBytes(b []byte) (data []byte, rest []byte, ok bool) {
+	for {
+		if len(b) < encGroupSize+1 {
+			return nil, nil, false
+		}
+		group, marker := b[:encGroupSize], b[encGroupSize]
+		b = b[encGroupSize+1:]
+		padCount := int(encMarker - marker)
+		if padCount > encGroupSize {
+			return nil, nil, false
+		}
+		data = append(data, group[:encGroupSize-padCount]...)
+		if padCount != 0 {
+			return data, b, true
+		}
+	}
+}
+
+func formatBytes(b []byte) string {
+	if utf8.Valid(b) && strings.IndexFunc(string(b), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func readWord(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decodeDecimal decodes the decimal encoded by the precision, the fraction digits and the binary format of
+// MySQL, where every 9 digits are stored in 4 bytes.
+func decodeDecimal(b []byte) (value string, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return "", nil, false
+	}
+	precision, frac := int(b[0]), int(b[1])
+	b = b[2:]
+	intg := precision - frac
+	if intg < 0 {
+		return "", nil, false
+	}
+	size := intg/digitsPerWord*wordSize + dig2bytes[intg%digitsPerWord] +
+		frac/digitsPerWord*wordSize + dig2bytes[frac%digitsPerWord]
+	if size == 0 || len(b) < size {
+		return "", nil, false
+	}
+	bin := append([]byte(nil), b[:size]...)
+	negative := bin[0]&0x80 == 0
+	bin[0] ^= 0x80
+	if negative {
+		for i := range bin {
+			bin[i] = ^bin[i]
+		}
+	}
+
+	var intPart, fracPart strings.Builder
+	pos := 0
+	read := func(n int) uint64 {
+		v := readWord(bin[pos : pos+n])
+		pos += n
+		return v
+	}
+	if lead := intg % digitsPerWord; lead > 0 {
+		intPart.WriteString(strconv.FormatUint(read(dig2bytes[lead]), 10))
+	}
+	for i := 0; i < intg/digitsPerWord; i++ {
+		intPart.WriteString(padDigits(read(wordSize), digitsPerWord))
+	}
+	for i := 0; i < frac/digitsPerWord; i++ {
+		fracPart.WriteString(padDigits(read(wordSize), digitsPerWord))
+	}
+	if trail := frac % digitsPerWord; trail > 0 {
+		fracPart.WriteString(padDigits(read(dig2bytes[trail]), trail))
+	}
+
+	value = strings.TrimLeft(intPart.String(), "0")
+	if value == "" {
+		value = "0"
+	}
+	if fracPart.Len() > 0 {
+		value += "." + fracPart.String()
+	}
+	if negative {
+		value = "-" + value
+	}
+	return value, b[size:], true
+}
+
+func padDigits(v uint64, width int) string {
+	s := strconv.FormatUint(v, 10)
+	if len(s) < width {
+		s = strings.Repeat("0", width-len(s)) + s
+	}
+	return s
+}
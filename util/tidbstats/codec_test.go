@@ -0,0 +1,83 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbstats
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encodeInt(v int64) []byte {
+	b := make([]byte, 9)
+	b[0] = flagInt
+	binary.BigEndian.PutUint64(b[1:], uint64(v)^signMask)
+	return b
+}
+
+func encodeFloat(v float64) []byte {
+	u := math.Float64bits(v)
+	if v >= 0 {
+		u |= signMask
+	} else {
+		u = ^u
+	}
+	b := make([]byte, 9)
+	b[0] = flagFloat
+	binary.BigEndian.PutUint64(b[1:], u)
+	return b
+}
+
+func encodeBytes(data []byte) []byte {
+	b := []byte{flagBytes}
+	for i := 0; i <= len(data); i += encGroupSize {
+		group := make([]byte, encGroupSize)
+		n := copy(group, data[i:])
+		b = append(b, group...)
+		b = append(b, encMarker-byte(encGroupSize-n))
+	}
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestDecodeKey(t *testing.T) {
+	require.Equal(t, "-42", DecodeKey(encodeInt(-42)))
+	require.Equal(t, "1.5", DecodeKey(encodeFloat(1.5)))
+	require.Equal(t, "-0.25", DecodeKey(encodeFloat(-0.25)))
+	require.Equal(t, "hello", DecodeKey(encodeBytes([]byte("hello"))))
+	require.Equal(t, "exactly8", DecodeKey(encodeBytes([]byte("exactly8"))))
+	require.Equal(t, "0x00ff", DecodeKey(encodeBytes([]byte{0, 0xff})))
+	require.Equal(t, "NULL", DecodeKey([]byte{flagNil}))
+	require.Equal(t, "18446744073709551615", DecodeKey([]byte{flagUint, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+	require.Equal(t, "-3", DecodeKey([]byte{flagVarint, 5}))
+	require.Equal(t, "abc", DecodeKey([]byte{flagCompactBytes, 6, 'a', 'b', 'c'}))
+
+	// Multi-column index, with a trailing handle.
+	require.Equal(t, "(hello, NULL, 7)", DecodeKey(concat(encodeBytes([]byte("hello")), []byte{flagNil}, encodeInt(7))))
+
+	// Undecodable bytes are kept in hex.
+	require.Equal(t, "(1, 0x0a7b7d)", DecodeKey(concat(encodeInt(1), []byte{10, '{', '}'})))
+	require.Equal(t, "0x0301", DecodeKey([]byte{flagInt, 1}))
+}
+
+func TestDecodeDecimal(t *testing.T) {
+	// 12.34 as DECIMAL(4, 2).
+	require.Equal(t, "12.34", DecodeKey([]byte{flagDecimal, 4, 2, 0x80 | 12, 34}))
+	// -12.34, whose bytes are inverted.
+	require.Equal(t, "-12.34", DecodeKey([]byte{flagDecimal, 4, 2, ^byte(0x80 | 12), ^byte(34)}))
+	// 1234567890.5 as DECIMAL(11, 1): a leading digit, a full word and a fraction digit.
+	word := make([]byte, 4)
+	binary.BigEndian.PutUint32(word, 234567890)
+	require.Equal(t, "1234567890.5", DecodeKey(concat([]byte{flagDecimal, 11, 1, 0x80 | 1}, word, []byte{5})))
+	// 0.05 as DECIMAL(3, 2).
+	require.Equal(t, "0.05", DecodeKey([]byte{flagDecimal, 3, 2, 0x80, 5}))
+}
@@ -0,0 +1,241 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+// Package tidbstats decodes the statistics dumped by TiDB at `/stats/dump/{db}/{table}` into chart-ready data.
+package tidbstats
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/joomcode/errorx"
+)
+
+var (
+	ErrNS          = errorx.NewNamespace("tidb_stats")
+	ErrInvalidDump = ErrNS.NewType("invalid_dump")
+)
+
+// The JSON format of the stats dump, see `handle.JSONTable` in TiDB. Byte fields are in base64.
+type jsonTable struct {
+	DatabaseName string                 `json:"database_name"`
+	TableName    string                 `json:"table_name"`
+	Columns      map[string]*jsonColumn `json:"columns"`
+	Indices      map[string]*jsonColumn `json:"indices"`
+	Count        int64                  `json:"count"`
+	ModifyCount  int64                  `json:"modify_count"`
+	Partitions   map[string]*jsonTable  `json:"partitions"`
+	Version      uint64                 `json:"version"`
+}
+
+type jsonColumn struct {
+	Histogram         *jsonHistogram `json:"histogram"`
+	CMSketch          *jsonCMSketch  `json:"cm_sketch"`
+	NullCount         int64          `json:"null_count"`
+	TotColSize        int64          `json:"tot_col_size"`
+	LastUpdateVersion uint64         `json:"last_update_version"`
+	Correlation       float64        `json:"correlation"`
+	StatsVer          *int64         `json:"stats_ver"`
+}
+
+type jsonHistogram struct {
+	NDV     int64         `json:"ndv"`
+	Buckets []*jsonBucket `json:"buckets"`
+}
+
+type jsonBucket struct {
+	Count      int64  `json:"count"` // Cumulative
+	LowerBound []byte `json:"lower_bound"`
+	UpperBound []byte `json:"upper_bound"`
+	Repeats    int64  `json:"repeats"`
+	NDV        int64  `json:"ndv"`
+}
+
+type jsonCMSketch struct {
+	Rows []struct {
+		Counters []uint32 `json:"counters"`
+	} `json:"rows"`
+	TopN []struct {
+		Data  []byte `json:"data"`
+		Count uint64 `json:"count"`
+	} `json:"top_n"`
+	DefaultValue uint64 `json:"default_value"`
+}
+
+// Bucket is a histogram bucket. Count is the number of rows in this bucket, rather than the cumulative
+// count stored by TiDB, so that it can be charted directly.
+type Bucket struct {
+	Lower           string `json:"lower"`
+	Upper           string `json:"upper"`
+	Count           int64  `json:"count"`
+	CumulativeCount int64  `json:"cumulative_count"`
+	Repeats         int64  `json:"repeats"` // Number of rows equal to the upper bound
+	NDV             int64  `json:"ndv"`     // Only available in statistics version 2
+}
+
+// TopNItem is a most frequent value.
+type TopNItem struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+}
+
+// CMSketchSummary summarizes the Count-Min Sketch, whose counters are too large to be useful for display.
+type CMSketchSummary struct {
+	Depth        int    `json:"depth"`
+	Width        int    `json:"width"`
+	DefaultValue uint64 `json:"default_value"`
+}
+
+// ColumnStats is the statistics of a column or an index.
+type ColumnStats struct {
+	Name              string           `json:"name"`
+	IsIndex           bool             `json:"is_index"`
+	NDV               int64            `json:"ndv"`
+	NullCount         int64            `json:"null_count"`
+	TotColSize        int64            `json:"tot_col_size"`
+	Correlation       float64          `json:"correlation"`
+	StatsVer          int64            `json:"stats_ver"`
+	LastUpdateVersion uint64           `json:"last_update_version"`
+	HistogramRows     int64            `json:"histogram_rows"` // Rows covered by the histogram, excluding the TopN in version 2
+	TopNRows          uint64           `json:"topn_rows"`
+	Buckets           []Bucket         `json:"buckets"`
+	TopN              []TopNItem       `json:"topn"`
+	CMSketch          *CMSketchSummary `json:"cm_sketch,omitempty"`
+}
+
+// TableStats is the statistics of a table or a partition.
+type TableStats struct {
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	Partition   string `json:"partition,omitempty"`
+	Count       int64  `json:"count"`
+	ModifyCount int64  `json:"modify_count"`
+	// Healthy is the percentage of unmodified rows since the last analyze, computed the same as
+	// `SHOW STATS_HEALTHY`.
+	Healthy    int64          `json:"healthy"`
+	Version    uint64         `json:"version"`
+	Columns    []*ColumnStats `json:"columns"`
+	Indexes    []*ColumnStats `json:"indexes"`
+	Partitions []*TableStats  `json:"partitions,omitempty"`
+}
+
+// Healthy returns the percentage of unmodified rows, the same as `SHOW STATS_HEALTHY`.
+func Healthy(count, modifyCount int64) int64 {
+	switch {
+	case modifyCount < count:
+		return int64((1 - float64(modifyCount)/float64(count)) * 100)
+	case modifyCount == 0:
+		return 100
+	default:
+		return 0
+	}
+}
+
+// ParseDump decodes the statistics dump of a table.
+func ParseDump(data []byte) (*TableStats, error) {
+	var table jsonTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, ErrInvalidDump.Wrap(err, "invalid stats dump")
+	}
+	if table.TableName == "" {
+		return nil, ErrInvalidDump.New("table name is missing")
+	}
+	return convertTable(&table, ""), nil
+}
+
+func convertTable(table *jsonTable, partition string) *TableStats {
+	stats := &TableStats{
+		Database:    table.DatabaseName,
+		Table:       table.TableName,
+		Partition:   partition,
+		Count:       table.Count,
+		ModifyCount: table.ModifyCount,
+		Healthy:     Healthy(table.Count, table.ModifyCount),
+		Version:     table.Version,
+		Columns:     convertColumns(table.Columns, false),
+		Indexes:     convertColumns(table.Indices, true),
+	}
+	names := make([]string, 0, len(table.Partitions))
+	for name := range table.Partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p := table.Partitions[name]; p != nil {
+			stats.Partitions = append(stats.Partitions, convertTable(p, name))
+		}
+	}
+	return stats
+}
+
+func convertColumns(columns map[string]*jsonColumn, isIndex bool) []*ColumnStats {
+	result := make([]*ColumnStats, 0, len(columns))
+	for name, col := range columns {
+		if col != nil {
+			result = append(result, convertColumn(name, col, isIndex))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// convertColumn decodes the statistics of a column or an index. The bounds of column histograms are dumped
+// in text, while the bounds of index histograms and all TopN values are encoded datums.
+func convertColumn(name string, col *jsonColumn, isIndex bool) *ColumnStats {
+	stats := &ColumnStats{
+		Name:              name,
+		IsIndex:           isIndex,
+		NullCount:         col.NullCount,
+		TotColSize:        col.TotColSize,
+		Correlation:       col.Correlation,
+		LastUpdateVersion: col.LastUpdateVersion,
+		Buckets:           make([]Bucket, 0),
+		TopN:              make([]TopNItem, 0),
+	}
+	if col.StatsVer != nil {
+		stats.StatsVer = *col.StatsVer
+	}
+	bound := func(b []byte) string {
+		if isIndex {
+			return DecodeKey(b)
+		}
+		return formatBytes(b)
+	}
+	if hist := col.Histogram; hist != nil {
+		stats.NDV = hist.NDV
+		var prev int64
+		for _, b := range hist.Buckets {
+			if b == nil {
+				continue
+			}
+			stats.Buckets = append(stats.Buckets, Bucket{
+				Lower:           bound(b.LowerBound),
+				Upper:           bound(b.UpperBound),
+				Count:           b.Count - prev,
+				CumulativeCount: b.Count,
+				Repeats:         b.Repeats,
+				NDV:             b.NDV,
+			})
+			prev = b.Count
+		}
+		stats.HistogramRows = prev
+	}
+	if cms := col.CMSketch; cms != nil {
+		for _, item := range cms.TopN {
+			stats.TopN = append(stats.TopN, TopNItem{Value: DecodeKey(item.Data), Count: item.Count})
+			stats.TopNRows += item.Count
+		}
+		sort.SliceStable(stats.TopN, func(i, j int) bool {
+			return stats.TopN[i].Count > stats.TopN[j].Count
+		})
+		if len(cms.Rows) > 0 {
+			stats.CMSketch = &CMSketchSummary{
+				Depth:        len(cms.Rows),
+				Width:        len(cms.Rows[0].Counters),
+				DefaultValue: cms.DefaultValue,
+			}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 PingCAP, Inc. Licensed under Apache-2.0.
+
+package tidbstats
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestParseDump(t *testing.T) {
+	dump := fmt.Sprintf(`{
+  "database_name": "test",
+  "table_name": "t",
+  "columns": {
+    "b": {"histogram": {"ndv": 0}, "null_count": 0},
+    "a": {
+      "histogram": {"ndv": 20, "buckets": [
+        {"count": 40, "lower_bound": "%s", "upper_bound": "%s", "repeats": 5, "ndv": 10},
+        {"count": 100, "lower_bound": "%s", "upper_bound": "%s", "repeats": 8, "ndv": 10}
+      ]},
+      "cm_sketch": {
+        "rows": [{"counters": [1, 2, 3]}, {"counters": [4, 5, 6]}],
+        "top_n": [{"data": "%s", "count": 3}, {"data": "%s", "count": 50}],
+        "default_value": 1
+      },
+      "null_count": 2,
+      "tot_col_size": 800,
+      "last_update_version": 433,
+      "correlation": 0.9,
+      "stats_ver": 2
+    }
+  },
+  "indices": {
+    "idx_a_b": {
+      "histogram": {"ndv": 20, "buckets": [
+        {"count": 100, "lower_bound": "%s", "upper_bound": "%s", "repeats": 1}
+      ]},
+      "null_count": 0
+    }
+  },
+  "count": 150,
+  "modify_count": 30,
+  "partitions": null,
+  "version": 434
+}`,
+		b64([]byte("1")), b64([]byte("10")), b64([]byte("11")), b64([]byte("20")),
+		b64(encodeInt(7)), b64(encodeInt(99)),
+		b64(concat(encodeInt(1), encodeBytes([]byte("x")))), b64(concat(encodeInt(20), encodeBytes([]byte("y")))),
+	)
+
+	stats, err := ParseDump([]byte(dump))
+	require.NoError(t, err)
+	require.Equal(t, "test", stats.Database)
+	require.Equal(t, "t", stats.Table)
+	require.Equal(t, int64(80), stats.Healthy)
+	require.Equal(t, uint64(434), stats.Version)
+
+	require.Len(t, stats.Columns, 2)
+	a := stats.Columns[0]
+	require.Equal(t, "a", a.Name)
+	require.False(t, a.IsIndex)
+	require.Equal(t, int64(20), a.NDV)
+	require.Equal(t, int64(2), a.StatsVer)
+	require.Equal(t, []Bucket{
+		{Lower: "1", Upper: "10", Count: 40, CumulativeCount: 40, Repeats: 5, NDV: 10},
+		{Lower: "11", Upper: "20", Count: 60, CumulativeCount: 100, Repeats: 8, NDV: 10},
+	}, a.Buckets)
+	require.Equal(t, int64(100), a.HistogramRows)
+	require.Equal(t, []TopNItem{{Value: "99", Count: 50}, {Value: "7", Count: 3}}, a.TopN)
+	require.Equal(t, uint64(53), a.TopNRows)
+	require.Equal(t, &CMSketchSummary{Depth: 2, Width: 3, DefaultValue: 1}, a.CMSketch)
+
+	b := stats.Columns[1]
+	require.Empty(t, b.Buckets)
+	require.Empty(t, b.TopN)
+	require.Nil(t, b.CMSketch)
+
+	require.Len(t, stats.Indexes, 1)
+	require.True(t, stats.Indexes[0].IsIndex)
+	require.Equal(t, "(1, x)", stats.Indexes[0].Buckets[0].Lower)
+	require.Equal(t, "(20, y)", stats.Indexes[0].Buckets[0].Upper)
+}
+
+func TestParseDumpPartitions(t *testing.T) {
+	stats, err := ParseDump([]byte(`{"database_name": "test", "table_name": "t", "count": 0, "partitions": {
+      "p1": {"database_name": "test", "table_name": "t", "count": 10, "modify_count": 20},
+      "p0": {"database_name": "test", "table_name": "t", "count": 10, "modify_count": 0}
+    }}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), stats.Healthy)
+	require.Len(t, stats.Partitions, 2)
+	require.Equal(t, "p0", stats.Partitions[0].Partition)
+	require.Equal(t, int64(100), stats.Partitions[0].Healthy)
+	require.Equal(t, "p1", stats.Partitions[1].Partition)
+	require.Equal(t, int64(0), stats.Partitions[1].Healthy)
+}
+
+func TestParseDumpInvalid(t *testing.T) {
+	_, err := ParseDump([]byte("not json"))
+	require.True(t, errorx.IsOfType(err, ErrInvalidDump))
+	_, err = ParseDump([]byte("{}"))
+	require.True(t, errorx.IsOfType(err, ErrInvalidDump))
+}
@@ -63,3 +63,35 @@ func writeZipFromFile(zw *zip.Writer, file string, compress bool) error {
 
 	return nil
 }
+
+// Entry is an in-memory file to be compressed.
+type Entry struct {
+	Name    string // May contain directories, e.g. `schema/t.sql`
+	Content []byte
+}
+
+// WriteZipFromEntries compresses the in-memory `entries` using zip and write the zip in a streaming way to the
+// io Writer `w`. Unlike WriteZipFromFiles, the names are kept as they are.
+func WriteZipFromEntries(w io.Writer, entries []Entry, compress bool) error {
+	zw := zip.NewWriter(w)
+	zipMethod := zip.Store // no compress
+	if compress {
+		zipMethod = zip.Deflate // compress
+	}
+	for _, entry := range entries {
+		zipFile, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     entry.Name,
+			Method:   zipMethod,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			_ = zw.Close()
+			return err
+		}
+		if _, err := zipFile.Write(entry.Content); err != nil {
+			_ = zw.Close()
+			return err
+		}
+	}
+	return zw.Close()
+}